@@ -5,6 +5,8 @@ import axios from 'axios';
 const program = new Command();
 
 const BASE_URL = process.env.USERS_SERVICE_URL || 'http://localhost:8081';
+// Admin JWT or service token; the users service rejects requests without one.
+const TOKEN = process.env.USERS_SERVICE_TOKEN || '';
 
 interface Driver {
   id: string;
@@ -23,6 +25,7 @@ const api = axios.create({
   baseURL: BASE_URL,
   headers: {
     'Content-Type': 'application/json',
+    ...(TOKEN && { Authorization: `Bearer ${TOKEN}` }),
   },
 });
 
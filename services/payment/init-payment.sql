@@ -5,6 +5,13 @@ CREATE TABLE IF NOT EXISTS payments (
   payment_id VARCHAR(255) PRIMARY KEY,
   ride_id VARCHAR(255),
   amount DECIMAL(10, 2),
+  currency CHAR(3) DEFAULT 'CAD',
+  refunded_amount DECIMAL(10, 2) DEFAULT 0,
   status VARCHAR(50),
+  kind VARCHAR(20) DEFAULT 'FARE',
   timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS kind VARCHAR(20) DEFAULT 'FARE';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency CHAR(3) DEFAULT 'CAD';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10, 2) DEFAULT 0;
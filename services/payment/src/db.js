@@ -20,6 +20,16 @@ export async function initDB() {
   try {
     const client = await pool.connect();
     console.log("✅ Connecté à PostgreSQL");
+    // Databases created before fares and tips were told apart, before currencies and refunds
+    await client.query(
+      "ALTER TABLE payments ADD COLUMN IF NOT EXISTS kind VARCHAR(20) DEFAULT 'FARE'"
+    );
+    await client.query(
+      "ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency CHAR(3) DEFAULT 'CAD'"
+    );
+    await client.query(
+      "ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10, 2) DEFAULT 0"
+    );
     client.release();
   } catch (err) {
     console.error("❌ Erreur de connexion à PostgreSQL:", err);
@@ -4,24 +4,36 @@ import { v4 as uuidv4 } from "uuid";
 
 const router = express.Router();
 
+// A ride's fare and the tips added after it are separate payments
+const PAYMENT_KINDS = ["FARE", "TIP"];
+
+// Statuses of a payment whose amount was captured, even if part or all of it was refunded since
+const CAPTURED_STATUSES = ["CAPTURED", "PARTIALLY_REFUNDED", "REFUNDED"];
+
 router.post("/authorize", async (req, res) => {
   try {
-    const { ride_id, amount } = req.body;
+    const { ride_id, amount, currency = "CAD", kind = "FARE" } = req.body;
 
     if (!ride_id || !amount || Number(amount) <= 0) {
       return res.status(400).json({ error: "Invalid ride_id or amount" });
     }
+    if (!PAYMENT_KINDS.includes(kind)) {
+      return res.status(400).json({ error: "Invalid kind" });
+    }
+    if (!/^[A-Z]{3}$/.test(currency)) {
+      return res.status(400).json({ error: "Invalid currency" });
+    }
 
     const payment_id = "P-" + uuidv4();
     const db = getDB();
 
     await db.query(
-      "INSERT INTO payments (payment_id, ride_id, amount, status) VALUES ($1, $2, $3, $4)",
-      [payment_id, ride_id, amount, "AUTHORIZED"]
+      "INSERT INTO payments (payment_id, ride_id, amount, currency, status, kind) VALUES ($1, $2, $3, $4, $5, $6)",
+      [payment_id, ride_id, amount, currency, "AUTHORIZED", kind]
     );
 
     console.log(
-      `[PAYMENT] Authorized payment ${payment_id} for ride ${ride_id} amount ${amount}`
+      `[PAYMENT] Authorized ${kind} payment ${payment_id} for ride ${ride_id} amount ${amount} ${currency}`
     );
 
     return res.status(201).json({ payment_id, status: "AUTHORIZED" });
@@ -50,10 +62,19 @@ router.post("/capture", async (req, res) => {
       return res.status(404).json({ error: "Payment not found" });
     }
 
-    if (payment.status === "CAPTURED") {
-      return res
-        .status(409)
-        .json({ error: "Payment already captured", payment_id });
+    if (CAPTURED_STATUSES.includes(payment.status)) {
+      return res.status(409).json({
+        error: "Payment already captured",
+        payment_id,
+        status: payment.status,
+      });
+    }
+    if (payment.status !== "AUTHORIZED") {
+      return res.status(409).json({
+        error: "Payment is not authorized",
+        payment_id,
+        status: payment.status,
+      });
     }
 
     await db.query("UPDATE payments SET status = $1 WHERE payment_id = $2", [
@@ -70,4 +91,195 @@ router.post("/capture", async (req, res) => {
   }
 });
 
+router.post("/:payment_id/increment", async (req, res) => {
+  try {
+    const { payment_id } = req.params;
+    const { amount, currency } = req.body;
+
+    if (!amount || Number(amount) <= 0) {
+      return res.status(400).json({ error: "Invalid amount" });
+    }
+
+    const db = getDB();
+    const result = await db.query(
+      "UPDATE payments SET amount = amount + $1 WHERE payment_id = $2 AND status = $3 AND ($4::VARCHAR IS NULL OR currency = $4) RETURNING amount",
+      [amount, payment_id, "AUTHORIZED", currency ?? null]
+    );
+
+    if (result.rowCount === 0) {
+      const existing = await db.query(
+        "SELECT status FROM payments WHERE payment_id = $1",
+        [payment_id]
+      );
+      if (existing.rowCount === 0) {
+        return res.status(404).json({ error: "Payment not found" });
+      }
+      return res.status(409).json({
+        error: "Payment is not authorized",
+        payment_id,
+        status: existing.rows[0].status,
+      });
+    }
+
+    console.log(
+      `[PAYMENT] Incremented authorization ${payment_id} by ${amount} (total ${result.rows[0].amount})`
+    );
+
+    return res.json({
+      payment_id,
+      status: "AUTHORIZED",
+      amount: Number(result.rows[0].amount),
+    });
+  } catch (err) {
+    console.error("[PAYMENT][ERROR] increment:", err);
+    return res.status(500).json({ error: "Internal server error" });
+  }
+});
+
+// Releases an authorization that will never be captured
+router.post("/:payment_id/void", async (req, res) => {
+  try {
+    const { payment_id } = req.params;
+
+    const db = getDB();
+    const result = await db.query(
+      "UPDATE payments SET status = $1 WHERE payment_id = $2 AND status = $3",
+      ["VOIDED", payment_id, "AUTHORIZED"]
+    );
+
+    if (result.rowCount === 0) {
+      const existing = await db.query(
+        "SELECT status FROM payments WHERE payment_id = $1",
+        [payment_id]
+      );
+      if (existing.rowCount === 0) {
+        return res.status(404).json({ error: "Payment not found" });
+      }
+      const { status } = existing.rows[0];
+      return res.status(409).json({
+        error: CAPTURED_STATUSES.includes(status)
+          ? "Payment already captured"
+          : "Payment is not authorized",
+        payment_id,
+        status,
+      });
+    }
+
+    console.log(`[PAYMENT] Voided payment ${payment_id}`);
+
+    return res.json({ payment_id, status: "VOIDED" });
+  } catch (err) {
+    console.error("[PAYMENT][ERROR] void:", err);
+    return res.status(500).json({ error: "Internal server error" });
+  }
+});
+
+// Refunds a captured payment, entirely or partially when an amount is given
+router.post("/:payment_id/refund", async (req, res) => {
+  try {
+    const { payment_id } = req.params;
+    const { amount, currency } = req.body ?? {};
+
+    if (amount !== undefined && !(Number(amount) > 0)) {
+      return res.status(400).json({ error: "Invalid amount" });
+    }
+
+    const db = getDB();
+    const result = await db.query(
+      "SELECT * FROM payments WHERE payment_id = $1",
+      [payment_id]
+    );
+
+    const payment = result.rows[0];
+
+    if (!payment) {
+      return res.status(404).json({ error: "Payment not found" });
+    }
+    if (!["CAPTURED", "PARTIALLY_REFUNDED"].includes(payment.status)) {
+      return res.status(409).json({
+        error: "Payment is not captured",
+        payment_id,
+        status: payment.status,
+      });
+    }
+    if (currency !== undefined && currency !== payment.currency) {
+      return res.status(400).json({ error: "Currency mismatch" });
+    }
+
+    // Amounts are compared in cents to avoid rounding errors
+    const remaining =
+      Math.round(Number(payment.amount) * 100) -
+      Math.round(Number(payment.refunded_amount) * 100);
+    const refund =
+      amount === undefined ? remaining : Math.round(Number(amount) * 100);
+    if (refund > remaining) {
+      return res.status(400).json({
+        error: "Refund exceeds the captured amount",
+        payment_id,
+        refundable: remaining / 100,
+      });
+    }
+
+    const status = refund === remaining ? "REFUNDED" : "PARTIALLY_REFUNDED";
+    const updated = await db.query(
+      "UPDATE payments SET refunded_amount = refunded_amount + $1, status = $2 WHERE payment_id = $3 AND refunded_amount = $4 RETURNING refunded_amount",
+      [refund / 100, status, payment_id, payment.refunded_amount]
+    );
+    if (updated.rowCount === 0) {
+      return res.status(409).json({
+        error: "Payment was refunded concurrently",
+        payment_id,
+        status: payment.status,
+      });
+    }
+
+    console.log(
+      `[PAYMENT] Refunded ${refund / 100} ${payment.currency} of payment ${payment_id}`
+    );
+
+    return res.json({
+      payment_id,
+      status,
+      amount: Number(payment.amount),
+      refunded_amount: Number(updated.rows[0].refunded_amount),
+      currency: payment.currency,
+    });
+  } catch (err) {
+    console.error("[PAYMENT][ERROR] refund:", err);
+    return res.status(500).json({ error: "Internal server error" });
+  }
+});
+
+router.get("/:payment_id", async (req, res) => {
+  try {
+    const { payment_id } = req.params;
+
+    const db = getDB();
+    const result = await db.query(
+      "SELECT * FROM payments WHERE payment_id = $1",
+      [payment_id]
+    );
+
+    const payment = result.rows[0];
+
+    if (!payment) {
+      return res.status(404).json({ error: "Payment not found" });
+    }
+
+    return res.json({
+      payment_id: payment.payment_id,
+      ride_id: payment.ride_id,
+      amount: Number(payment.amount),
+      refunded_amount: Number(payment.refunded_amount),
+      currency: payment.currency,
+      status: payment.status,
+      kind: payment.kind,
+      timestamp: payment.timestamp,
+    });
+  } catch (err) {
+    console.error("[PAYMENT][ERROR] get:", err);
+    return res.status(500).json({ error: "Internal server error" });
+  }
+});
+
 export default router;
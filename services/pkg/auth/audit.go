@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DecisionDeny is the decision of the events recorded for denied requests.
+const DecisionDeny = "deny"
+
+// AuditEvent is an authorization decision, written to the audit log as one JSON line.
+type AuditEvent struct {
+	Time       time.Time  `json:"time"`
+	Service    string     `json:"service"`
+	Decision   string     `json:"decision"`
+	Permission Permission `json:"permission"`
+	Subject    string     `json:"subject"`
+	Role       Role       `json:"role"`
+	Method     string     `json:"method"`
+	Path       string     `json:"path"`
+	Remote     string     `json:"remote"`
+}
+
+// AuditLog is the stream of authorization decisions, kept apart from the service logs so that
+// it can be shipped and retained on its own.
+type AuditLog struct {
+	service string
+	mu      sync.Mutex
+	enc     *json.Encoder
+}
+
+// NewAuditLog returns an audit log writing the decisions of the named service to w.
+func NewAuditLog(w io.Writer, service string) *AuditLog {
+	return &AuditLog{service: service, enc: json.NewEncoder(w)}
+}
+
+// Deny records that the principal was denied the permission for the request.
+func (l *AuditLog) Deny(r *http.Request, p *Principal, perm Permission) {
+	l.write(AuditEvent{
+		Time:       time.Now().UTC(),
+		Service:    l.service,
+		Decision:   DecisionDeny,
+		Permission: perm,
+		Subject:    p.Subject,
+		Role:       p.Role,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Remote:     r.RemoteAddr,
+	})
+}
+
+func (l *AuditLog) write(event AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.enc.Encode(event); err != nil {
+		log.Printf("[ERROR] Failed to write audit event: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Package auth authenticates the callers of the API with JWT bearer tokens, signed by the
+// identity provider with the keys of a JWKS file, or with the token shared by the RideNow
+// services.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Role is what a principal is to RideNow, from the role claim of its token.
+type Role string
+
+const (
+	RolePassenger Role = "passenger"
+	RoleDriver    Role = "driver"
+	// RoleDispatcher is the operations staff following the rides as they happen.
+	RoleDispatcher Role = "dispatcher"
+	RoleAdmin      Role = "admin"
+	// RoleService is another RideNow service.
+	RoleService Role = "service"
+)
+
+// serviceSubject is the subject of the principal authenticated with the service token.
+const serviceSubject = "service"
+
+// leeway tolerates the clock skew between the identity provider and the services.
+const leeway = 30 * time.Second
+
+// signingMethods are the algorithms tokens may be signed with: asymmetric ones only, so that
+// the services only ever hold public keys.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+var ErrMissingToken = errors.New("missing bearer token")
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Subject is the driver or passenger ID of drivers and passengers.
+	Subject string
+	Role    Role
+}
+
+type claims struct {
+	Role Role `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Config holds the token requirements.
+type Config struct {
+	// Issuer and Audience, when set, must match the iss and aud claims of tokens.
+	Issuer   string
+	Audience string
+	// ServiceToken authenticates the other RideNow services as RoleService. Empty disables it.
+	ServiceToken string
+}
+
+type Authenticator struct {
+	keys   *KeySet
+	config Config
+	parser *jwt.Parser
+}
+
+func NewAuthenticator(keys *KeySet, config Config) *Authenticator {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	}
+	if config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(config.Audience))
+	}
+	return &Authenticator{keys: keys, config: config, parser: jwt.NewParser(opts...)}
+}
+
+// Authenticate returns the principal of the request's bearer token.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	if a.config.ServiceToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.config.ServiceToken)) == 1 {
+		return &Principal{Subject: serviceSubject, Role: RoleService}, nil
+	}
+
+	var c claims
+	if _, err := a.parser.ParseWithClaims(token, &c, a.key); err != nil {
+		return nil, err
+	}
+	switch c.Role {
+	case RolePassenger, RoleDriver, RoleDispatcher, RoleAdmin, RoleService:
+	default:
+		return nil, fmt.Errorf("unknown role %q", c.Role)
+	}
+	if c.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return &Principal{Subject: c.Subject, Role: c.Role}, nil
+}
+
+// key returns the key of the JWKS file named by the token's kid header.
+func (a *Authenticator) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := a.keys.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if k.alg != "" && k.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("signing key %q is not for %s", kid, token.Method.Alg())
+	}
+	return k.key, nil
+}
+
+// bearerToken reads the token of the Authorization header, or the access_token query parameter
+// of WebSocket handshakes, to which browsers cannot add headers.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+type principalKey struct{}
+
+// Middleware authenticates every request, answering 401 to those without a valid token, and
+// makes the principal available to handlers through FromRequest.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			challenge := `Bearer realm="ridenow"`
+			if !errors.Is(err, ErrMissingToken) {
+				log.Printf("[AUTH] Rejected token for %s %s: %v", r.Method, r.URL.Path, err)
+				challenge += `, error="invalid_token"`
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// FromRequest returns the principal authenticated by Middleware. Requests that did not go
+// through it get a principal without any role, allowed nothing.
+func FromRequest(r *http.Request) *Principal {
+	if p, ok := r.Context().Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	return &Principal{}
+}
@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKey is a signing key of the identity provider.
+type testKey struct {
+	kid     string
+	private any
+	jwk     map[string]string
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, private: key, jwk: map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   encodeBase64(key.X.FillBytes(make([]byte, 32))),
+		"y":   encodeBase64(key.Y.FillBytes(make([]byte, 32))),
+	}}
+}
+
+func newRSAKey(t *testing.T, kid string, bits int) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, private: key, jwk: map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   encodeBase64(key.N.Bytes()),
+		"e":   encodeBase64(big.NewInt(int64(key.E)).Bytes()),
+	}}
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJWKS writes the public keys to the JWKS file at path, dated modTime so that Reload sees
+// the change.
+func writeJWKS(t *testing.T, path string, modTime time.Time, keys ...testKey) {
+	t.Helper()
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{Keys: []map[string]string{}}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadKeys(t *testing.T, keys ...testKey) (*KeySet, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, time.Now(), keys...)
+	ks, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks, path
+}
+
+// validClaims are the claims of a driver's token, valid for an hour.
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":  "driver-1",
+		"role": "driver",
+		"iss":  "https://id.ridenow.test",
+		"aud":  "ridenow",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key testKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if key.kid != "" {
+		token.Header["kid"] = key.kid
+	}
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func bearer(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/rides", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestAuthenticateAcceptsValidToken(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{Issuer: "https://id.ridenow.test", Audience: "ridenow"})
+
+	p, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodES256, key, validClaims())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "driver-1" || p.Role != RoleDriver {
+		t.Errorf("principal = %+v, want driver-1 as %s", p, RoleDriver)
+	}
+}
+
+func TestAuthenticateRejectsSymmetricAndUnsignedTokens(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{})
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An HMAC keyed with the public key, which anyone can read from the JWKS file.
+	public, _ := json.Marshal(key.jwk)
+	tokens := map[string]string{
+		"none":  unsigned,
+		"HS256": sign(t, jwt.SigningMethodHS256, testKey{kid: "k1", private: public}, validClaims()),
+		"HS512": sign(t, jwt.SigningMethodHS512, testKey{kid: "k1", private: public}, validClaims()),
+	}
+	for alg, token := range tokens {
+		if p, err := a.Authenticate(bearer(token)); err == nil {
+			t.Errorf("%s token accepted as %+v", alg, p)
+		}
+	}
+}
+
+func TestAuthenticateRejectsAlgorithmOtherThanTheKeys(t *testing.T) {
+	key := newRSAKey(t, "k1", 2048)
+	key.jwk["alg"] = "RS256"
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{})
+
+	if _, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodRS256, key, validClaims()))); err != nil {
+		t.Errorf("RS256 token rejected: %v", err)
+	}
+	if _, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodPS256, key, validClaims()))); err == nil {
+		t.Error("PS256 token accepted with a key restricted to RS256")
+	}
+}
+
+func TestAuthenticateChecksExpiryWithLeeway(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{})
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		claim func(jwt.MapClaims)
+		ok    bool
+	}{
+		{"expired within leeway", func(c jwt.MapClaims) { c["exp"] = now.Add(-leeway / 2).Unix() }, true},
+		{"expired past leeway", func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * leeway).Unix() }, false},
+		{"without expiry", func(c jwt.MapClaims) { delete(c, "exp") }, false},
+		{"valid soon within leeway", func(c jwt.MapClaims) { c["nbf"] = now.Add(leeway / 2).Unix() }, true},
+		{"not yet valid", func(c jwt.MapClaims) { c["nbf"] = now.Add(2 * leeway).Unix() }, false},
+	}
+	for _, tt := range tests {
+		claims := validClaims()
+		tt.claim(claims)
+		_, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodES256, key, claims)))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want accepted %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestAuthenticateChecksIssuerAndAudience(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{Issuer: "https://id.ridenow.test", Audience: "ridenow"})
+
+	tests := []struct {
+		name  string
+		claim func(jwt.MapClaims)
+	}{
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }},
+		{"without issuer", func(c jwt.MapClaims) { delete(c, "iss") }},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "payments" }},
+		{"without audience", func(c jwt.MapClaims) { delete(c, "aud") }},
+	}
+	for _, tt := range tests {
+		claims := validClaims()
+		tt.claim(claims)
+		if p, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodES256, key, claims))); err == nil {
+			t.Errorf("%s: token accepted as %+v", tt.name, p)
+		}
+	}
+
+	claims := validClaims()
+	claims["aud"] = []string{"payments", "ridenow"}
+	if _, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodES256, key, claims))); err != nil {
+		t.Errorf("token for several audiences rejected: %v", err)
+	}
+}
+
+func TestAuthenticateRejectsUnknownKey(t *testing.T) {
+	known := newECKey(t, "k1")
+	ks, _ := loadKeys(t, known)
+	a := NewAuthenticator(ks, Config{})
+
+	other := newECKey(t, "k2")
+	impostor := newECKey(t, "k1")
+	withoutKid := known
+	withoutKid.kid = ""
+	tokens := map[string]string{
+		"unknown kid":            sign(t, jwt.SigningMethodES256, other, validClaims()),
+		"known kid, other key":   sign(t, jwt.SigningMethodES256, impostor, validClaims()),
+		"known key, without kid": sign(t, jwt.SigningMethodES256, withoutKid, validClaims()),
+	}
+	for name, token := range tokens {
+		if p, err := a.Authenticate(bearer(token)); err == nil {
+			t.Errorf("%s: token accepted as %+v", name, p)
+		}
+	}
+}
+
+func TestAuthenticateRequiresKnownRoleAndSubject(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{})
+
+	unknownRole := validClaims()
+	unknownRole["role"] = "superuser"
+	noSubject := validClaims()
+	delete(noSubject, "sub")
+	for name, claims := range map[string]jwt.MapClaims{"unknown role": unknownRole, "no subject": noSubject} {
+		if p, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodES256, key, claims))); err == nil {
+			t.Errorf("%s: token accepted as %+v", name, p)
+		}
+	}
+}
+
+func TestAuthenticateServiceToken(t *testing.T) {
+	ks, _ := LoadKeySet("")
+	a := NewAuthenticator(ks, Config{ServiceToken: "shared-secret"})
+
+	p, err := a.Authenticate(bearer("shared-secret"))
+	if err != nil || p.Role != RoleService {
+		t.Errorf("service token = %+v, %v, want %s", p, err, RoleService)
+	}
+	if p, err := a.Authenticate(bearer("shared-secret-2")); err == nil {
+		t.Errorf("other token accepted as %+v", p)
+	}
+
+	disabled := NewAuthenticator(ks, Config{})
+	if p, err := disabled.Authenticate(bearer("")); err == nil {
+		t.Errorf("empty token accepted as %+v without a service token", p)
+	}
+}
+
+func TestAccessTokenOnlyOnWebSocketUpgrade(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{})
+	token := sign(t, jwt.SigningMethodES256, key, validClaims())
+
+	r := httptest.NewRequest("GET", "/rides/1/track?access_token="+token, nil)
+	if _, err := a.Authenticate(r); !errors.Is(err, ErrMissingToken) {
+		t.Errorf("access_token of a plain request: err = %v, want %v", err, ErrMissingToken)
+	}
+
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	if p, err := a.Authenticate(r); err != nil || p.Subject != "driver-1" {
+		t.Errorf("access_token of a WebSocket handshake = %+v, %v", p, err)
+	}
+
+	r = httptest.NewRequest("GET", "/rides", nil)
+	r.Header.Set("Authorization", "Basic "+token)
+	if _, err := a.Authenticate(r); !errors.Is(err, ErrMissingToken) {
+		t.Errorf("Basic authorization: err = %v, want %v", err, ErrMissingToken)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, _ := loadKeys(t, key)
+	a := NewAuthenticator(ks, Config{})
+
+	var got *Principal
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, bearer(sign(t, jwt.SigningMethodES256, key, validClaims())))
+	if w.Code != http.StatusOK || got == nil || got.Subject != "driver-1" {
+		t.Errorf("valid token: status %d, principal %+v", w.Code, got)
+	}
+
+	tests := map[string]struct {
+		request   *http.Request
+		challenge string
+	}{
+		"missing": {httptest.NewRequest("GET", "/rides", nil), `Bearer realm="ridenow"`},
+		"invalid": {bearer("not-a-token"), `Bearer realm="ridenow", error="invalid_token"`},
+	}
+	for name, tt := range tests {
+		got = nil
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, tt.request)
+		if w.Code != http.StatusUnauthorized || got != nil {
+			t.Errorf("%s token: status %d, handler called: %v", name, w.Code, got != nil)
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); challenge != tt.challenge {
+			t.Errorf("%s token: challenge %q, want %q", name, challenge, tt.challenge)
+		}
+	}
+
+	if p := FromRequest(httptest.NewRequest("GET", "/", nil)); p.Role != "" {
+		t.Errorf("principal without Middleware = %+v, want no role", p)
+	}
+}
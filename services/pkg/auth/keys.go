@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys.
+const minRSABits = 2048
+
+// KeySet holds the public keys tokens are signed with, read from a JWKS file (RFC 7517). Keys
+// are rotated by adding the new key to the file before signing with it, then removing the old
+// one once the tokens it signed have expired; Run picks the changes up without a restart.
+type KeySet struct {
+	path    string
+	mu      sync.RWMutex
+	keys    map[string]publicKey
+	modTime time.Time
+}
+
+// publicKey is a verification key, restricted to one algorithm when its JWK says so.
+type publicKey struct {
+	key any
+	alg string
+}
+
+// LoadKeySet reads the JWKS file at path. An empty path gives an empty key set, which no token
+// is valid with.
+func LoadKeySet(path string) (*KeySet, error) {
+	ks := &KeySet{path: path, keys: map[string]publicKey{}}
+	if path == "" {
+		return ks, nil
+	}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload reads the JWKS file again if it was modified since it was last read. The current keys
+// are kept when the new file is invalid.
+func (ks *KeySet) Reload() error {
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	ks.mu.RLock()
+	unchanged := info.ModTime().Equal(ks.modTime)
+	ks.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(ks.path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("invalid JWKS file %s: %w", ks.path, err)
+	}
+
+	ks.mu.Lock()
+	ks.keys, ks.modTime = keys, info.ModTime()
+	ks.mu.Unlock()
+
+	log.Printf("[AUTH] Loaded %d signing key(s) from %s", len(keys), ks.path)
+	return nil
+}
+
+// Run reloads the JWKS file on every tick if it changed, until ctx is cancelled.
+func (ks *KeySet) Run(ctx context.Context, interval time.Duration) {
+	if ks.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Reload(); err != nil {
+				log.Printf("[ERROR] Failed to reload signing keys: %v", err)
+			}
+		}
+	}
+}
+
+func (ks *KeySet) lookup(kid string) (publicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// jwk is a JSON Web Key. Only the public members of RSA, EC and OKP (Ed25519) keys are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the signing keys of a JWKS document by key ID. Every key must have an ID,
+// which tokens name in their kid header.
+func parseJWKS(data []byte) (map[string]publicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Kid == "" {
+			return nil, fmt.Errorf("key %d has no kid", i)
+		}
+		if _, dup := keys[k.Kid]; dup {
+			return nil, fmt.Errorf("duplicate kid %q", k.Kid)
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBase64(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid e")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key shorter than %d bits", minRSABits)
+		}
+		return key, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		var point ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, point = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, point = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, point = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, errX := decodeBase64(k.X)
+		y, errY := decodeBase64(k.Y)
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid coordinates")
+		}
+		// The uncompressed encoding is only accepted by crypto/ecdh for points on the curve.
+		if _, err := point.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBase64(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestReloadPicksUpRotatedKeys(t *testing.T) {
+	old, next := newECKey(t, "2024-01"), newECKey(t, "2024-02")
+	ks, path := loadKeys(t, old)
+	a := NewAuthenticator(ks, Config{})
+	oldToken := sign(t, jwt.SigningMethodES256, old, validClaims())
+	nextToken := sign(t, jwt.SigningMethodES256, next, validClaims())
+
+	if _, err := a.Authenticate(bearer(nextToken)); err == nil {
+		t.Fatal("token signed with a key not published yet accepted")
+	}
+
+	// The new key is published before tokens are signed with it.
+	writeJWKS(t, path, time.Now().Add(time.Minute), old, next)
+	if err := ks.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"old": oldToken, "next": nextToken} {
+		if _, err := a.Authenticate(bearer(token)); err != nil {
+			t.Errorf("%s key during the rotation: %v", name, err)
+		}
+	}
+
+	// The old key is withdrawn once the tokens it signed have expired.
+	writeJWKS(t, path, time.Now().Add(2*time.Minute), next)
+	if err := ks.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(bearer(oldToken)); err == nil {
+		t.Error("token signed with a withdrawn key accepted")
+	}
+	if _, err := a.Authenticate(bearer(nextToken)); err != nil {
+		t.Errorf("next key after the rotation: %v", err)
+	}
+}
+
+func TestReloadSkipsUnchangedFile(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, path := loadKeys(t, key)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewritten with the same modification time, the file is not read again.
+	writeJWKS(t, path, info.ModTime())
+	if err := ks.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ks.lookup("k1"); !ok {
+		t.Error("key dropped although the file was not modified")
+	}
+}
+
+func TestReloadKeepsKeysWhenFileIsInvalid(t *testing.T) {
+	key := newECKey(t, "k1")
+	ks, path := loadKeys(t, key)
+
+	if err := os.WriteFile(path, []byte(`{"keys": [{"kty": "EC"`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Reload(); err == nil {
+		t.Error("invalid JWKS file loaded")
+	}
+	if _, ok := ks.lookup("k1"); !ok {
+		t.Error("keys dropped after a failed reload")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Reload(); err == nil {
+		t.Error("missing JWKS file loaded")
+	}
+	if _, ok := ks.lookup("k1"); !ok {
+		t.Error("keys dropped after the file was removed")
+	}
+}
+
+func TestLoadKeySetWithoutFileAcceptsNoToken(t *testing.T) {
+	ks, err := LoadKeySet("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator(ks, Config{})
+	if p, err := a.Authenticate(bearer(sign(t, jwt.SigningMethodES256, newECKey(t, "k1"), validClaims()))); err == nil {
+		t.Errorf("token accepted as %+v without signing keys", p)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	ec := newECKey(t, "ec").jwk
+	rsaKey := newRSAKey(t, "rsa", 2048).jwk
+	ed := `{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`
+
+	keys, err := parseJWKS([]byte(`{"keys": [` + jwkJSON(t, ec) + `, ` + jwkJSON(t, rsaKey) + `, ` + ed + `,
+		{"kty": "EC", "kid": "enc", "use": "enc", "crv": "P-256"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []string{"ec", "rsa", "ed"} {
+		if _, ok := keys[kid]; !ok {
+			t.Errorf("key %s not loaded", kid)
+		}
+	}
+	if _, ok := keys["enc"]; ok {
+		t.Error("encryption key loaded as a signing key")
+	}
+}
+
+func TestParseJWKSRejectsInvalidKeys(t *testing.T) {
+	ec := newECKey(t, "ec").jwk
+	offCurve := map[string]string{"kty": "EC", "kid": "off", "crv": "P-256", "x": ec["x"], "y": ec["x"]}
+	short := newRSAKey(t, "short", 1024).jwk
+	noKid := map[string]string{"kty": "EC", "crv": "P-256", "x": ec["x"], "y": ec["y"]}
+
+	tests := map[string]string{
+		"no kid":            jwkJSON(t, noKid),
+		"duplicate kid":     jwkJSON(t, ec) + ", " + jwkJSON(t, ec),
+		"point off curve":   jwkJSON(t, offCurve),
+		"short RSA key":     jwkJSON(t, short),
+		"unsupported curve": `{"kty": "EC", "kid": "k", "crv": "secp256k1", "x": "", "y": ""}`,
+		"unsupported type":  `{"kty": "oct", "kid": "k", "k": "c2VjcmV0"}`,
+	}
+	for name, keys := range tests {
+		if _, err := parseJWKS([]byte(`{"keys": [` + keys + `]}`)); err == nil {
+			t.Errorf("%s: JWKS accepted", name)
+		}
+	}
+}
+
+func jwkJSON(t *testing.T, jwk map[string]string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("{")
+	first := true
+	for k, v := range jwk {
+		if !first {
+			b.WriteString(", ")
+		}
+		first = false
+		b.WriteString(`"` + k + `": "` + v + `"`)
+	}
+	b.WriteString("}")
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package auth
+
+import "net/http"
+
+// Permission is an operation of the API, granted to roles by a Policy.
+type Permission string
+
+// Scope is the extent of a permission granted to a role.
+type Scope int
+
+const (
+	// ScopeNone denies the permission.
+	ScopeNone Scope = iota
+	// ScopeOwn grants the permission on the principal's own resources: its driver or passenger
+	// account, and the rides it takes part in.
+	ScopeOwn
+	// ScopeAll grants the permission on every resource.
+	ScopeAll
+)
+
+// Policy grants permissions to roles. Permissions it does not grant to a role are denied.
+type Policy map[Permission]map[Role]Scope
+
+// Scope returns the extent of the permission granted to the principal.
+func (p Policy) Scope(principal *Principal, perm Permission) Scope {
+	return p[perm][principal.Role]
+}
+
+// Ownership reports whether the resource of a request belongs to the principal. It is only
+// consulted for permissions granted with ScopeOwn.
+type Ownership func(r *http.Request, p *Principal) bool
+
+// Self is the ownership of driver and passenger routes, whose {id} path value is the ID of the
+// driver or passenger.
+func Self(r *http.Request, p *Principal) bool {
+	return p.Subject != "" && r.PathValue("id") == p.Subject
+}
+
+// Anyone is the ownership of requests whose resource is only known once their body is read: it
+// lets them through for the handler to check with Allowed.
+func Anyone(r *http.Request, p *Principal) bool {
+	return true
+}
+
+// Owner is the ownership of the driver or passenger with the given ID.
+func Owner(id string) Ownership {
+	return func(r *http.Request, p *Principal) bool {
+		return p.Subject != "" && id == p.Subject
+	}
+}
+
+// Authorizer decides the requests of authenticated principals against a Policy, and records
+// its denials in an audit log.
+type Authorizer struct {
+	policy Policy
+	audit  *AuditLog
+}
+
+func NewAuthorizer(policy Policy, audit *AuditLog) *Authorizer {
+	return &Authorizer{policy: policy, audit: audit}
+}
+
+// Allowed reports whether the principal of the request has the permission on the resource
+// owned according to owns, which may be nil for requests on no particular resource.
+func (a *Authorizer) Allowed(r *http.Request, perm Permission, owns Ownership) bool {
+	p := FromRequest(r)
+	switch a.policy.Scope(p, perm) {
+	case ScopeAll:
+		return true
+	case ScopeOwn:
+		if owns != nil && owns(r, p) {
+			return true
+		}
+	}
+	a.audit.Deny(r, p, perm)
+	return false
+}
+
+// Require only lets through the requests allowed the permission, and answers 403 to the others.
+func (a *Authorizer) Require(perm Permission, owns Ownership, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Allowed(r, perm, owns) {
+			Forbid(w)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Forbid answers a request denied by the Authorizer.
+func Forbid(w http.ResponseWriter) {
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
@@ -0,0 +1,5 @@
+module ridenow/pkg
+
+go 1.24.4
+
+require github.com/golang-jwt/jwt/v5 v5.3.1
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"ridenow/pkg/auth"
+	"rides/internal/capture"
+	"rides/internal/clock"
 	"rides/internal/database"
+	"rides/internal/dispatcher"
+	"rides/internal/payouts"
+	"rides/internal/pricing"
+	"rides/internal/ratings"
+	"rides/internal/reconcile"
 	"rides/internal/server"
 	"rides/internal/services"
+	"strconv"
+	"time"
+	_ "time/tzdata" // analytics accept any IANA time zone, whatever the image ships
 )
 
 func main() {
@@ -17,15 +30,81 @@ func main() {
 		log.Fatal(err)
 	}
 
+	serviceToken := getEnv("SERVICE_TOKEN", "")
+	if serviceToken == "" {
+		log.Println("[WARN] SERVICE_TOKEN not set, calls between services will be rejected")
+	}
+
+	jwksFile := getEnv("JWT_JWKS_FILE", "")
+	if jwksFile == "" {
+		log.Println("[WARN] JWT_JWKS_FILE not set, only the service token is accepted")
+	}
+	keys, err := auth.LoadKeySet(jwksFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go keys.Run(context.Background(), getDurationEnv("JWKS_REFRESH_INTERVAL", time.Minute))
+	authn := auth.NewAuthenticator(keys, auth.Config{
+		Issuer:       getEnv("JWT_ISSUER", ""),
+		Audience:     getEnv("JWT_AUDIENCE", ""),
+		ServiceToken: serviceToken,
+	})
+
+	// Denied requests are audited as JSON lines, on stdout unless AUDIT_LOG_FILE is set.
+	auditOutput := os.Stdout
+	if path := getEnv("AUDIT_LOG_FILE", ""); path != "" {
+		auditOutput, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			log.Fatalf("invalid AUDIT_LOG_FILE: %v", err)
+		}
+	}
+	audit := auth.NewAuditLog(auditOutput, "rides")
+
 	usersServiceURL := getEnv("USERS_SERVICE_URL", "http://localhost:3000")
-	userService := services.NewUserService(usersServiceURL)
+	userService := services.NewUserService(usersServiceURL, serviceToken)
 
 	paymentServiceURL := getEnv("PAYMENT_SERVICE_URL", "http://localhost:8004")
 	paymentService := services.NewPaymentService(paymentServiceURL)
 
+	clk := clock.System()
+	d := dispatcher.NewDispatcher(db, userService, paymentService, clk, dispatcher.Config{
+		LeadTime:        getDurationEnv("SCHEDULE_LEAD_TIME", 15*time.Minute),
+		SearchRadius:    getFloatEnv("DISPATCH_RADIUS_METERS", 10000),
+		OfferTimeout:    getDurationEnv("OFFER_TIMEOUT", 30*time.Second),
+		MaxOffers:       getIntEnv("MAX_OFFERS_PER_RIDE", 5),
+		MinDriverRating: getFloatEnv("DISPATCH_MIN_DRIVER_RATING", 0),
+		StuckAfter:      getDurationEnv("DISPATCH_STUCK_AFTER", time.Minute),
+		ExpireAfter:     getDurationEnv("SCHEDULE_EXPIRE_AFTER", 30*time.Minute),
+	})
+	go d.Run(context.Background(), getDurationEnv("DISPATCH_INTERVAL", 5*time.Second))
+
+	quotes := pricing.NewQuoteSigner(quoteSigningKey(), getDurationEnv("QUOTE_TTL", 5*time.Minute), clk)
+
+	statements := payouts.NewGenerator(db, clk)
+	go statements.Run(context.Background(), getDurationEnv("STATEMENT_INTERVAL", time.Hour))
+
+	commissionPercent := int64(getIntEnv("PLATFORM_COMMISSION_PERCENT", 20))
+	reconciler := reconcile.NewReconciler(db, paymentService, clk, commissionPercent)
+	go reconciler.Run(context.Background(), getDurationEnv("RECONCILE_INTERVAL", 10*time.Minute))
+
+	captures := capture.NewQueue(db, paymentService, clk, capture.Config{
+		Workers:           getIntEnv("CAPTURE_WORKERS", 2),
+		MaxAttempts:       getIntEnv("CAPTURE_MAX_ATTEMPTS", 8),
+		Backoff:           getDurationEnv("CAPTURE_BACKOFF", 30*time.Second),
+		CommissionPercent: commissionPercent,
+	})
+	go captures.Run(context.Background(), getDurationEnv("CAPTURE_POLL_INTERVAL", 5*time.Second))
+
+	ratingsApplier := ratings.NewApplier(db, userService, clk)
+	go ratingsApplier.Run(context.Background(), getDurationEnv("RATING_RETRY_INTERVAL", time.Minute))
+
 	port := fmt.Sprintf(":%s", getEnv("PORT", "8080"))
 
-	s := server.NewServer(db, userService, paymentService)
+	s := server.NewServer(db, userService, paymentService, d, quotes, statements, reconciler, captures, ratingsApplier, authn, audit, clk, server.Config{
+		PoolMatchWindow:   getDurationEnv("POOL_MATCH_WINDOW", 10*time.Minute),
+		TipWindow:         getDurationEnv("TIP_WINDOW", 24*time.Hour),
+		CommissionPercent: commissionPercent,
+	})
 
 	log.Printf("🚀 Service Rides démarré sur le port %s", port)
 	if err := http.ListenAndServe(port, s); err != nil {
@@ -39,3 +118,54 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return d
+}
+
+// quoteSigningKey returns the key used to sign price quotes. Without QUOTE_SIGNING_KEY a random
+// key is used, so quotes do not survive a restart nor work across replicas.
+func quoteSigningKey() []byte {
+	if key, exists := os.LookupEnv("QUOTE_SIGNING_KEY"); exists && key != "" {
+		return []byte(key)
+	}
+
+	log.Println("[WARN] QUOTE_SIGNING_KEY not set, using a random key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	return key
+}
+
+func getFloatEnv(key string, fallback float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return f
+}
+
+func getIntEnv(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return i
+}
@@ -17,7 +17,8 @@ db.rides.insertMany([
     driver_id: "driver-001",
     from_zone: "Downtown",
     to_zone: "Airport",
-    price: 25.50,
+    price: { amount: NumberLong(2550), currency: "CAD" },
+    currency: "CAD",
     status: "ASSIGNED",
     payment_status: "PENDING",
     created_at: new Date(),
@@ -28,7 +29,8 @@ db.rides.insertMany([
     driver_id: "driver-002",
     from_zone: "Suburbs",
     to_zone: "City Center",
-    price: 18.75,
+    price: { amount: NumberLong(1875), currency: "CAD" },
+    currency: "CAD",
     status: "IN_PROGRESS",
     payment_status: "PENDING",
     created_at: new Date(),
@@ -39,7 +41,8 @@ db.rides.insertMany([
     driver_id: "driver-003",
     from_zone: "Beach",
     to_zone: "Hotel District",
-    price: 32.00,
+    price: { amount: NumberLong(3200), currency: "CAD" },
+    currency: "CAD",
     status: "COMPLETED",
     payment_status: "CAPTURED",
     created_at: new Date(),
@@ -50,7 +53,8 @@ db.rides.insertMany([
     driver_id: "driver-004",
     from_zone: "University",
     to_zone: "Train Station",
-    price: 15.25,
+    price: { amount: NumberLong(1525), currency: "CAD" },
+    currency: "CAD",
     status: "CANCELLED",
     payment_status: "REFUNDED",
     created_at: new Date(),
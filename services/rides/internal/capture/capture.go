@@ -0,0 +1,293 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"rides/internal/clock"
+	"rides/internal/ledger"
+	"rides/internal/money"
+	"rides/internal/pricing"
+	"rides/internal/services"
+	"rides/internal/types"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// lease is how long a claimed job is hidden from other workers. A worker that dies with a
+	// job leaves it to be claimed again once the lease expires.
+	lease = 2 * time.Minute
+	// maxBackoff caps the delay between two attempts.
+	maxBackoff = time.Hour
+)
+
+// errRideNotFound is a job whose ride no longer exists.
+var errRideNotFound = errors.New("ride not found")
+
+// Config holds the retry policy of the capture queue.
+type Config struct {
+	// Workers is the number of jobs processed concurrently.
+	Workers int
+	// MaxAttempts is the number of attempts after which a job is moved to the dead letters.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled after each further failure.
+	Backoff time.Duration
+	// CommissionPercent is the share of each fare kept by the platform when crediting drivers.
+	CommissionPercent int64
+}
+
+// Store holds the capture jobs and the rides and ledger they update. It is implemented by
+// *database.Database.
+type Store interface {
+	EnqueueCapture(ctx context.Context, job *types.CaptureJob) error
+	ClaimCaptureJob(ctx context.Context, now time.Time, lease time.Duration) (*types.CaptureJob, error)
+	RetryCaptureJob(ctx context.Context, job *types.CaptureJob, availableAt time.Time, lastError string) error
+	CompleteCaptureJob(ctx context.Context, job *types.CaptureJob) error
+	BuryCaptureJob(ctx context.Context, job *types.CaptureJob, lastError string, now time.Time) error
+	RequeueDeadCaptureJob(ctx context.Context, id primitive.ObjectID, now time.Time) (*types.CaptureJob, error)
+	GetRideByID(ctx context.Context, id primitive.ObjectID) (*types.Ride, error)
+	UpdateRidePaymentStatus(ctx context.Context, id primitive.ObjectID, paymentStatus string) error
+	SetPoolPassengerPayment(ctx context.Context, id primitive.ObjectID, passengerID, paymentID, paymentStatus string) error
+	PostTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// Queue captures the payments of finished rides in the background, so that a capture failing
+// while the payment service is down is retried rather than lost. Jobs are stored in MongoDB and
+// survive restarts; a job failing MaxAttempts times, or failing in a way retrying cannot fix,
+// is moved to the dead letters until requeued.
+type Queue struct {
+	db       Store
+	payments *services.PaymentService
+	clock    clock.Clock
+	config   Config
+	wake     chan struct{}
+}
+
+func NewQueue(db Store, payments *services.PaymentService, clk clock.Clock, config Config) *Queue {
+	return &Queue{db: db, payments: payments, clock: clk, config: config, wake: make(chan struct{}, 1)}
+}
+
+// Enqueue queues the fare of a ride for capture, or only that of a passenger of a pooled ride
+// when passengerID is set. Payments already captured or never authorized are skipped.
+func (q *Queue) Enqueue(ctx context.Context, ride *types.Ride, passengerID string) error {
+	var jobs []*types.CaptureJob
+	now := q.clock.Now()
+	add := func(passengerID, paymentID, paymentStatus string) {
+		if paymentID == "" || paymentStatus == "CAPTURED" {
+			return
+		}
+		jobs = append(jobs, &types.CaptureJob{
+			RideID:      ride.ID,
+			PassengerID: passengerID,
+			PaymentID:   paymentID,
+			AvailableAt: now,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+	}
+
+	if ride.Mode == types.ModePool {
+		for _, p := range ride.Passengers {
+			if passengerID == "" || p.PassengerID == passengerID {
+				add(p.PassengerID, p.PaymentID, p.PaymentStatus)
+			}
+		}
+	} else {
+		add("", ride.PaymentID, ride.PaymentStatus)
+	}
+
+	for _, job := range jobs {
+		if err := q.db.EnqueueCapture(ctx, job); err != nil {
+			return fmt.Errorf("failed to queue capture of payment %s: %w", job.PaymentID, err)
+		}
+	}
+	if len(jobs) > 0 {
+		q.notify()
+	}
+	return nil
+}
+
+// Requeue moves a dead job back to the queue, due now with its attempts reset. It returns
+// mongo.ErrNoDocuments when there is no such dead job.
+func (q *Queue) Requeue(ctx context.Context, id primitive.ObjectID) (*types.CaptureJob, error) {
+	job, err := q.db.RequeueDeadCaptureJob(ctx, id, q.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[CAPTURE] Paiement %s remis en file", job.PaymentID)
+	q.notify()
+	return job, nil
+}
+
+// notify wakes a waiting worker up, so that new jobs do not wait for the next poll.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes the queue with the configured number of workers, each polling for due jobs
+// every interval, until ctx is cancelled.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	var wg sync.WaitGroup
+	for range max(q.config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, interval)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Due jobs are processed back to back; the worker only waits once the queue is drained.
+		for q.processNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// processNext claims the job due the longest and attempts its capture. It reports whether a
+// job was processed.
+func (q *Queue) processNext(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	job, err := q.db.ClaimCaptureJob(ctx, q.clock.Now(), lease)
+	if err != nil {
+		log.Printf("[ERROR] Failed to claim capture job: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, lease)
+	defer cancel()
+
+	err = q.capture(jobCtx, job)
+	switch {
+	case err == nil:
+		if err := q.db.CompleteCaptureJob(jobCtx, job); err != nil {
+			log.Printf("[ERROR] Failed to complete capture job %s: %v", job.ID.Hex(), err)
+		}
+		log.Printf("[CAPTURE] Paiement %s de la course %s capturé (tentative %d)", job.PaymentID, job.RideID.Hex(), job.Attempts)
+	case permanent(err) || job.Attempts >= q.config.MaxAttempts:
+		if err := q.db.BuryCaptureJob(jobCtx, job, err.Error(), q.clock.Now()); err != nil {
+			log.Printf("[ERROR] Failed to move capture job %s to the dead letters: %v", job.ID.Hex(), err)
+		}
+		log.Printf("[CAPTURE] Échec définitif de la capture du paiement %s après %d tentative(s): %v", job.PaymentID, job.Attempts, err)
+	default:
+		retryAt := q.clock.Now().Add(q.backoff(job.Attempts))
+		if err := q.db.RetryCaptureJob(jobCtx, job, retryAt, err.Error()); err != nil {
+			log.Printf("[ERROR] Failed to reschedule capture job %s: %v", job.ID.Hex(), err)
+		}
+		log.Printf("[CAPTURE] Échec de la capture du paiement %s (tentative %d), nouvelle tentative à %s: %v", job.PaymentID, job.Attempts, retryAt.Format(time.RFC3339), err)
+	}
+	return true
+}
+
+// backoff is the delay before the retry following the given number of attempts: Backoff, then
+// doubled at each attempt, up to maxBackoff.
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.config.Backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// permanent reports whether retrying a failed capture cannot succeed: the ride or the payment
+// is gone, or the payment is in a status that cannot be captured, e.g. voided.
+func permanent(err error) bool {
+	return errors.Is(err, errRideNotFound) ||
+		errors.Is(err, services.ErrPaymentNotFound) ||
+		errors.Is(err, services.ErrInvalidPaymentRequest) ||
+		errors.Is(err, services.ErrPaymentConflict)
+}
+
+// capture captures the job's payment, then records it on the ride and credits the fare to the
+// driver. A payment already captured, e.g. by an attempt whose worker died before completing
+// the job, is only recorded; crediting is idempotent.
+func (q *Queue) capture(ctx context.Context, job *types.CaptureJob) error {
+	ride, err := q.db.GetRideByID(ctx, job.RideID)
+	if err == mongo.ErrNoDocuments {
+		return errRideNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get ride: %w", err)
+	}
+
+	err = q.payments.CapturePayment(job.PaymentID)
+	if err != nil && !errors.Is(err, services.ErrPaymentAlreadyCaptured) {
+		return err
+	}
+
+	if job.PassengerID == "" {
+		if err := q.db.UpdateRidePaymentStatus(ctx, ride.ID, "CAPTURED"); err != nil {
+			return fmt.Errorf("failed to update payment status: %w", err)
+		}
+		return q.credit(ctx, ride, ride.Fare, ride.Price, job.PaymentID)
+	}
+
+	i := slices.IndexFunc(ride.Passengers, func(p types.RidePassenger) bool { return p.PassengerID == job.PassengerID })
+	if i < 0 {
+		return fmt.Errorf("passenger %s not found on ride", job.PassengerID)
+	}
+	if err := q.db.SetPoolPassengerPayment(ctx, ride.ID, job.PassengerID, "", "CAPTURED"); err != nil {
+		return fmt.Errorf("failed to update payment status: %w", err)
+	}
+	if err := q.credit(ctx, ride, ride.Passengers[i].Fare, ride.Passengers[i].Price, job.PaymentID); err != nil {
+		return err
+	}
+	return q.settlePool(ctx, ride.ID)
+}
+
+// settlePool marks a pooled ride's payment captured once every passenger's fare is. The ride is
+// read again after this passenger's update, so that of two passengers captured concurrently at
+// least one sees the other.
+func (q *Queue) settlePool(ctx context.Context, id primitive.ObjectID) error {
+	ride, err := q.db.GetRideByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get ride: %w", err)
+	}
+	if ride.PaymentStatus == "CAPTURED" || slices.ContainsFunc(ride.Passengers, func(p types.RidePassenger) bool { return p.PaymentStatus != "CAPTURED" }) {
+		return nil
+	}
+	if err := q.db.UpdateRidePaymentStatus(ctx, id, "CAPTURED"); err != nil {
+		return fmt.Errorf("failed to update payment status: %w", err)
+	}
+	return nil
+}
+
+// credit posts a captured fare to the ledger, crediting the ride's driver net of the platform
+// commission.
+func (q *Queue) credit(ctx context.Context, ride *types.Ride, fare *pricing.Breakdown, price money.Money, paymentID string) error {
+	if ride.DriverID == "" {
+		return nil
+	}
+	tx := ledger.Fare(ride.DriverID, ride.ID, paymentID, fare, price, q.config.CommissionPercent, q.clock.Now())
+	if err := q.db.PostTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("failed to credit fare to driver %s: %w", ride.DriverID, err)
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package capture
+
+import (
+	"context"
+	"net/http"
+	"rides/internal/clock"
+	"rides/internal/ledger"
+	"rides/internal/money"
+	"rides/internal/services"
+	"rides/internal/services/paymenttest"
+	"rides/internal/types"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var start = time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+// memoryStore is an in-memory Store with the semantics of the Mongo queries.
+type memoryStore struct {
+	mu           sync.Mutex
+	jobs         map[primitive.ObjectID]*types.CaptureJob
+	dead         map[primitive.ObjectID]*types.CaptureJob
+	rides        map[primitive.ObjectID]*types.Ride
+	transactions []types.Transaction
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		jobs:  map[primitive.ObjectID]*types.CaptureJob{},
+		dead:  map[primitive.ObjectID]*types.CaptureJob{},
+		rides: map[primitive.ObjectID]*types.Ride{},
+	}
+}
+
+func (m *memoryStore) addRide(ride *types.Ride) *types.Ride {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ride.ID = primitive.NewObjectID()
+	m.rides[ride.ID] = ride
+	return ride
+}
+
+func (m *memoryStore) ride(id primitive.ObjectID) types.Ride {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.rides[id]
+}
+
+// queued returns the queued and the dead jobs.
+func (m *memoryStore) queued() (jobs, dead []types.CaptureJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		jobs = append(jobs, *job)
+	}
+	for _, job := range m.dead {
+		dead = append(dead, *job)
+	}
+	return jobs, dead
+}
+
+func (m *memoryStore) EnqueueCapture(ctx context.Context, job *types.CaptureJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, queued := range m.jobs {
+		if queued.PaymentID == job.PaymentID {
+			return nil
+		}
+	}
+	copied := *job
+	copied.ID = primitive.NewObjectID()
+	m.jobs[copied.ID] = &copied
+	return nil
+}
+
+func (m *memoryStore) ClaimCaptureJob(ctx context.Context, now time.Time, lease time.Duration) (*types.CaptureJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*types.CaptureJob
+	for _, job := range m.jobs {
+		if !job.AvailableAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].AvailableAt.Before(due[j].AvailableAt) })
+	due[0].AvailableAt = now.Add(lease)
+	due[0].Attempts++
+	due[0].UpdatedAt = now
+	copied := *due[0]
+	return &copied, nil
+}
+
+// claimed returns the queued job if it was not claimed again since job was.
+func (m *memoryStore) claimed(job *types.CaptureJob) (*types.CaptureJob, bool) {
+	queued, ok := m.jobs[job.ID]
+	return queued, ok && queued.Attempts == job.Attempts
+}
+
+func (m *memoryStore) RetryCaptureJob(ctx context.Context, job *types.CaptureJob, availableAt time.Time, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if queued, ok := m.claimed(job); ok {
+		queued.AvailableAt = availableAt
+		queued.LastError = lastError
+	}
+	return nil
+}
+
+func (m *memoryStore) CompleteCaptureJob(ctx context.Context, job *types.CaptureJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.claimed(job); ok {
+		delete(m.jobs, job.ID)
+	}
+	return nil
+}
+
+func (m *memoryStore) BuryCaptureJob(ctx context.Context, job *types.CaptureJob, lastError string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.claimed(job); !ok {
+		return nil
+	}
+	dead := *job
+	dead.LastError = lastError
+	dead.UpdatedAt = now
+	dead.DeadAt = &now
+	m.dead[job.ID] = &dead
+	delete(m.jobs, job.ID)
+	return nil
+}
+
+func (m *memoryStore) RequeueDeadCaptureJob(ctx context.Context, id primitive.ObjectID, now time.Time) (*types.CaptureJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dead, ok := m.dead[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	job := *dead
+	job.Attempts = 0
+	job.AvailableAt = now
+	job.UpdatedAt = now
+	job.DeadAt = nil
+	queued := job
+	m.jobs[id] = &queued
+	delete(m.dead, id)
+	return &job, nil
+}
+
+func (m *memoryStore) GetRideByID(ctx context.Context, id primitive.ObjectID) (*types.Ride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ride, ok := m.rides[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *ride
+	copied.Passengers = slices.Clone(ride.Passengers)
+	return &copied, nil
+}
+
+func (m *memoryStore) UpdateRidePaymentStatus(ctx context.Context, id primitive.ObjectID, paymentStatus string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rides[id].PaymentStatus = paymentStatus
+	return nil
+}
+
+func (m *memoryStore) SetPoolPassengerPayment(ctx context.Context, id primitive.ObjectID, passengerID, paymentID, paymentStatus string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, p := range m.rides[id].Passengers {
+		if p.PassengerID != passengerID {
+			continue
+		}
+		if paymentID != "" {
+			m.rides[id].Passengers[i].PaymentID = paymentID
+		}
+		m.rides[id].Passengers[i].PaymentStatus = paymentStatus
+	}
+	return nil
+}
+
+func (m *memoryStore) PostTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := ledger.Validate(tx); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, posted := range m.transactions {
+		if posted.Kind == tx.Kind && posted.Reference == tx.Reference {
+			return nil
+		}
+	}
+	m.transactions = append(m.transactions, *tx)
+	return nil
+}
+
+func newTestQueue(t *testing.T, maxAttempts int) (*Queue, *memoryStore, *paymenttest.Server, *clock.Mock) {
+	clk := clock.NewMock(start)
+	store := newMemoryStore()
+	payments := paymenttest.NewServer(clk)
+	t.Cleanup(payments.Close)
+
+	q := NewQueue(store, payments.PaymentService(), clk, Config{
+		Workers:           1,
+		MaxAttempts:       maxAttempts,
+		Backoff:           time.Minute,
+		CommissionPercent: 20,
+	})
+	return q, store, payments, clk
+}
+
+// completedRide adds a completed ride whose fare is authorized, and queues its capture.
+func completedRide(t *testing.T, q *Queue, store *memoryStore, payments *paymenttest.Server) *types.Ride {
+	t.Helper()
+	paymentID := payments.Add(services.Payment{Amount: money.Cents(2000), Status: services.PaymentStatusAuthorized})
+	ride := store.addRide(&types.Ride{
+		PassengerID:   "passenger-1",
+		DriverID:      "driver-1",
+		FromZone:      "Downtown",
+		ToZone:        "Airport",
+		Price:         money.Cents(2000),
+		Status:        types.StatusCompleted,
+		PaymentID:     paymentID,
+		PaymentStatus: "PENDING",
+		CreatedAt:     start,
+		UpdatedAt:     start,
+	})
+	if err := q.Enqueue(context.Background(), ride, ""); err != nil {
+		t.Fatal(err)
+	}
+	return ride
+}
+
+func TestProcessCapturesPaymentAndCreditsDriver(t *testing.T) {
+	q, store, payments, _ := newTestQueue(t, 5)
+	ride := completedRide(t, q, store, payments)
+
+	if !q.processNext(context.Background()) {
+		t.Fatal("no job processed")
+	}
+	if p, _ := payments.Payment(ride.PaymentID); p.Status != services.PaymentStatusCaptured {
+		t.Errorf("payment is %s, want %s", p.Status, services.PaymentStatusCaptured)
+	}
+	if got := store.ride(ride.ID).PaymentStatus; got != "CAPTURED" {
+		t.Errorf("ride payment status is %s, want CAPTURED", got)
+	}
+	if jobs, dead := store.queued(); len(jobs) != 0 || len(dead) != 0 {
+		t.Errorf("jobs left = %+v, dead = %+v, want none", jobs, dead)
+	}
+	if len(store.transactions) != 1 || store.transactions[0].Kind != types.TransactionFare || store.transactions[0].DriverID != "driver-1" {
+		t.Errorf("transactions = %+v, want the fare credited to driver-1", store.transactions)
+	}
+	if q.processNext(context.Background()) {
+		t.Error("a job was processed from an empty queue")
+	}
+}
+
+func TestClaimedJobWaitsForItsLease(t *testing.T) {
+	q, store, payments, clk := newTestQueue(t, 5)
+	ride := completedRide(t, q, store, payments)
+
+	// A worker claims the job and dies before finishing it.
+	if job, err := store.ClaimCaptureJob(context.Background(), clk.Now(), lease); err != nil || job == nil {
+		t.Fatalf("claim = %v, %v", job, err)
+	}
+	if q.processNext(context.Background()) {
+		t.Fatal("job processed while leased to another worker")
+	}
+
+	clk.Advance(lease)
+	if !q.processNext(context.Background()) {
+		t.Fatal("job not processed once its lease expired")
+	}
+	if p, _ := payments.Payment(ride.PaymentID); p.Status != services.PaymentStatusCaptured {
+		t.Errorf("payment is %s, want %s", p.Status, services.PaymentStatusCaptured)
+	}
+	if jobs, _ := store.queued(); len(jobs) != 0 {
+		t.Errorf("jobs left = %+v, want none", jobs)
+	}
+}
+
+func TestFailedCaptureIsRetriedWithBackoff(t *testing.T) {
+	q, store, payments, clk := newTestQueue(t, 5)
+	ride := completedRide(t, q, store, payments)
+	payments.Fail(paymenttest.OpCapture, http.StatusServiceUnavailable)
+
+	for attempt, delay := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		if !q.processNext(context.Background()) {
+			t.Fatalf("attempt %d not processed", attempt+1)
+		}
+		jobs, _ := store.queued()
+		if len(jobs) != 1 || jobs[0].Attempts != attempt+1 || !jobs[0].AvailableAt.Equal(clk.Now().Add(delay)) || jobs[0].LastError == "" {
+			t.Fatalf("after attempt %d, jobs = %+v, want one retried after %s", attempt+1, jobs, delay)
+		}
+
+		clk.Advance(delay - time.Second)
+		if q.processNext(context.Background()) {
+			t.Fatalf("attempt %d retried before its backoff", attempt+1)
+		}
+		clk.Advance(time.Second)
+	}
+
+	payments.Fail(paymenttest.OpCapture, 0)
+	if !q.processNext(context.Background()) {
+		t.Fatal("last attempt not processed")
+	}
+	if p, _ := payments.Payment(ride.PaymentID); p.Status != services.PaymentStatusCaptured {
+		t.Errorf("payment is %s, want %s", p.Status, services.PaymentStatusCaptured)
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	q, _, _, _ := newTestQueue(t, 5)
+	tests := map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 7: maxBackoff, 100: maxBackoff}
+	for attempts, want := range tests {
+		if got := q.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestJobIsBuriedAfterMaxAttempts(t *testing.T) {
+	q, store, payments, clk := newTestQueue(t, 2)
+	ride := completedRide(t, q, store, payments)
+	payments.Fail(paymenttest.OpCapture, http.StatusServiceUnavailable)
+
+	q.processNext(context.Background())
+	clk.Advance(time.Minute)
+	q.processNext(context.Background())
+
+	jobs, dead := store.queued()
+	if len(jobs) != 0 || len(dead) != 1 || dead[0].Attempts != 2 || dead[0].DeadAt == nil {
+		t.Fatalf("jobs = %+v, dead = %+v, want the job dead after 2 attempts", jobs, dead)
+	}
+	if p, _ := payments.Payment(ride.PaymentID); p.Status != services.PaymentStatusAuthorized {
+		t.Errorf("payment is %s, want it still %s", p.Status, services.PaymentStatusAuthorized)
+	}
+}
+
+func TestPermanentFailureIsBuriedAtOnce(t *testing.T) {
+	q, store, payments, _ := newTestQueue(t, 5)
+	paymentID := payments.Add(services.Payment{Amount: money.Cents(2000), Status: services.PaymentStatusVoided})
+	ride := store.addRide(&types.Ride{
+		DriverID:      "driver-1",
+		Price:         money.Cents(2000),
+		Status:        types.StatusCompleted,
+		PaymentID:     paymentID,
+		PaymentStatus: "PENDING",
+	})
+	if err := q.Enqueue(context.Background(), ride, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	q.processNext(context.Background())
+	if jobs, dead := store.queued(); len(jobs) != 0 || len(dead) != 1 || dead[0].Attempts != 1 {
+		t.Errorf("jobs = %+v, dead = %+v, want the job dead after 1 attempt", jobs, dead)
+	}
+	if len(store.transactions) != 0 {
+		t.Errorf("transactions = %+v, want none", store.transactions)
+	}
+}
+
+func TestRequeuedJobIsCaptured(t *testing.T) {
+	q, store, payments, clk := newTestQueue(t, 1)
+	ride := completedRide(t, q, store, payments)
+	payments.Fail(paymenttest.OpCapture, http.StatusServiceUnavailable)
+	q.processNext(context.Background())
+	_, dead := store.queued()
+	if len(dead) != 1 {
+		t.Fatalf("dead = %+v, want the job dead", dead)
+	}
+
+	payments.Fail(paymenttest.OpCapture, 0)
+	clk.Advance(time.Hour)
+	job, err := q.Requeue(context.Background(), dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Attempts != 0 || !job.AvailableAt.Equal(clk.Now()) {
+		t.Errorf("requeued job = %+v, want it due now with no attempts", job)
+	}
+	if _, err := q.Requeue(context.Background(), dead[0].ID); err != mongo.ErrNoDocuments {
+		t.Errorf("requeuing twice = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+
+	if !q.processNext(context.Background()) {
+		t.Fatal("requeued job not processed")
+	}
+	if p, _ := payments.Payment(ride.PaymentID); p.Status != services.PaymentStatusCaptured {
+		t.Errorf("payment is %s, want %s", p.Status, services.PaymentStatusCaptured)
+	}
+	if jobs, dead := store.queued(); len(jobs) != 0 || len(dead) != 0 {
+		t.Errorf("jobs = %+v, dead = %+v, want none", jobs, dead)
+	}
+}
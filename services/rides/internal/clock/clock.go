@@ -0,0 +1,50 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts the current time so time-based behaviour can be driven deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// System returns the wall clock.
+func System() Clock {
+	return systemClock{}
+}
+
+// Mock is a Clock that only moves when told to.
+type Mock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewMock(now time.Time) *Mock {
+	return &Mock{now: now}
+}
+
+func (m *Mock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *Mock) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+func (m *Mock) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"math"
+	"rides/internal/money"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Time buckets of analytics reports.
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// AnalyticsQuery is the period of an analytics report, [From, To), and how it is split in
+// buckets: hours, days, weeks starting on Monday or months, in the time zone Location.
+type AnalyticsQuery struct {
+	From     time.Time
+	To       time.Time
+	Bucket   string
+	Location *time.Location
+}
+
+// truncate is the start of the bucket holding the date, computed by MongoDB.
+func (q AnalyticsQuery) truncate(date string) bson.M {
+	trunc := bson.M{"date": date, "unit": q.Bucket, "timezone": q.Location.String()}
+	if q.Bucket == BucketWeek {
+		trunc["startOfWeek"] = "monday"
+	}
+	return bson.M{"$dateTrunc": trunc}
+}
+
+// duration is how much of the bucket starting at start lies within the period.
+func (q AnalyticsQuery) duration(start time.Time) time.Duration {
+	start = start.In(q.Location)
+	var end time.Time
+	switch q.Bucket {
+	case BucketHour:
+		end = start.Add(time.Hour)
+	case BucketWeek:
+		end = start.AddDate(0, 0, 7)
+	case BucketMonth:
+		end = start.AddDate(0, 1, 0)
+	default:
+		end = start.AddDate(0, 0, 1)
+	}
+	if start.Before(q.From) {
+		start = q.From
+	}
+	if end.After(q.To) {
+		end = q.To
+	}
+	return end.Sub(start)
+}
+
+// moneyField converts a sum of amounts in cents to a money document in the default currency.
+func moneyField(cents any) bson.M {
+	return bson.M{"amount": roundCents(cents), "currency": money.DefaultCurrency}
+}
+
+// capturedTips sums the captured tips of a ride.
+var capturedTips = bson.M{"$sum": bson.M{"$map": bson.M{
+	"input": bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$tips", bson.A{}}},
+		"cond":  bson.M{"$eq": bson.A{"$$this.payment_status", "CAPTURED"}},
+	}},
+	"in": "$$this.amount.amount",
+}}}
+
+func countIf(status string) bson.M {
+	return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", status}}, 1, 0}}}
+}
+
+// completedDuring matches the rides completed during the period.
+func completedDuring(q AnalyticsQuery) bson.M {
+	return bson.M{"status": types.StatusCompleted, "completed_at": bson.M{"$gte": q.From, "$lt": q.To}}
+}
+
+// ZonePairStats counts the rides requested during the period per pair of pickup and
+// destination zones, busiest first, up to limit pairs. Pooled rides count once, between the
+// zones of the passenger who opened them.
+func (db *Database) ZonePairStats(ctx context.Context, q AnalyticsQuery, limit int) ([]types.ZonePairStats, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": q.From, "$lt": q.To}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       bson.M{"from": "$from_zone", "to": "$to_zone"},
+			"rides":     bson.M{"$sum": 1},
+			"completed": countIf(types.StatusCompleted),
+			"cancelled": countIf(types.StatusCancelled),
+			"revenue": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$status", types.StatusCompleted}}, "$price.amount", 0,
+			}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "rides", Value: -1}, {Key: "_id.from", Value: 1}, {Key: "_id.to", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.M{
+			"_id":       0,
+			"from_zone": "$_id.from",
+			"to_zone":   "$_id.to",
+			"rides":     1,
+			"completed": 1,
+			"cancelled": 1,
+			"revenue":   moneyField("$revenue"),
+			"average_price": moneyField(bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$completed", 0}}, bson.M{"$divide": bson.A{"$revenue", "$completed"}}, 0,
+			}}),
+		}}},
+	}
+
+	stats := []types.ZonePairStats{}
+	if err := db.aggregateRides(ctx, pipeline, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// RevenueByBucket totals the fares and captured tips of the rides completed during the period,
+// per bucket of their completion date.
+func (db *Database) RevenueByBucket(ctx context.Context, q AnalyticsQuery) ([]types.RevenueBucket, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: completedDuring(q)}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   q.truncate("$completed_at"),
+			"rides": bson.M{"$sum": 1},
+			"fares": bson.M{"$sum": "$price.amount"},
+			"tips":  bson.M{"$sum": capturedTips},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":           0,
+			"start":         "$_id",
+			"rides":         1,
+			"fares":         moneyField("$fares"),
+			"tips":          moneyField("$tips"),
+			"average_price": moneyField(bson.M{"$divide": bson.A{"$fares", "$rides"}}),
+		}}},
+	}
+
+	buckets := []types.RevenueBucket{}
+	if err := db.aggregateRides(ctx, pipeline, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// CompletionByBucket counts how the rides requested during the period ended, per bucket of
+// their creation date.
+func (db *Database) CompletionByBucket(ctx context.Context, q AnalyticsQuery) ([]types.CompletionBucket, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": q.From, "$lt": q.To}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":             q.truncate("$created_at"),
+			"rides":           bson.M{"$sum": 1},
+			"completed":       countIf(types.StatusCompleted),
+			"cancelled":       countIf(types.StatusCancelled),
+			"no_driver_found": countIf(types.StatusNoDriverFound),
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$set", Value: bson.M{"start": "$_id"}}},
+	}
+
+	buckets := []types.CompletionBucket{}
+	if err := db.aggregateRides(ctx, pipeline, &buckets); err != nil {
+		return nil, err
+	}
+	for i := range buckets {
+		b := &buckets[i]
+		b.CompletionRate = ratio(float64(b.Completed), float64(b.Rides))
+		b.CancellationRate = ratio(float64(b.Cancelled), float64(b.Rides))
+	}
+	return buckets, nil
+}
+
+// DriverActivityByBucket measures, per bucket of completion date, how many drivers completed
+// rides during the period and how long they spent driving passengers. A ride's busy time runs
+// from its pickup, when the driver left the first stop or picked up the first pool passenger,
+// to its completion.
+func (db *Database) DriverActivityByBucket(ctx context.Context, q AnalyticsQuery) ([]types.DriverActivityBucket, error) {
+	match := completedDuring(q)
+	match["driver_id"] = bson.M{"$gt": ""}
+	pickedUp := bson.M{"$ifNull": bson.A{
+		bson.M{"$getField": bson.M{"field": "departed_at", "input": bson.M{"$arrayElemAt": bson.A{"$stops", 0}}}},
+		bson.M{"$min": "$passengers.picked_up_at"},
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$set", Value: bson.M{"picked_up_at": pickedUp}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"start": q.truncate("$completed_at"), "driver": "$driver_id"},
+			"rides": bson.M{"$sum": 1},
+			"busy_ms": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$type": "$picked_up_at"}, "date"}},
+				bson.M{"$subtract": bson.A{"$completed_at", "$picked_up_at"}},
+				0,
+			}}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":            "$_id.start",
+			"active_drivers": bson.M{"$sum": 1},
+			"rides":          bson.M{"$sum": "$rides"},
+			"busy_ms":        bson.M{"$sum": "$busy_ms"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":            0,
+			"start":          "$_id",
+			"active_drivers": 1,
+			"rides":          1,
+			"busy_minutes":   bson.M{"$divide": bson.A{"$busy_ms", 60000}},
+		}}},
+	}
+
+	buckets := []types.DriverActivityBucket{}
+	if err := db.aggregateRides(ctx, pipeline, &buckets); err != nil {
+		return nil, err
+	}
+	for i := range buckets {
+		b := &buckets[i]
+		b.BusyMinutes = math.Round(b.BusyMinutes*100) / 100
+		b.RidesPerDriver = ratio(float64(b.Rides), float64(b.ActiveDrivers))
+		bucketMinutes := q.duration(b.Start).Minutes() * float64(b.ActiveDrivers)
+		b.BusyShare = ratio(b.BusyMinutes, bucketMinutes)
+	}
+	return buckets, nil
+}
+
+func (db *Database) aggregateRides(ctx context.Context, pipeline mongo.Pipeline, results any) error {
+	cursor, err := db.ridesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, results)
+}
+
+// ratio divides a by b, rounded to 4 decimals; it is 0 when b is.
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return math.Round(a/b*10000) / 10000
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ensureCaptureIndexes makes a payment queued at most once, and indexes the jobs in the order
+// workers claim them and dead jobs in the order they are listed.
+func ensureCaptureIndexes(ctx context.Context, jobs, dead *mongo.Collection) error {
+	if err := ensureIndexes(ctx, jobs, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "payment_id", Value: 1}},
+			Options: options.Index().SetName("capture_payment").SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "available_at", Value: 1}},
+		},
+	}); err != nil {
+		return err
+	}
+	return ensureIndexes(ctx, dead, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "dead_at", Value: -1}},
+		},
+	})
+}
+
+// EnqueueCapture queues a payment for capture, unless it already is.
+func (db *Database) EnqueueCapture(ctx context.Context, job *types.CaptureJob) error {
+	_, err := db.captureJobsCollection.UpdateOne(
+		ctx,
+		bson.M{"payment_id": job.PaymentID},
+		bson.M{"$setOnInsert": job},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// ClaimCaptureJob leases the job due the longest to a worker until the lease expires, counting
+// an attempt. It returns nil when no job is due.
+func (db *Database) ClaimCaptureJob(ctx context.Context, now time.Time, lease time.Duration) (*types.CaptureJob, error) {
+	var job types.CaptureJob
+	err := db.captureJobsCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"available_at": bson.M{"$lte": now}},
+		bson.M{
+			"$set": bson.M{"available_at": now.Add(lease), "updated_at": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "available_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RetryCaptureJob schedules the next attempt of a claimed job. A job claimed again since, once
+// the lease expired, is left to its new worker.
+func (db *Database) RetryCaptureJob(ctx context.Context, job *types.CaptureJob, availableAt time.Time, lastError string) error {
+	_, err := db.captureJobsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": job.ID, "attempts": job.Attempts},
+		bson.M{"$set": bson.M{
+			"available_at": availableAt,
+			"last_error":   lastError,
+			"updated_at":   time.Now(),
+		}},
+	)
+	return err
+}
+
+// CompleteCaptureJob removes a claimed job whose payment was captured. A job claimed again
+// since, once the lease expired, is left to its new worker.
+func (db *Database) CompleteCaptureJob(ctx context.Context, job *types.CaptureJob) error {
+	_, err := db.captureJobsCollection.DeleteOne(ctx, bson.M{"_id": job.ID, "attempts": job.Attempts})
+	return err
+}
+
+// BuryCaptureJob moves a claimed job to the dead letters. The dead job keeps its ID, so a job
+// buried twice, after a failure between the two writes, is stored once. A job claimed again
+// since, once the lease expired, is left to its new worker.
+func (db *Database) BuryCaptureJob(ctx context.Context, job *types.CaptureJob, lastError string, now time.Time) error {
+	dead := *job
+	dead.LastError = lastError
+	dead.UpdatedAt = now
+	dead.DeadAt = &now
+
+	if _, err := db.deadCaptureJobsCollection.InsertOne(ctx, dead); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	res, err := db.captureJobsCollection.DeleteOne(ctx, bson.M{"_id": job.ID, "attempts": job.Attempts})
+	if err != nil || res.DeletedCount > 0 {
+		return err
+	}
+
+	// Nothing was deleted: either an earlier attempt to bury the job already did, or the job was
+	// claimed again and its dead copy must go.
+	queued, err := db.captureJobsCollection.CountDocuments(ctx, bson.M{"_id": job.ID}, options.Count().SetLimit(1))
+	if err != nil || queued == 0 {
+		return err
+	}
+	_, err = db.deadCaptureJobsCollection.DeleteOne(ctx, bson.M{"_id": job.ID, "attempts": job.Attempts})
+	return err
+}
+
+// RequeueDeadCaptureJob moves a dead job back to the queue, due now with its attempts reset. It
+// returns mongo.ErrNoDocuments when there is no such dead job.
+func (db *Database) RequeueDeadCaptureJob(ctx context.Context, id primitive.ObjectID, now time.Time) (*types.CaptureJob, error) {
+	var job types.CaptureJob
+	if err := db.deadCaptureJobsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&job); err != nil {
+		return nil, err
+	}
+	job.Attempts = 0
+	job.AvailableAt = now
+	job.UpdatedAt = now
+	job.DeadAt = nil
+
+	// A payment queued again meanwhile is already due for capture.
+	if _, err := db.captureJobsCollection.InsertOne(ctx, job); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+	if _, err := db.deadCaptureJobsCollection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CaptureQueued reports whether a payment is queued for capture.
+func (db *Database) CaptureQueued(ctx context.Context, paymentID string) (bool, error) {
+	n, err := db.captureJobsCollection.CountDocuments(ctx, bson.M{"payment_id": paymentID}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// ListCaptureJobs returns up to limit queued jobs, the next due first.
+func (db *Database) ListCaptureJobs(ctx context.Context, limit int) ([]types.CaptureJob, error) {
+	return listCaptureJobs(ctx, db.captureJobsCollection, bson.D{{Key: "available_at", Value: 1}}, limit)
+}
+
+// ListDeadCaptureJobs returns up to limit dead jobs, the latest buried first.
+func (db *Database) ListDeadCaptureJobs(ctx context.Context, limit int) ([]types.CaptureJob, error) {
+	return listCaptureJobs(ctx, db.deadCaptureJobsCollection, bson.D{{Key: "dead_at", Value: -1}}, limit)
+}
+
+func listCaptureJobs(ctx context.Context, coll *mongo.Collection, sort bson.D, limit int) ([]types.CaptureJob, error) {
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(sort).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []types.CaptureJob{}
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
@@ -2,8 +2,11 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"rides/internal/pricing"
 	"rides/internal/types"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,39 +16,224 @@ import (
 )
 
 type Database struct {
-	client          *mongo.Client
-	ridesCollection *mongo.Collection
+	client                    *mongo.Client
+	ridesCollection           *mongo.Collection
+	offersCollection          *mongo.Collection
+	ratingsCollection         *mongo.Collection
+	transactionsCollection    *mongo.Collection
+	statementsCollection      *mongo.Collection
+	promotionsCollection      *mongo.Collection
+	promotionUsagesCollection *mongo.Collection
+	reconciliationsCollection *mongo.Collection
+	captureJobsCollection     *mongo.Collection
+	deadCaptureJobsCollection *mongo.Collection
 }
 
+// InitMongoDB connects to the database of the service, then creates its indexes and migrates
+// the data stored by earlier versions.
 func InitMongoDB(mongoURI string) (*Database, error) {
+	d, err := Connect(mongoURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// Building an index scans its whole collection, so it is not bound by the connection timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), indexTimeout)
+	defer cancel()
+
+	if err := ensureRideIndexes(ctx, d.ridesCollection); err != nil {
+		return nil, err
+	}
+	if err := ensureOfferIndexes(ctx, d.offersCollection); err != nil {
+		return nil, err
+	}
+	if err := ensureRatingIndexes(ctx, d.ratingsCollection); err != nil {
+		return nil, err
+	}
+	if err := ensureLedgerIndexes(ctx, d.transactionsCollection, d.statementsCollection); err != nil {
+		return nil, err
+	}
+	if err := ensurePromotionIndexes(ctx, d.promotionsCollection, d.promotionUsagesCollection); err != nil {
+		return nil, err
+	}
+	if err := ensureCaptureIndexes(ctx, d.captureJobsCollection, d.deadCaptureJobsCollection); err != nil {
+		return nil, err
+	}
+
+	// Migrations rewrite whole collections, which takes far longer than connecting.
+	migrationCtx, cancelMigration := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancelMigration()
+	if err := migrateMoney(migrationCtx, d.ridesCollection); err != nil {
+		return nil, err
+	}
+
+	log.Println("✅ Connecté à MongoDB")
+	return d, nil
+}
+
+// Connect only connects to the database, for tools that read it while the service runs and
+// must neither change its indexes nor migrate its data.
+func Connect(mongoURI string) (*Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var err error
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
 	if err != nil {
 		return nil, err
 	}
-
-	err = client.Ping(ctx, nil)
-	if err != nil {
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
 
 	db := client.Database("ridenow_rides")
-	ridesCollection := db.Collection("rides")
-
-	log.Println("✅ Connecté à MongoDB")
 	return &Database{
-		client:          client,
-		ridesCollection: ridesCollection,
+		client:                    client,
+		ridesCollection:           db.Collection("rides"),
+		offersCollection:          db.Collection("ride_offers"),
+		ratingsCollection:         db.Collection("ratings"),
+		transactionsCollection:    db.Collection("ledger_transactions"),
+		statementsCollection:      db.Collection("payout_statements"),
+		promotionsCollection:      db.Collection("promotions"),
+		promotionUsagesCollection: db.Collection("promotion_usages"),
+		reconciliationsCollection: db.Collection("payment_reconciliations"),
+		captureJobsCollection:     db.Collection("capture_jobs"),
+		deadCaptureJobsCollection: db.Collection("capture_jobs_dead"),
 	}, nil
 }
 
+// Close disconnects from the database.
+func (db *Database) Close(ctx context.Context) error {
+	return db.client.Disconnect(ctx)
+}
+
+// migrationTimeout bounds the data migrations run at startup.
+const migrationTimeout = 10 * time.Minute
+
+const (
+	activePassengerIndex     = "active_passenger_ride"
+	activePoolPassengerIndex = "active_pool_passenger_ride"
+	activeDriverIndex        = "active_driver_ride"
+)
+
+// ensureRideIndexes creates the partial unique indexes that allow at most one
+// non-terminal ride per passenger and per driver, pooled rides included, and the indexes
+// of the dispatcher, ride history queries, exports and analytics.
+func ensureRideIndexes(ctx context.Context, rides *mongo.Collection) error {
+	active := bson.M{"status": bson.M{"$in": types.ActiveStatuses}}
+
+	return ensureIndexes(ctx, rides, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "passenger_id", Value: 1}},
+			Options: options.Index().
+				SetName(activePassengerIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(active),
+		},
+		{
+			Keys: bson.D{{Key: "passengers.passenger_id", Value: 1}},
+			Options: options.Index().
+				SetName(activePoolPassengerIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{
+					"status": bson.M{"$in": types.ActiveStatuses},
+					"mode":   types.ModePool,
+				}),
+		},
+		{
+			// Rides waiting for a driver have an empty driver_id and must not collide.
+			Keys: bson.D{{Key: "driver_id", Value: 1}},
+			Options: options.Index().
+				SetName(activeDriverIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{
+					"status":    bson.M{"$in": types.ActiveStatuses},
+					"driver_id": bson.M{"$gt": ""},
+				}),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "scheduled_at", Value: 1}},
+		},
+		// Ride history of a passenger, alone or in a pool.
+		{
+			Keys: bson.D{{Key: "passenger_id", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "passengers.passenger_id", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		// Ride exports and analytics, by creation date or, for completed rides, completion date.
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "completed_at", Value: 1}},
+		},
+	})
+}
+
+// ActiveRideError reports that a passenger or driver already holds a non-terminal ride.
+type ActiveRideError struct {
+	Field  string // "passenger" or "driver"
+	RideID primitive.ObjectID
+}
+
+func (e *ActiveRideError) Error() string {
+	return fmt.Sprintf("%s already has an active ride %s", e.Field, e.RideID.Hex())
+}
+
+// activeRideConflict turns a duplicate key error on one of the active ride indexes into an
+// *ActiveRideError pointing at the ride that holds the slot. Other errors are returned as is.
+func (db *Database) activeRideConflict(ctx context.Context, ride *types.Ride, err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	var existing *types.Ride
+	var field string
+	var lookupErr error
+	switch {
+	case strings.Contains(err.Error(), activePassengerIndex), strings.Contains(err.Error(), activePoolPassengerIndex):
+		field = "passenger"
+		existing, lookupErr = db.FindActiveRideByPassenger(ctx, ride.PassengerID)
+	case strings.Contains(err.Error(), activeDriverIndex):
+		field = "driver"
+		existing, lookupErr = db.FindActiveRideByDriver(ctx, ride.DriverID)
+	default:
+		return err
+	}
+	if lookupErr != nil {
+		return fmt.Errorf("%w (failed to find conflicting ride: %v)", err, lookupErr)
+	}
+
+	return &ActiveRideError{Field: field, RideID: existing.ID}
+}
+
+func (db *Database) FindActiveRideByPassenger(ctx context.Context, passengerID string) (*types.Ride, error) {
+	return db.findActiveRide(ctx, bson.M{"$or": bson.A{
+		bson.M{"passenger_id": passengerID},
+		bson.M{"passengers.passenger_id": passengerID},
+	}})
+}
+
+func (db *Database) FindActiveRideByDriver(ctx context.Context, driverID string) (*types.Ride, error) {
+	return db.findActiveRide(ctx, bson.M{"driver_id": driverID})
+}
+
+func (db *Database) findActiveRide(ctx context.Context, filter bson.M) (*types.Ride, error) {
+	filter["status"] = bson.M{"$in": types.ActiveStatuses}
+
+	var ride types.Ride
+	err := db.ridesCollection.FindOne(ctx, filter).Decode(&ride)
+	if err != nil {
+		return nil, err
+	}
+	return &ride, nil
+}
+
 func (db *Database) CreateRide(ctx context.Context, ride *types.Ride) (*primitive.ObjectID, error) {
 	res, err := db.ridesCollection.InsertOne(ctx, ride)
 	if err != nil {
-		return nil, err
+		return nil, db.activeRideConflict(ctx, ride, err)
 	}
 	id := res.InsertedID.(primitive.ObjectID)
 	ride.ID = id
@@ -62,17 +250,62 @@ func (db *Database) GetRideByID(ctx context.Context, id primitive.ObjectID) (*ty
 }
 
 func (db *Database) UpdateRideStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	now := time.Now()
+	set := bson.M{
+		"status":     status,
+		"updated_at": now,
+	}
+	if status == types.StatusCompleted {
+		set["completed_at"] = now
+	}
+
 	_, err := db.ridesCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": id},
-		bson.M{"$set": bson.M{
-			"status":     status,
-			"updated_at": time.Now(),
-		}},
+		bson.M{"$set": set},
 	)
+	if mongo.IsDuplicateKeyError(err) {
+		// Reactivating a terminal ride can collide with a newer active ride.
+		ride, getErr := db.GetRideByID(ctx, id)
+		if getErr != nil {
+			return err
+		}
+		return db.activeRideConflict(ctx, ride, err)
+	}
 	return err
 }
 
+// TransitionRideStatus moves the ride from one status to another. It reports false when the
+// ride was no longer in the expected status, and an *ActiveRideError when reactivating it
+// collides with a newer active ride of its passenger or driver.
+func (db *Database) TransitionRideStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+	now := time.Now()
+	set := bson.M{
+		"status":     to,
+		"updated_at": now,
+	}
+	if to == types.StatusCompleted {
+		set["completed_at"] = now
+	}
+
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": from},
+		bson.M{"$set": set},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		ride, getErr := db.GetRideByID(ctx, id)
+		if getErr != nil {
+			return false, err
+		}
+		return false, db.activeRideConflict(ctx, ride, err)
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
 func (db *Database) UpdateRidePaymentStatus(ctx context.Context, id primitive.ObjectID, paymentStatus string) error {
 	_, err := db.ridesCollection.UpdateOne(
 		ctx,
@@ -92,5 +325,147 @@ func (db *Database) UpdateRide(ctx context.Context, id primitive.ObjectID, ride
 		bson.M{"_id": id},
 		bson.M{"$set": ride},
 	)
-	return err
+	if err != nil {
+		return db.activeRideConflict(ctx, ride, err)
+	}
+	return nil
+}
+
+// UpdateStopStatus moves a stop of the ride from one status to another and records when it
+// happened. It reports false when the stop was no longer in the expected status.
+func (db *Database) UpdateStopStatus(ctx context.Context, id primitive.ObjectID, index int, from, to string, at time.Time) (bool, error) {
+	stop := fmt.Sprintf("stops.%d", index)
+	set := bson.M{
+		stop + ".status": to,
+		"updated_at":     time.Now(),
+	}
+	switch to {
+	case types.StopArrived:
+		set[stop+".arrived_at"] = at
+	case types.StopDeparted:
+		set[stop+".departed_at"] = at
+	}
+
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, stop + ".status": from},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// ReplaceStops sets a new route and fare on the ride, updated at now, provided it was not
+// modified since lastUpdate. It reports false when the ride changed in between.
+func (db *Database) ReplaceStops(ctx context.Context, id primitive.ObjectID, lastUpdate, now time.Time, stops []types.Stop, fare pricing.Breakdown) (bool, error) {
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "updated_at": lastUpdate},
+		bson.M{"$set": bson.M{
+			"stops":      stops,
+			"to_zone":    stops[len(stops)-1].Zone,
+			"price":      fare.Total,
+			"fare":       fare,
+			"updated_at": now,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// RestoreStops puts back the route and fare of ride, as they were before a ReplaceStops made
+// at lastUpdate. It reports false when the ride changed since.
+func (db *Database) RestoreStops(ctx context.Context, ride *types.Ride, lastUpdate time.Time) (bool, error) {
+	set := bson.M{
+		"stops":      ride.Stops,
+		"to_zone":    ride.ToZone,
+		"price":      ride.Price,
+		"updated_at": time.Now(),
+	}
+	update := bson.M{"$set": set}
+	if ride.Fare != nil {
+		set["fare"] = ride.Fare
+	} else {
+		// Rides booked before fares were itemized had none.
+		update["$unset"] = bson.M{"fare": ""}
+	}
+	res, err := db.ridesCollection.UpdateOne(ctx, bson.M{"_id": ride.ID, "updated_at": lastUpdate}, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// ClaimDueScheduledRide atomically moves the earliest SCHEDULED ride whose pickup is at or
+// before dueBy to DISPATCHING, so that a single dispatcher handles it. It returns
+// mongo.ErrNoDocuments when no ride is due.
+func (db *Database) ClaimDueScheduledRide(ctx context.Context, dueBy time.Time) (*types.Ride, error) {
+	var ride types.Ride
+	err := db.ridesCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"status":       types.StatusScheduled,
+			"scheduled_at": bson.M{"$lte": dueBy},
+		},
+		bson.M{"$set": bson.M{
+			"status":     types.StatusDispatching,
+			"updated_at": time.Now(),
+		}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "scheduled_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&ride)
+	if err != nil {
+		return nil, err
+	}
+	return &ride, nil
+}
+
+// ResetDispatchingRides puts rides left in DISPATCHING since before (e.g. by a crash or a failed
+// write mid-dispatch) back to SCHEDULED so they are picked up again.
+func (db *Database) ResetDispatchingRides(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.ridesCollection.UpdateMany(
+		ctx,
+		bson.M{
+			"status":     types.StatusDispatching,
+			"updated_at": bson.M{"$lt": before},
+		},
+		bson.M{"$set": bson.M{
+			"status":     types.StatusScheduled,
+			"updated_at": time.Now(),
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// ExpireScheduledRide gives up on the earliest SCHEDULED ride whose pickup was before the
+// given time, moving it to NO_DRIVER_FOUND so that it is no longer retried, and returns it. It
+// returns mongo.ErrNoDocuments when no ride is left to expire.
+func (db *Database) ExpireScheduledRide(ctx context.Context, before time.Time) (*types.Ride, error) {
+	var ride types.Ride
+	err := db.ridesCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"status":       types.StatusScheduled,
+			"scheduled_at": bson.M{"$lt": before},
+		},
+		bson.M{"$set": bson.M{
+			"status":     types.StatusNoDriverFound,
+			"updated_at": time.Now(),
+		}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "scheduled_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&ride)
+	if err != nil {
+		return nil, err
+	}
+	return &ride, nil
 }
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RideFilter selects the rides created in [From, To), narrowed down by the optional status,
+// mode, driver, passenger and zone. A passenger matches their rides alone or in a pool, a zone
+// the rides starting, stopping or ending in it.
+type RideFilter struct {
+	From        time.Time
+	To          time.Time
+	Statuses    []string
+	Mode        string
+	DriverID    string
+	PassengerID string
+	Zone        string
+}
+
+func (f RideFilter) bson() bson.M {
+	filter := bson.M{"created_at": bson.M{"$gte": f.From, "$lt": f.To}}
+	if len(f.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": f.Statuses}
+	}
+	if f.Mode != "" {
+		filter["mode"] = f.Mode
+	}
+	if f.DriverID != "" {
+		filter["driver_id"] = f.DriverID
+	}
+
+	var and bson.A
+	if f.PassengerID != "" {
+		and = append(and, passengerRidesFilter(f.PassengerID))
+	}
+	if f.Zone != "" {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"from_zone": f.Zone},
+			bson.M{"to_zone": f.Zone},
+			bson.M{"stops.zone": f.Zone},
+			bson.M{"passengers.from_zone": f.Zone},
+			bson.M{"passengers.to_zone": f.Zone},
+		}})
+	}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	return filter
+}
+
+// StreamRides calls fn with every ride matching the filter, oldest first, reading them from
+// the cursor a batch at a time so that large exports are never held in memory. It stops at the
+// first error returned by fn.
+func (db *Database) StreamRides(ctx context.Context, filter RideFilter, fn func(*types.Ride) error) error {
+	cursor, err := db.ridesCollection.Find(
+		ctx,
+		filter.bson(),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).SetBatchSize(500),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var ride types.Ride
+		if err := cursor.Decode(&ride); err != nil {
+			return err
+		}
+		if err := fn(&ride); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
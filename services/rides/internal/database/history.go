@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"rides/internal/money"
+	"rides/internal/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PassengerHistory totals a passenger's rides. Spent sums what they were charged for their
+// completed rides, their share on pooled rides, and the tips they gave.
+type PassengerHistory struct {
+	Rides     int         `bson:"rides"`
+	Completed int         `bson:"completed"`
+	Cancelled int         `bson:"cancelled"`
+	Spent     money.Money `bson:"spent"`
+	LastRide  *types.Ride `bson:"last_ride"`
+}
+
+// passengerRidesFilter matches the rides of a passenger, alone or in a pool.
+func passengerRidesFilter(passengerID string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"passenger_id": passengerID},
+		bson.M{"passengers.passenger_id": passengerID},
+	}}
+}
+
+// ListPassengerRides returns up to limit rides of the passenger, most recent first, created
+// before the ride whose ID is before, when set.
+func (db *Database) ListPassengerRides(ctx context.Context, passengerID string, before *primitive.ObjectID, limit int) ([]types.Ride, error) {
+	filter := passengerRidesFilter(passengerID)
+	if before != nil {
+		filter["_id"] = bson.M{"$lt": *before}
+	}
+
+	cursor, err := db.ridesCollection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rides := []types.Ride{}
+	if err = cursor.All(ctx, &rides); err != nil {
+		return nil, err
+	}
+	return rides, nil
+}
+
+// GetPassengerHistory totals the passenger's rides and returns the latest one.
+func (db *Database) GetPassengerHistory(ctx context.Context, passengerID string) (*PassengerHistory, error) {
+	ofPassenger := func(array string) bson.M {
+		return bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$" + array, bson.A{}}},
+			"cond":  bson.M{"$eq": bson.A{"$$this.passenger_id", passengerID}},
+		}}
+	}
+	charged := bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$mode", types.ModePool}},
+		bson.M{"$sum": bson.M{"$map": bson.M{"input": ofPassenger("passengers"), "in": "$$this.price.amount"}}},
+		"$price.amount",
+	}}
+	tipped := bson.M{"$sum": bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": ofPassenger("tips"),
+			"as":    "tip",
+			"cond":  bson.M{"$eq": bson.A{"$$tip.payment_status", "CAPTURED"}},
+		}},
+		"in": "$$this.amount.amount",
+	}}}
+	completed := bson.M{"$eq": bson.A{"$status", types.StatusCompleted}}
+
+	cursor, err := db.ridesCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: passengerRidesFilter(passengerID)}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       nil,
+			"rides":     bson.M{"$sum": 1},
+			"completed": bson.M{"$sum": bson.M{"$cond": bson.A{completed, 1, 0}}},
+			"cancelled": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", types.StatusCancelled}}, 1, 0}}},
+			"spent":     bson.M{"$sum": bson.M{"$cond": bson.A{completed, bson.M{"$add": bson.A{charged, tipped}}, 0}}},
+			"last_ride": bson.M{"$first": "$$ROOT"},
+		}}},
+		{{Key: "$set", Value: bson.M{"spent": bson.M{
+			"amount":   bson.M{"$toLong": "$spent"},
+			"currency": money.DefaultCurrency,
+		}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	history := &PassengerHistory{Spent: money.Cents(0)}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(history); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indexTimeout bounds the index builds run at startup, which scan whole collections.
+const indexTimeout = 5 * time.Minute
+
+// MongoDB error code for an index that exists with the same definition under another name.
+const indexOptionsConflict = 85
+
+// ensureIndexes creates the given indexes. A named index is built under its name suffixed
+// with a digest of its definition, so that a changed definition, e.g. after the set of active
+// statuses changed, is built under a new name before the earlier versions are dropped and the
+// collection is never left without it.
+//
+// Before a unique index is built, the documents that would violate it are looked up: when
+// there are some, they are reported and the index is left as it is, earlier version
+// included, instead of failing the startup.
+func ensureIndexes(ctx context.Context, coll *mongo.Collection, models []mongo.IndexModel) error {
+	existing, err := indexNames(ctx, coll)
+	if err != nil {
+		return fmt.Errorf("failed to list %s indexes: %w", coll.Name(), err)
+	}
+
+	for _, model := range models {
+		if model.Options == nil || model.Options.Name == nil {
+			if _, err := coll.Indexes().CreateOne(ctx, model); err != nil {
+				return fmt.Errorf("failed to create %s indexes: %w", coll.Name(), err)
+			}
+			continue
+		}
+
+		base := *model.Options.Name
+		name, err := versionedIndexName(base, model)
+		if err != nil {
+			return err
+		}
+		if existing[name] {
+			continue
+		}
+
+		if model.Options.Unique != nil && *model.Options.Unique {
+			duplicates, err := findDuplicates(ctx, coll, model)
+			if err != nil {
+				return fmt.Errorf("failed to check %s.%s for duplicates: %w", coll.Name(), base, err)
+			}
+			if len(duplicates) > 0 {
+				for _, d := range duplicates {
+					log.Printf("[ERROR] Index %s.%s: %v shared by %v", coll.Name(), base, d.Key, d.IDs)
+				}
+				log.Printf("[ERROR] Index %s.%s not built: resolve the duplicates above and restart the service", coll.Name(), base)
+				continue
+			}
+		}
+
+		opts := *model.Options
+		opts.Name = &name
+		model.Options = &opts
+		_, err = coll.Indexes().CreateOne(ctx, model)
+
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == indexOptionsConflict && hasVersionOf(existing, base) {
+			// The same definition is already built under the name an earlier version gave it.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create %s indexes: %w", coll.Name(), err)
+		}
+
+		for old := range existing {
+			if old == name || !isVersionOf(old, base) {
+				continue
+			}
+			log.Printf("[WARN] Dropping index %s.%s replaced by %s", coll.Name(), old, name)
+			if _, err := coll.Indexes().DropOne(ctx, old); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", old, err)
+			}
+		}
+	}
+	return nil
+}
+
+// indexNames returns the names of the indexes of the collection.
+func indexNames(ctx context.Context, coll *mongo.Collection) (map[string]bool, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var indexes []struct {
+		Name string `bson:"name"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(indexes))
+	for _, index := range indexes {
+		names[index.Name] = true
+	}
+	return names, nil
+}
+
+// versionedIndexName returns base suffixed with the first 8 hex digits of a digest of the keys,
+// uniqueness and partial filter of the index.
+func versionedIndexName(base string, model mongo.IndexModel) (string, error) {
+	definition := bson.D{
+		{Key: "key", Value: canonical(model.Keys)},
+		{Key: "unique", Value: model.Options.Unique != nil && *model.Options.Unique},
+		{Key: "partial", Value: canonical(model.Options.PartialFilterExpression)},
+	}
+	raw, err := bson.Marshal(definition)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode index %s: %w", base, err)
+	}
+	sum := sha256.Sum256(raw)
+	return base + "_" + hex.EncodeToString(sum[:4]), nil
+}
+
+// isVersionOf reports whether name is the index base, unversioned or under any digest.
+func isVersionOf(name, base string) bool {
+	if name == base {
+		return true
+	}
+	digest, ok := strings.CutPrefix(name, base+"_")
+	if !ok || len(digest) != 8 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+func hasVersionOf(names map[string]bool, base string) bool {
+	for name := range names {
+		if isVersionOf(name, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonical returns v with the keys of its maps sorted, so that it always encodes to the
+// same bytes.
+func canonical(v any) any {
+	switch v := v.(type) {
+	case bson.M:
+		return canonical(map[string]any(v))
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		d := make(bson.D, 0, len(v))
+		for _, key := range keys {
+			d = append(d, bson.E{Key: key, Value: canonical(v[key])})
+		}
+		return d
+	case bson.D:
+		d := make(bson.D, 0, len(v))
+		for _, e := range v {
+			d = append(d, bson.E{Key: e.Key, Value: canonical(e.Value)})
+		}
+		return d
+	case []string:
+		return v
+	case bson.A:
+		return canonical([]any(v))
+	case []any:
+		a := make(bson.A, 0, len(v))
+		for _, e := range v {
+			a = append(a, canonical(e))
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// duplicate is a key held by several documents.
+type duplicate struct {
+	Key bson.M `bson:"_id"`
+	IDs bson.A `bson:"ids"`
+}
+
+// maxReportedDuplicates bounds the duplicates reported for an index.
+const maxReportedDuplicates = 20
+
+// findDuplicates returns the keys of a unique index held by several documents matching its
+// partial filter. Keys in an array of subdocuments, like passengers.passenger_id, are looked
+// up in each element.
+func findDuplicates(ctx context.Context, coll *mongo.Collection, model mongo.IndexModel) ([]duplicate, error) {
+	keys, ok := model.Keys.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("unsupported index keys %T", model.Keys)
+	}
+
+	filter := model.Options.PartialFilterExpression
+	if filter == nil {
+		filter = bson.M{}
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter}}}
+
+	group := bson.M{}
+	unwound := map[string]bool{}
+	for _, key := range keys {
+		if i := strings.Index(key.Key, "."); i > 0 && !unwound[key.Key[:i]] {
+			unwound[key.Key[:i]] = true
+			pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: "$" + key.Key[:i]}})
+		}
+		group[strings.ReplaceAll(key.Key, ".", "_")] = "$" + key.Key
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{"_id": group, "ids": bson.M{"$addToSet": "$_id"}}}},
+		bson.D{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+		bson.D{{Key: "$limit", Value: maxReportedDuplicates}},
+	)
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var duplicates []duplicate
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func activeIndex(statuses ...string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{{Key: "passengers.passenger_id", Value: 1}},
+		Options: options.Index().
+			SetName(activePoolPassengerIndex).
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{
+				"status": bson.M{"$in": statuses},
+				"mode":   "POOL",
+			}),
+	}
+}
+
+func TestVersionedIndexNameIsStable(t *testing.T) {
+	first, err := versionedIndexName(activePoolPassengerIndex, activeIndex("ASSIGNED", "IN_PROGRESS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The partial filter is a map: its keys must not be encoded in iteration order.
+	for range 20 {
+		name, err := versionedIndexName(activePoolPassengerIndex, activeIndex("ASSIGNED", "IN_PROGRESS"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != first {
+			t.Fatalf("name of the same index changed from %s to %s", first, name)
+		}
+	}
+	if !isVersionOf(first, activePoolPassengerIndex) {
+		t.Errorf("%s is not a version of %s", first, activePoolPassengerIndex)
+	}
+}
+
+func TestVersionedIndexNameChangesWithDefinition(t *testing.T) {
+	before, _ := versionedIndexName(activePoolPassengerIndex, activeIndex("ASSIGNED", "IN_PROGRESS"))
+	after, _ := versionedIndexName(activePoolPassengerIndex, activeIndex("REQUESTED", "ASSIGNED", "IN_PROGRESS"))
+	if before == after {
+		t.Errorf("index got the same name %s after its partial filter changed", before)
+	}
+
+	nonUnique := activeIndex("ASSIGNED", "IN_PROGRESS")
+	nonUnique.Options.SetUnique(false)
+	if name, _ := versionedIndexName(activePoolPassengerIndex, nonUnique); name == before {
+		t.Errorf("index got the same name %s after it stopped being unique", name)
+	}
+}
+
+func TestIsVersionOf(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{activePassengerIndex, true},
+		{activePassengerIndex + "_0a1b2c3d", true},
+		{activePassengerIndex + "_0a1b2c3", false},
+		{activePassengerIndex + "_zzzzzzzz", false},
+		{activePoolPassengerIndex + "_0a1b2c3d", false},
+		{"passenger_id_1", false},
+	}
+	for _, tt := range tests {
+		if got := isVersionOf(tt.name, activePassengerIndex); got != tt.want {
+			t.Errorf("isVersionOf(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rides/internal/ledger"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrStatementExists = errors.New("statement already generated")
+
+// ensureLedgerIndexes posts each transaction once per reference and generates one statement
+// per driver and week.
+func ensureLedgerIndexes(ctx context.Context, transactions, statements *mongo.Collection) error {
+	err := ensureIndexes(ctx, transactions, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "reference", Value: 1}},
+			Options: options.Index().SetName("one_transaction_per_reference").SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "driver_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "postings.account", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return ensureIndexes(ctx, statements, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "driver_id", Value: 1}, {Key: "period_start", Value: -1}},
+			Options: options.Index().SetName("one_statement_per_week").SetUnique(true),
+		},
+	})
+}
+
+// PostTransaction records a balanced transaction in the ledger. Posting a transaction whose
+// reference was already posted for the same kind is a no-op.
+func (db *Database) PostTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := ledger.Validate(tx); err != nil {
+		return fmt.Errorf("%s %s: %w", tx.Kind, tx.Reference, err)
+	}
+	res, err := db.transactionsCollection.InsertOne(ctx, tx)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tx.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListTransactions returns the driver's transactions posted in [from, to), most recent first.
+func (db *Database) ListTransactions(ctx context.Context, driverID string, from, to time.Time) ([]types.Transaction, error) {
+	cursor, err := db.transactionsCollection.Find(
+		ctx,
+		bson.M{
+			"driver_id":  driverID,
+			"created_at": bson.M{"$gte": from, "$lt": to},
+		},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []types.Transaction{}
+	if err = cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// ListEarningDrivers returns the drivers who earned something in [from, to).
+func (db *Database) ListEarningDrivers(ctx context.Context, from, to time.Time) ([]string, error) {
+	values, err := db.transactionsCollection.Distinct(ctx, "driver_id", bson.M{
+		"kind":       bson.M{"$ne": types.TransactionPayout},
+		"created_at": bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	drivers := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok && id != "" {
+			drivers = append(drivers, id)
+		}
+	}
+	return drivers, nil
+}
+
+// CreateStatement stores a payout statement, or returns ErrStatementExists when the driver's
+// statement for that week was already generated.
+func (db *Database) CreateStatement(ctx context.Context, statement *types.Statement) error {
+	res, err := db.statementsCollection.InsertOne(ctx, statement)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrStatementExists
+	}
+	if err != nil {
+		return err
+	}
+	statement.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetPreviousStatement returns the driver's latest statement for a week starting before the
+// given time, or mongo.ErrNoDocuments.
+func (db *Database) GetPreviousStatement(ctx context.Context, driverID string, before time.Time) (*types.Statement, error) {
+	var statement types.Statement
+	err := db.statementsCollection.FindOne(
+		ctx,
+		bson.M{"driver_id": driverID, "period_start": bson.M{"$lt": before}},
+		options.FindOne().SetSort(bson.D{{Key: "period_start", Value: -1}}),
+	).Decode(&statement)
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// ListStatements returns the driver's payout statements, most recent first.
+func (db *Database) ListStatements(ctx context.Context, driverID string) ([]types.Statement, error) {
+	cursor, err := db.statementsCollection.Find(
+		ctx,
+		bson.M{"driver_id": driverID},
+		options.Find().SetSort(bson.D{{Key: "period_start", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	statements := []types.Statement{}
+	if err = cursor.All(ctx, &statements); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
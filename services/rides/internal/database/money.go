@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rides/internal/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// legacyAmount matches amounts still stored as plain numbers of major units.
+var legacyAmount = bson.M{"$type": bson.A{"double", "int", "long", "decimal"}}
+
+// moneyExpr converts a legacy amount expression to a {amount, currency} document in cents.
+func moneyExpr(expr string) bson.M {
+	return bson.M{
+		"amount":   roundCents(bson.M{"$multiply": bson.A{expr, 100}}),
+		"currency": money.DefaultCurrency,
+	}
+}
+
+// roundCents rounds an expression in cents to a whole number of cents half away from zero, as
+// money.FromFloat does; $round would round half to even.
+func roundCents(cents any) bson.M {
+	return bson.M{"$toLong": bson.M{"$let": bson.M{
+		"vars": bson.M{"cents": cents},
+		"in": bson.M{"$trunc": bson.A{bson.M{"$add": bson.A{
+			"$$cents",
+			bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$$cents", 0}}, -0.5, 0.5}},
+		}}, 0}},
+	}}}
+}
+
+// mapMoney converts the amount field of every element of a legacy array.
+func mapMoney(array, field string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$isArray": "$" + array},
+		bson.M{"$map": bson.M{
+			"input": "$" + array,
+			"as":    "item",
+			"in": bson.M{"$mergeObjects": bson.A{
+				"$$item",
+				bson.M{field: bson.M{"$cond": bson.A{
+					bson.M{"$isNumber": "$$item." + field},
+					moneyExpr("$$item." + field),
+					"$$item." + field,
+				}}},
+			}},
+		}},
+		"$$REMOVE",
+	}}
+}
+
+// migrateMoney rewrites the amounts stored as floating point numbers before money.Money, in
+// the default currency.
+func migrateMoney(ctx context.Context, rides *mongo.Collection) error {
+	res, err := rides.UpdateMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"price": legacyAmount},
+		bson.M{"passengers.price": legacyAmount},
+		bson.M{"tips.amount": legacyAmount},
+	}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"price": bson.M{"$cond": bson.A{
+				bson.M{"$isNumber": "$price"},
+				moneyExpr("$price"),
+				"$price",
+			}},
+			"currency":   bson.M{"$ifNull": bson.A{"$currency", money.DefaultCurrency}},
+			"passengers": mapMoney("passengers", "price"),
+			"tips":       mapMoney("tips", "amount"),
+		}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate ride amounts: %w", err)
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("[MIGRATION] %d course(s) convertie(s) en centimes", res.ModifiedCount)
+	}
+	return nil
+}
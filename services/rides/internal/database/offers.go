@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"rides/internal/types"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	pendingRideOfferIndex   = "pending_ride_offer"
+	pendingDriverOfferIndex = "pending_driver_offer"
+)
+
+var (
+	// ErrRideAlreadyOffered means the ride already has a pending offer.
+	ErrRideAlreadyOffered = errors.New("ride already has a pending offer")
+	// ErrDriverBusy means the driver already has a pending offer for another ride.
+	ErrDriverBusy = errors.New("driver already has a pending offer")
+)
+
+// ensureOfferIndexes allows a single pending offer per ride and per driver.
+func ensureOfferIndexes(ctx context.Context, offers *mongo.Collection) error {
+	pending := bson.M{"status": types.OfferPending}
+
+	return ensureIndexes(ctx, offers, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "ride_id", Value: 1}},
+			Options: options.Index().
+				SetName(pendingRideOfferIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(pending),
+		},
+		{
+			Keys: bson.D{{Key: "driver_id", Value: 1}},
+			Options: options.Index().
+				SetName(pendingDriverOfferIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(pending),
+		},
+		{
+			Keys: bson.D{{Key: "ride_id", Value: 1}, {Key: "offered_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+		},
+	})
+}
+
+func (db *Database) CreateOffer(ctx context.Context, offer *types.Offer) error {
+	res, err := db.offersCollection.InsertOne(ctx, offer)
+	if mongo.IsDuplicateKeyError(err) {
+		if strings.Contains(err.Error(), pendingDriverOfferIndex) {
+			return ErrDriverBusy
+		}
+		return ErrRideAlreadyOffered
+	}
+	if err != nil {
+		return err
+	}
+	offer.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (db *Database) GetOfferByID(ctx context.Context, id primitive.ObjectID) (*types.Offer, error) {
+	var offer types.Offer
+	err := db.offersCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&offer)
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// RespondToOffer records the driver's answer to a pending offer that has not expired yet. It
+// returns mongo.ErrNoDocuments when there is no such offer.
+func (db *Database) RespondToOffer(ctx context.Context, id primitive.ObjectID, driverID, status, reason string, at time.Time) (*types.Offer, error) {
+	set := bson.M{
+		"status":       status,
+		"responded_at": at,
+	}
+	if reason != "" {
+		set["decline_reason"] = reason
+	}
+
+	var offer types.Offer
+	err := db.offersCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id":        id,
+			"driver_id":  driverID,
+			"status":     types.OfferPending,
+			"expires_at": bson.M{"$gt": at},
+		},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&offer)
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// ExpireNextOffer marks one pending offer whose deadline has passed as EXPIRED and returns it,
+// or mongo.ErrNoDocuments when none is overdue.
+func (db *Database) ExpireNextOffer(ctx context.Context, now time.Time) (*types.Offer, error) {
+	var offer types.Offer
+	err := db.offersCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"status":     types.OfferPending,
+			"expires_at": bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"status": types.OfferExpired}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "expires_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&offer)
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// CancelPendingOffers withdraws the ride's pending offer, if any.
+func (db *Database) CancelPendingOffers(ctx context.Context, rideID primitive.ObjectID, at time.Time) error {
+	_, err := db.offersCollection.UpdateMany(
+		ctx,
+		bson.M{"ride_id": rideID, "status": types.OfferPending},
+		bson.M{"$set": bson.M{
+			"status":       types.OfferCancelled,
+			"responded_at": at,
+		}},
+	)
+	return err
+}
+
+// ListOffersByRide returns every offer made for the ride, in the order they were made.
+func (db *Database) ListOffersByRide(ctx context.Context, rideID primitive.ObjectID) ([]types.Offer, error) {
+	return db.findOffers(ctx, bson.M{"ride_id": rideID})
+}
+
+// ListOffersByDriver returns the offers made to the driver, optionally filtered by status.
+func (db *Database) ListOffersByDriver(ctx context.Context, driverID, status string) ([]types.Offer, error) {
+	filter := bson.M{"driver_id": driverID}
+	if status != "" {
+		filter["status"] = status
+	}
+	return db.findOffers(ctx, filter)
+}
+
+func (db *Database) findOffers(ctx context.Context, filter bson.M) ([]types.Offer, error) {
+	cursor, err := db.offersCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "offered_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	offers := []types.Offer{}
+	if err = cursor.All(ctx, &offers); err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+// AssignDriver sets the driver and payment of a REQUESTED ride and moves it to ASSIGNED. It
+// reports false when the ride was no longer waiting for a driver. Pool passengers' payments
+// are recorded separately with SetPoolPassengerPayment.
+func (db *Database) AssignDriver(ctx context.Context, ride *types.Ride) (bool, error) {
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": ride.ID, "status": types.StatusRequested},
+		bson.M{"$set": bson.M{
+			"driver_id":      ride.DriverID,
+			"payment_id":     ride.PaymentID,
+			"status":         types.StatusAssigned,
+			"payment_status": ride.PaymentStatus,
+			"updated_at":     time.Now(),
+		}},
+	)
+	if err != nil {
+		return false, db.activeRideConflict(ctx, ride, err)
+	}
+	return res.MatchedCount == 1, nil
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"rides/internal/types"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// seatsLeft matches pooled rides holding fewer than seats passengers.
+func seatsLeft(seats int) bson.M {
+	return bson.M{fmt.Sprintf("passengers.%d", seats-1): bson.M{"$exists": false}}
+}
+
+// FindOpenPools returns the active pooled rides created since the given time that still have
+// a free seat, oldest first.
+func (db *Database) FindOpenPools(ctx context.Context, since time.Time, seats int) ([]types.Ride, error) {
+	filter := seatsLeft(seats)
+	filter["mode"] = types.ModePool
+	filter["status"] = bson.M{"$in": types.ActiveStatuses}
+	filter["created_at"] = bson.M{"$gte": since}
+
+	cursor, err := db.ridesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rides []types.Ride
+	if err = cursor.All(ctx, &rides); err != nil {
+		return nil, err
+	}
+	return rides, nil
+}
+
+// JoinPool adds a passenger to a pooled ride if it is still active, has a free seat and does
+// not already carry them. It reports false when the ride could not be joined.
+func (db *Database) JoinPool(ctx context.Context, id primitive.ObjectID, passenger types.RidePassenger, seats int) (bool, error) {
+	filter := seatsLeft(seats)
+	filter["_id"] = id
+	filter["mode"] = types.ModePool
+	filter["status"] = bson.M{"$in": types.ActiveStatuses}
+	filter["passengers.passenger_id"] = bson.M{"$ne": passenger.PassengerID}
+
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{
+			"$push": bson.M{"passengers": passenger},
+			"$inc":  bson.M{"price.amount": passenger.Price.Amount},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return false, db.activeRideConflict(ctx, &types.Ride{PassengerID: passenger.PassengerID}, err)
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// LeavePool removes a passenger who is still waiting to be picked up from a pooled ride, along
+// with their fare. The last passenger cannot leave, the ride has to be cancelled instead; when
+// the passenger who opened the pool leaves, the next one takes the ride over. It reports false
+// when the passenger could not leave.
+func (db *Database) LeavePool(ctx context.Context, ride *types.Ride, passenger types.RidePassenger) (bool, error) {
+	filter := bson.M{
+		"_id":          ride.ID,
+		"passengers.1": bson.M{"$exists": true},
+		"passengers": bson.M{"$elemMatch": bson.M{
+			"passenger_id": passenger.PassengerID,
+			"status":       types.PassengerWaiting,
+		}},
+	}
+	set := bson.M{"updated_at": time.Now()}
+	if passenger.PassengerID == ride.PassengerID {
+		next := slices.IndexFunc(ride.Passengers, func(p types.RidePassenger) bool {
+			return p.PassengerID != passenger.PassengerID
+		})
+		if next < 0 {
+			return false, nil
+		}
+		filter["passenger_id"] = passenger.PassengerID
+		filter["passengers.passenger_id"] = ride.Passengers[next].PassengerID
+		set["passenger_id"] = ride.Passengers[next].PassengerID
+	}
+
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{
+			"$pull": bson.M{"passengers": bson.M{"passenger_id": passenger.PassengerID}},
+			"$inc":  bson.M{"price.amount": -passenger.Price.Amount},
+			"$set":  set,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func (db *Database) SetPoolPassengerPayment(ctx context.Context, id primitive.ObjectID, passengerID, paymentID, paymentStatus string) error {
+	set := bson.M{
+		"passengers.$.payment_status": paymentStatus,
+		"updated_at":                  time.Now(),
+	}
+	if paymentID != "" {
+		set["passengers.$.payment_id"] = paymentID
+	}
+
+	_, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "passengers.passenger_id": passengerID},
+		bson.M{"$set": set},
+	)
+	return err
+}
+
+// UpdatePoolPassengerStatus moves a pooled passenger from one status to another and records
+// when it happened. It reports false when the passenger was no longer in the expected status
+// or the ride no longer in one of rideStatuses.
+func (db *Database) UpdatePoolPassengerStatus(ctx context.Context, id primitive.ObjectID, rideStatuses []string, passengerID, from, to string, at time.Time) (bool, error) {
+	set := bson.M{
+		"passengers.$.status": to,
+		"updated_at":          time.Now(),
+	}
+	switch to {
+	case types.PassengerPickedUp:
+		set["passengers.$.picked_up_at"] = at
+	case types.PassengerDroppedOff:
+		set["passengers.$.dropped_off_at"] = at
+	}
+
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"_id":        id,
+			"status":     bson.M{"$in": rideStatuses},
+			"passengers": bson.M{"$elemMatch": bson.M{"passenger_id": passengerID, "status": from}},
+		},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
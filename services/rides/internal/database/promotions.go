@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrPromotionExists       = errors.New("promotion code already exists")
+	ErrPromotionLimitReached = errors.New("promotion usage limit reached")
+)
+
+// ensurePromotionIndexes makes promo codes unique and keeps one usage counter per code and
+// passenger.
+func ensurePromotionIndexes(ctx context.Context, promotions, usages *mongo.Collection) error {
+	err := ensureIndexes(ctx, promotions, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetName("unique_promotion_code").SetUnique(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return ensureIndexes(ctx, usages, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}, {Key: "passenger_id", Value: 1}},
+			Options: options.Index().SetName("one_usage_per_passenger").SetUnique(true),
+		},
+	})
+}
+
+func (db *Database) CreatePromotion(ctx context.Context, promotion *types.Promotion) error {
+	res, err := db.promotionsCollection.InsertOne(ctx, promotion)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPromotionExists
+	}
+	if err != nil {
+		return err
+	}
+	promotion.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (db *Database) GetPromotionByCode(ctx context.Context, code string) (*types.Promotion, error) {
+	var promotion types.Promotion
+	err := db.promotionsCollection.FindOne(ctx, bson.M{"code": code}).Decode(&promotion)
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// ListPromotions returns every promotion, most recent first.
+func (db *Database) ListPromotions(ctx context.Context) ([]types.Promotion, error) {
+	cursor, err := db.promotionsCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	promotions := []types.Promotion{}
+	if err = cursor.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// RedeemPromotion records one use of the promotion by the passenger at the given time. Both
+// limits are checked and counted atomically, so concurrent bookings cannot overspend the
+// code; it returns ErrPromotionLimitReached when either limit is reached, and
+// mongo.ErrNoDocuments when the code does not exist or is outside its validity window.
+func (db *Database) RedeemPromotion(ctx context.Context, promotion *types.Promotion, passengerID string, at time.Time) error {
+	// The passenger's counter is upserted only while under the limit; past it, the upsert
+	// collides with the existing counter on the unique index.
+	usage := bson.M{"code": promotion.Code, "passenger_id": passengerID}
+	if promotion.MaxPerPassenger > 0 {
+		usage["count"] = bson.M{"$lt": promotion.MaxPerPassenger}
+	}
+	_, err := db.promotionUsagesCollection.UpdateOne(
+		ctx,
+		usage,
+		bson.M{"$inc": bson.M{"count": 1}, "$set": bson.M{"updated_at": at}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPromotionLimitReached
+	}
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"code": promotion.Code,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"starts_at": bson.M{"$exists": false}}, bson.M{"starts_at": bson.M{"$lte": at}}}},
+			bson.M{"$or": bson.A{bson.M{"ends_at": bson.M{"$exists": false}}, bson.M{"ends_at": bson.M{"$gt": at}}}},
+		},
+	}
+	if promotion.MaxRedemptions > 0 {
+		filter["redemptions"] = bson.M{"$lt": promotion.MaxRedemptions}
+	}
+	res, err := db.promotionsCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"redemptions": 1}})
+	if err == nil && res.MatchedCount == 1 {
+		return nil
+	}
+
+	// The global limit was reached or the code just expired: give the passenger's use back.
+	if _, undoErr := db.promotionUsagesCollection.UpdateOne(ctx,
+		bson.M{"code": promotion.Code, "passenger_id": passengerID},
+		bson.M{"$inc": bson.M{"count": -1}},
+	); undoErr != nil && err == nil {
+		err = undoErr
+	}
+	if err != nil {
+		return err
+	}
+	if !promotion.ActiveAt(at) {
+		return mongo.ErrNoDocuments
+	}
+	return ErrPromotionLimitReached
+}
+
+// ReleasePromotion gives back a use of the promotion by the passenger, when the ride it was
+// redeemed for could not be booked.
+func (db *Database) ReleasePromotion(ctx context.Context, code, passengerID string) error {
+	_, err := db.promotionsCollection.UpdateOne(ctx,
+		bson.M{"code": code, "redemptions": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"redemptions": -1}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = db.promotionUsagesCollection.UpdateOne(ctx,
+		bson.M{"code": code, "passenger_id": passengerID, "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}},
+	)
+	return err
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAlreadyRated means the rater already rated that participant for the ride.
+var ErrAlreadyRated = errors.New("already rated")
+
+// ensureRatingIndexes allows a single rating per ride, rater and ratee, and indexes the ratings
+// not applied to the averages yet.
+func ensureRatingIndexes(ctx context.Context, ratings *mongo.Collection) error {
+	return ensureIndexes(ctx, ratings, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "ride_id", Value: 1},
+				{Key: "rater_id", Value: 1},
+				{Key: "ratee_id", Value: 1},
+			},
+			Options: options.Index().SetName("one_rating_per_ride").SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().
+				SetName("unapplied_ratings").
+				SetPartialFilterExpression(bson.M{"applied": false}),
+		},
+	})
+}
+
+func (db *Database) CreateRating(ctx context.Context, rating *types.Rating) error {
+	res, err := db.ratingsCollection.InsertOne(ctx, rating)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyRated
+	}
+	if err != nil {
+		return err
+	}
+	rating.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (db *Database) ListRatingsByRide(ctx context.Context, rideID primitive.ObjectID) ([]types.Rating, error) {
+	cursor, err := db.ratingsCollection.Find(ctx, bson.M{"ride_id": rideID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ratings := []types.Rating{}
+	if err = cursor.All(ctx, &ratings); err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+// MarkRatingApplied records that the rating was added to the ratee's average.
+func (db *Database) MarkRatingApplied(ctx context.Context, id primitive.ObjectID) error {
+	_, err := db.ratingsCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"applied": true}})
+	return err
+}
+
+// ListUnappliedRatings returns, oldest first, at most limit ratings created before
+// createdBefore that were not added to the ratee's average yet. Ratings recorded before the
+// applied flag existed have none and are not returned.
+func (db *Database) ListUnappliedRatings(ctx context.Context, createdBefore time.Time, limit int) ([]types.Rating, error) {
+	cursor, err := db.ratingsCollection.Find(
+		ctx,
+		bson.M{"applied": false, "created_at": bson.M{"$lt": createdBefore}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ratings := []types.Rating{}
+	if err = cursor.All(ctx, &ratings); err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListUnsettledRides returns up to limit rides completed before the given time whose fare, or
+// one of whose tips, is not recorded as captured, oldest first, starting after the cursor if
+// any.
+func (db *Database) ListUnsettledRides(ctx context.Context, completedBefore time.Time, after *types.RideCursor, limit int) ([]types.Ride, error) {
+	filter := bson.M{
+		"status":       types.StatusCompleted,
+		"completed_at": bson.M{"$lt": completedBefore},
+		"$or": bson.A{
+			bson.M{"payment_status": bson.M{"$ne": "CAPTURED"}},
+			bson.M{"tips": bson.M{"$elemMatch": bson.M{"payment_status": bson.M{"$ne": "CAPTURED"}}}},
+		},
+	}
+	if after != nil {
+		filter["$and"] = bson.A{bson.M{"$or": bson.A{
+			bson.M{"completed_at": bson.M{"$gt": after.CompletedAt}},
+			bson.M{"completed_at": after.CompletedAt, "_id": bson.M{"$gt": after.RideID}},
+		}}}
+	}
+
+	cursor, err := db.ridesCollection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "completed_at", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rides := []types.Ride{}
+	if err = cursor.All(ctx, &rides); err != nil {
+		return nil, err
+	}
+	return rides, nil
+}
+
+func (db *Database) CreateReconciliationReport(ctx context.Context, report *types.ReconciliationReport) error {
+	res, err := db.reconciliationsCollection.InsertOne(ctx, report)
+	if err != nil {
+		return err
+	}
+	report.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListReconciliationReports returns the latest reconciliation reports, most recent first.
+func (db *Database) ListReconciliationReports(ctx context.Context, limit int) ([]types.ReconciliationReport, error) {
+	cursor, err := db.reconciliationsCollection.Find(
+		ctx,
+		bson.M{},
+		options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	reports := []types.ReconciliationReport{}
+	if err = cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddTip records a pending tip on a completed ride, unless the passenger already tipped it.
+// It reports false when the tip could not be added.
+func (db *Database) AddTip(ctx context.Context, id primitive.ObjectID, tip types.Tip) (bool, error) {
+	res, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"_id":               id,
+			"status":            types.StatusCompleted,
+			"tips.passenger_id": bson.M{"$ne": tip.PassengerID},
+		},
+		bson.M{
+			"$push": bson.M{"tips": tip},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func (db *Database) SetTipPayment(ctx context.Context, id primitive.ObjectID, passengerID, paymentID, paymentStatus string) error {
+	_, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "tips.passenger_id": passengerID},
+		bson.M{"$set": bson.M{
+			"tips.$.payment_id":     paymentID,
+			"tips.$.payment_status": paymentStatus,
+			"updated_at":            time.Now(),
+		}},
+	)
+	return err
+}
+
+// RemoveTip drops a passenger's tip whose payment failed, so that they can tip again.
+func (db *Database) RemoveTip(ctx context.Context, id primitive.ObjectID, passengerID string) error {
+	_, err := db.ridesCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$pull": bson.M{"tips": bson.M{"passenger_id": passengerID}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	return err
+}
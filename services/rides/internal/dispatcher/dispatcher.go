@@ -0,0 +1,327 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"rides/internal/clock"
+	"rides/internal/services"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNoDriverAvailable    = errors.New("no available driver")
+	ErrPaymentAuthorization = errors.New("payment authorization failed")
+)
+
+type Config struct {
+	// LeadTime is how long before pickup a scheduled ride is dispatched.
+	LeadTime time.Duration
+	// SearchRadius is how far from the pickup point, in meters, drivers are looked for.
+	SearchRadius float64
+	// OfferTimeout is how long a driver has to accept an offer before it goes to the next one.
+	OfferTimeout time.Duration
+	// MaxOffers bounds the number of drivers a ride is offered to before giving up.
+	MaxOffers int
+	// MinDriverRating excludes drivers rated below it; drivers not rated yet are kept. Zero
+	// disables the filter.
+	MinDriverRating float64
+	// StuckAfter is how long a scheduled ride may stay DISPATCHING before it is considered
+	// abandoned and put back to SCHEDULED.
+	StuckAfter time.Duration
+	// ExpireAfter is how long past its pickup time a scheduled ride no driver could be offered
+	// is retried before it is given up as NO_DRIVER_FOUND.
+	ExpireAfter time.Duration
+}
+
+// Store holds the rides and offers the dispatcher works on. It is implemented by
+// *database.Database.
+type Store interface {
+	GetRideByID(ctx context.Context, id primitive.ObjectID) (*types.Ride, error)
+	FindActiveRideByDriver(ctx context.Context, driverID string) (*types.Ride, error)
+	ClaimDueScheduledRide(ctx context.Context, dueBy time.Time) (*types.Ride, error)
+	ResetDispatchingRides(ctx context.Context, before time.Time) (int64, error)
+	ExpireScheduledRide(ctx context.Context, before time.Time) (*types.Ride, error)
+	TransitionRideStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error)
+	UpdateRidePaymentStatus(ctx context.Context, id primitive.ObjectID, paymentStatus string) error
+	SetPoolPassengerPayment(ctx context.Context, id primitive.ObjectID, passengerID, paymentID, paymentStatus string) error
+	AssignDriver(ctx context.Context, ride *types.Ride) (bool, error)
+	ReleasePromotion(ctx context.Context, code, passengerID string) error
+	CreateOffer(ctx context.Context, offer *types.Offer) error
+	GetOfferByID(ctx context.Context, id primitive.ObjectID) (*types.Offer, error)
+	RespondToOffer(ctx context.Context, id primitive.ObjectID, driverID, status, reason string, at time.Time) (*types.Offer, error)
+	ExpireNextOffer(ctx context.Context, now time.Time) (*types.Offer, error)
+	ListOffersByRide(ctx context.Context, rideID primitive.ObjectID) ([]types.Offer, error)
+}
+
+// Dispatcher offers rides to the closest available drivers, one at a time, either immediately
+// or, for scheduled rides, LeadTime before pickup. A ride is ASSIGNED once a driver accepts.
+type Dispatcher struct {
+	db             Store
+	userService    *services.UserService
+	paymentService *services.PaymentService
+	clock          clock.Clock
+	config         Config
+}
+
+func NewDispatcher(db Store, userService *services.UserService, paymentService *services.PaymentService, clk clock.Clock, config Config) *Dispatcher {
+	return &Dispatcher{
+		db:             db,
+		userService:    userService,
+		paymentService: paymentService,
+		clock:          clk,
+		config:         config,
+	}
+}
+
+// authorize authorizes the ride's fare, or each passenger's fare on a pooled ride, and returns
+// the IDs of the payments it authorized. When an authorization fails, the payments authorized
+// before it are returned along with the error.
+func (d *Dispatcher) authorize(ride *types.Ride) ([]string, error) {
+	if ride.Mode != types.ModePool {
+		paymentID, err := d.paymentService.AuthorizePayment(ride.ID.Hex(), ride.Price)
+		if err != nil {
+			return nil, err
+		}
+		ride.PaymentID = paymentID
+		ride.PaymentStatus = "PENDING"
+		return []string{paymentID}, nil
+	}
+
+	// Passengers who joined the pool while it was waiting for a driver are already authorized.
+	var authorized []string
+	for i, p := range ride.Passengers {
+		if p.PaymentID != "" {
+			continue
+		}
+		paymentID, err := d.paymentService.AuthorizePayment(ride.ID.Hex(), p.Price)
+		if err != nil {
+			return authorized, fmt.Errorf("passenger %s: %w", p.PassengerID, err)
+		}
+		ride.Passengers[i].PaymentID = paymentID
+		ride.Passengers[i].PaymentStatus = "PENDING"
+		authorized = append(authorized, paymentID)
+	}
+	ride.PaymentStatus = "PENDING"
+	return authorized, nil
+}
+
+// voidAuthorized voids payments authorize returned for a ride that could not be assigned.
+func (d *Dispatcher) voidAuthorized(ride *types.Ride, paymentIDs []string) {
+	for _, paymentID := range paymentIDs {
+		if !d.VoidPayment(paymentID, "PENDING") {
+			continue
+		}
+		if ride.PaymentID == paymentID {
+			ride.PaymentStatus = "VOIDED"
+		}
+		for i := range ride.Passengers {
+			if ride.Passengers[i].PaymentID == paymentID {
+				ride.Passengers[i].PaymentStatus = "VOIDED"
+			}
+		}
+	}
+}
+
+// ReleaseDriver makes a claimed driver available again.
+func (d *Dispatcher) ReleaseDriver(driverID string) {
+	if err := d.userService.UpdateDriverStatus(driverID, true); err != nil {
+		log.Printf("[WARN] Failed to update driver status: %v", err)
+	}
+}
+
+// ReleasePayments voids the payments of a ride that will not be captured because it was
+// cancelled or given up. Pooled passengers already dropped off keep their payment, which was
+// queued for capture.
+func (d *Dispatcher) ReleasePayments(ctx context.Context, ride *types.Ride) {
+	if ride.Mode != types.ModePool {
+		if d.VoidPayment(ride.PaymentID, ride.PaymentStatus) {
+			if err := d.db.UpdateRidePaymentStatus(ctx, ride.ID, "VOIDED"); err != nil {
+				log.Printf("[ERROR] Failed to update payment status: %v", err)
+			}
+		}
+		return
+	}
+	for _, p := range ride.Passengers {
+		if p.Status == types.PassengerDroppedOff {
+			continue
+		}
+		d.ReleasePassengerPayment(ctx, ride.ID, p)
+	}
+}
+
+// ReleasePromotions gives back the promo codes redeemed for a ride that was cancelled or given
+// up, so that they can be used again. Pooled passengers already dropped off keep theirs.
+func (d *Dispatcher) ReleasePromotions(ctx context.Context, ride *types.Ride) {
+	if ride.Mode != types.ModePool {
+		d.releasePromotion(ctx, ride.PromoCode, ride.PassengerID)
+		return
+	}
+	for _, p := range ride.Passengers {
+		if p.Status == types.PassengerDroppedOff {
+			continue
+		}
+		d.ReleasePassengerPromotion(ctx, p)
+	}
+}
+
+// ReleasePassengerPromotion gives back the promo code a pooled passenger who will not be
+// carried redeemed for their fare.
+func (d *Dispatcher) ReleasePassengerPromotion(ctx context.Context, p types.RidePassenger) {
+	d.releasePromotion(ctx, p.PromoCode, p.PassengerID)
+}
+
+func (d *Dispatcher) releasePromotion(ctx context.Context, code, passengerID string) {
+	if code == "" {
+		return
+	}
+	if err := d.db.ReleasePromotion(ctx, code, passengerID); err != nil {
+		log.Printf("[ERROR] Failed to release promotion %s for passenger %s: %v", code, passengerID, err)
+	}
+}
+
+// ReleasePassengerPayment voids the payment of a pooled passenger who will not be carried.
+func (d *Dispatcher) ReleasePassengerPayment(ctx context.Context, rideID primitive.ObjectID, p types.RidePassenger) {
+	if !d.VoidPayment(p.PaymentID, p.PaymentStatus) {
+		return
+	}
+	if err := d.db.SetPoolPassengerPayment(ctx, rideID, p.PassengerID, "", "VOIDED"); err != nil {
+		log.Printf("[ERROR] Failed to update payment status of passenger %s: %v", p.PassengerID, err)
+	}
+}
+
+// VoidPayment voids a payment that is still authorized, and reports whether it was voided.
+func (d *Dispatcher) VoidPayment(paymentID, paymentStatus string) bool {
+	if paymentID == "" || (paymentStatus != "PENDING" && paymentStatus != "AUTHORIZED") {
+		return false
+	}
+	err := d.paymentService.VoidPayment(paymentID)
+	if errors.Is(err, services.ErrPaymentAlreadyCaptured) {
+		log.Printf("[WARN] Payment %s was already captured and has to be refunded", paymentID)
+		return false
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to void payment %s: %v", paymentID, err)
+		return false
+	}
+	return true
+}
+
+// DispatchDue requests a driver for every scheduled ride whose pickup falls within the lead
+// time. Rides no driver can be offered to yet go back to SCHEDULED and are retried on the next
+// call, until ExpireAfter past their pickup; rides left DISPATCHING for StuckAfter are retried
+// as well.
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	now := d.clock.Now()
+	dueBy := now.Add(d.config.LeadTime)
+
+	if n, err := d.db.ResetDispatchingRides(ctx, now.Add(-d.config.StuckAfter)); err != nil {
+		log.Printf("[ERROR] Failed to reset dispatching rides: %v", err)
+	} else if n > 0 {
+		log.Printf("[DISPATCH] %d course(s) bloquée(s) en cours de dispatch remise(s) en attente", n)
+	}
+	if n, err := d.expireScheduled(ctx, now.Add(-d.config.ExpireAfter)); err != nil {
+		log.Printf("[ERROR] Failed to expire scheduled rides: %v", err)
+	} else if n > 0 {
+		log.Printf("[DISPATCH] %d course(s) planifiée(s) sans chauffeur abandonnée(s)", n)
+	}
+
+	// Rides are only put back to SCHEDULED once every due ride was claimed, so that they are not
+	// claimed again in the same call.
+	dispatched := 0
+	var failed []rescheduled
+	defer func() {
+		revertCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		for _, f := range failed {
+			if _, err := d.db.TransitionRideStatus(revertCtx, f.id, f.from, types.StatusScheduled); err != nil {
+				log.Printf("[ERROR] Failed to reschedule ride %s: %v", f.id.Hex(), err)
+			}
+		}
+	}()
+
+	for {
+		ride, err := d.db.ClaimDueScheduledRide(ctx, dueBy)
+		if err == mongo.ErrNoDocuments {
+			return dispatched, nil
+		}
+		if err != nil {
+			return dispatched, err
+		}
+
+		if _, err := d.db.TransitionRideStatus(ctx, ride.ID, types.StatusDispatching, types.StatusRequested); err != nil {
+			log.Printf("[ERROR] Failed to request a driver for scheduled ride %s: %v", ride.ID.Hex(), err)
+			failed = append(failed, rescheduled{id: ride.ID, from: types.StatusDispatching})
+			continue
+		}
+		ride.Status = types.StatusRequested
+
+		if err := d.OfferNext(ctx, ride); err != nil {
+			log.Printf("[WARN] Failed to dispatch scheduled ride %s: %v", ride.ID.Hex(), err)
+			failed = append(failed, rescheduled{id: ride.ID, from: types.StatusRequested})
+			continue
+		}
+		log.Printf("[DISPATCH] Course planifiée %s proposée aux chauffeurs (prise en charge: %s)", ride.ID.Hex(), ride.ScheduledAt.Format(time.RFC3339))
+		dispatched++
+	}
+}
+
+// expireScheduled gives up on the scheduled rides whose pickup was before the given time and
+// gives their promo codes back.
+func (d *Dispatcher) expireScheduled(ctx context.Context, before time.Time) (int, error) {
+	expired := 0
+	for {
+		ride, err := d.db.ExpireScheduledRide(ctx, before)
+		if err == mongo.ErrNoDocuments {
+			return expired, nil
+		}
+		if err != nil {
+			return expired, err
+		}
+		d.ReleasePromotions(ctx, ride)
+		expired++
+	}
+}
+
+// rescheduled is a ride DispatchDue puts back to SCHEDULED from the status it was left in.
+type rescheduled struct {
+	id   primitive.ObjectID
+	from string
+}
+
+// Run dispatches due scheduled rides and moves expired offers on to the next driver every
+// interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	// Rides left DISPATCHING by a previous run are reset right away rather than after StuckAfter.
+	resetCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	if n, err := d.db.ResetDispatchingRides(resetCtx, d.clock.Now()); err != nil {
+		log.Printf("[ERROR] Failed to reset dispatching rides: %v", err)
+	} else if n > 0 {
+		log.Printf("[DISPATCH] %d course(s) en cours de dispatch remise(s) en attente", n)
+	}
+	cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tickCtx, cancel := context.WithTimeout(ctx, interval)
+			if _, err := d.ExpireOffers(tickCtx); err != nil {
+				log.Printf("[ERROR] Failed to expire ride offers: %v", err)
+			}
+			if _, err := d.DispatchDue(tickCtx); err != nil {
+				log.Printf("[ERROR] Failed to dispatch scheduled rides: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,635 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rides/internal/clock"
+	"rides/internal/database"
+	"rides/internal/money"
+	"rides/internal/services"
+	"rides/internal/services/paymenttest"
+	"rides/internal/types"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var start = time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+// memoryStore is an in-memory Store with the semantics of the Mongo queries.
+type memoryStore struct {
+	clock  clock.Clock
+	mu     sync.Mutex
+	rides  map[primitive.ObjectID]*types.Ride
+	offers []*types.Offer
+	// released lists the promo codes given back, as code/passenger.
+	released []string
+	// beforeAssign, when set, runs in AssignDriver before the ride status is checked, to
+	// simulate concurrent updates.
+	beforeAssign func(ride *types.Ride)
+}
+
+func newMemoryStore(clk clock.Clock) *memoryStore {
+	return &memoryStore{clock: clk, rides: map[primitive.ObjectID]*types.Ride{}}
+}
+
+func (m *memoryStore) add(ride *types.Ride) *types.Ride {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ride.ID = primitive.NewObjectID()
+	m.rides[ride.ID] = ride
+	return ride
+}
+
+func (m *memoryStore) get(id primitive.ObjectID) types.Ride {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ride := *m.rides[id]
+	ride.Passengers = slices.Clone(ride.Passengers)
+	return ride
+}
+
+func (m *memoryStore) status(id primitive.ObjectID) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rides[id].Status
+}
+
+func (m *memoryStore) GetRideByID(ctx context.Context, id primitive.ObjectID) (*types.Ride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ride, ok := m.rides[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *ride
+	return &copied, nil
+}
+
+func (m *memoryStore) FindActiveRideByDriver(ctx context.Context, driverID string) (*types.Ride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ride := range m.rides {
+		if ride.DriverID == driverID && slices.Contains(types.ActiveStatuses, ride.Status) {
+			copied := *ride
+			return &copied, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (m *memoryStore) ClaimDueScheduledRide(ctx context.Context, dueBy time.Time) (*types.Ride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*types.Ride
+	for _, ride := range m.rides {
+		if ride.Status == types.StatusScheduled && !ride.ScheduledAt.After(dueBy) {
+			due = append(due, ride)
+		}
+	}
+	if len(due) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ScheduledAt.Before(*due[j].ScheduledAt) })
+	due[0].Status = types.StatusDispatching
+	due[0].UpdatedAt = m.clock.Now()
+	copied := *due[0]
+	return &copied, nil
+}
+
+func (m *memoryStore) ResetDispatchingRides(ctx context.Context, before time.Time) (int64, error) {
+	return m.updateMany(func(r *types.Ride) bool {
+		return r.Status == types.StatusDispatching && r.UpdatedAt.Before(before)
+	}, types.StatusScheduled), nil
+}
+
+func (m *memoryStore) ExpireScheduledRide(ctx context.Context, before time.Time) (*types.Ride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired []*types.Ride
+	for _, ride := range m.rides {
+		if ride.Status == types.StatusScheduled && ride.ScheduledAt.Before(before) {
+			expired = append(expired, ride)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ScheduledAt.Before(*expired[j].ScheduledAt) })
+	expired[0].Status = types.StatusNoDriverFound
+	expired[0].UpdatedAt = m.clock.Now()
+	copied := *expired[0]
+	return &copied, nil
+}
+
+func (m *memoryStore) updateMany(match func(*types.Ride) bool, status string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, ride := range m.rides {
+		if match(ride) {
+			ride.Status = status
+			ride.UpdatedAt = m.clock.Now()
+			n++
+		}
+	}
+	return n
+}
+
+func (m *memoryStore) TransitionRideStatus(ctx context.Context, id primitive.ObjectID, from, to string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ride, ok := m.rides[id]
+	if !ok || ride.Status != from {
+		return false, nil
+	}
+	ride.Status = to
+	ride.UpdatedAt = m.clock.Now()
+	return true, nil
+}
+
+func (m *memoryStore) UpdateRidePaymentStatus(ctx context.Context, id primitive.ObjectID, paymentStatus string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rides[id].PaymentStatus = paymentStatus
+	return nil
+}
+
+func (m *memoryStore) SetPoolPassengerPayment(ctx context.Context, id primitive.ObjectID, passengerID, paymentID, paymentStatus string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, p := range m.rides[id].Passengers {
+		if p.PassengerID != passengerID {
+			continue
+		}
+		if paymentID != "" {
+			m.rides[id].Passengers[i].PaymentID = paymentID
+		}
+		m.rides[id].Passengers[i].PaymentStatus = paymentStatus
+	}
+	return nil
+}
+
+func (m *memoryStore) AssignDriver(ctx context.Context, ride *types.Ride) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.rides[ride.ID]
+	if m.beforeAssign != nil {
+		m.beforeAssign(stored)
+	}
+	if stored.Status != types.StatusRequested {
+		return false, nil
+	}
+	stored.DriverID = ride.DriverID
+	stored.PaymentID = ride.PaymentID
+	stored.PaymentStatus = ride.PaymentStatus
+	stored.Status = types.StatusAssigned
+	return true, nil
+}
+
+func (m *memoryStore) CreateOffer(ctx context.Context, offer *types.Offer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.offers {
+		if o.Status != types.OfferPending {
+			continue
+		}
+		if o.DriverID == offer.DriverID {
+			return database.ErrDriverBusy
+		}
+		if o.RideID == offer.RideID {
+			return database.ErrRideAlreadyOffered
+		}
+	}
+	offer.ID = primitive.NewObjectID()
+	copied := *offer
+	m.offers = append(m.offers, &copied)
+	return nil
+}
+
+func (m *memoryStore) GetOfferByID(ctx context.Context, id primitive.ObjectID) (*types.Offer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.offers {
+		if o.ID == id {
+			copied := *o
+			return &copied, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (m *memoryStore) RespondToOffer(ctx context.Context, id primitive.ObjectID, driverID, status, reason string, at time.Time) (*types.Offer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.offers {
+		if o.ID == id && o.DriverID == driverID && o.Status == types.OfferPending && o.ExpiresAt.After(at) {
+			o.Status = status
+			o.RespondedAt = &at
+			o.DeclineReason = reason
+			copied := *o
+			return &copied, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (m *memoryStore) ExpireNextOffer(ctx context.Context, now time.Time) (*types.Offer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next *types.Offer
+	for _, o := range m.offers {
+		if o.Status == types.OfferPending && !o.ExpiresAt.After(now) && (next == nil || o.ExpiresAt.Before(next.ExpiresAt)) {
+			next = o
+		}
+	}
+	if next == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	next.Status = types.OfferExpired
+	copied := *next
+	return &copied, nil
+}
+
+func (m *memoryStore) ListOffersByRide(ctx context.Context, rideID primitive.ObjectID) ([]types.Offer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	offers := []types.Offer{}
+	for _, o := range m.offers {
+		if o.RideID == rideID {
+			offers = append(offers, *o)
+		}
+	}
+	return offers, nil
+}
+
+func (m *memoryStore) ReleasePromotion(ctx context.Context, code, passengerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.released = append(m.released, code+"/"+passengerID)
+	return nil
+}
+
+func (m *memoryStore) releasedPromotions() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.released)
+}
+
+// usersStub is a users service answering the nearby drivers search with a fixed list.
+type usersStub struct {
+	*httptest.Server
+	mu      sync.Mutex
+	drivers []services.NearbyDriver
+}
+
+func newUsersStub(t *testing.T, drivers ...services.NearbyDriver) *usersStub {
+	u := &usersStub{drivers: drivers}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /drivers/nearby", func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		json.NewEncoder(w).Encode(u.drivers)
+	})
+	mux.HandleFunc("PATCH /drivers/{id}/status", func(w http.ResponseWriter, r *http.Request) {})
+	u.Server = httptest.NewServer(mux)
+	t.Cleanup(u.Close)
+	return u
+}
+
+func newTestDispatcher(t *testing.T, drivers ...services.NearbyDriver) (*Dispatcher, *memoryStore, *paymenttest.Server, *clock.Mock) {
+	clk := clock.NewMock(start)
+	store := newMemoryStore(clk)
+	users := newUsersStub(t, drivers...)
+	payments := paymenttest.NewServer(clk)
+	t.Cleanup(payments.Close)
+
+	d := NewDispatcher(store, services.NewUserService(users.URL, "test"), payments.PaymentService(), clk, Config{
+		LeadTime:     15 * time.Minute,
+		SearchRadius: 10000,
+		OfferTimeout: 30 * time.Second,
+		MaxOffers:    5,
+		StuckAfter:   time.Minute,
+		ExpireAfter:  30 * time.Minute,
+	})
+	return d, store, payments, clk
+}
+
+func scheduledRide(at time.Time) *types.Ride {
+	return &types.Ride{
+		PassengerID: "passenger",
+		FromZone:    "Downtown",
+		ToZone:      "Airport",
+		Status:      types.StatusScheduled,
+		ScheduledAt: &at,
+		CreatedAt:   start,
+		UpdatedAt:   start,
+	}
+}
+
+func TestDispatchDueOffersRidesWithinLeadTime(t *testing.T) {
+	d, store, _, clk := newTestDispatcher(t,
+		services.NearbyDriver{ID: "driver-1", Distance: 500},
+		services.NearbyDriver{ID: "driver-2", Distance: 900},
+	)
+	soon := store.add(scheduledRide(start.Add(10 * time.Minute)))
+	later := store.add(scheduledRide(start.Add(time.Hour)))
+
+	n, err := d.DispatchDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("dispatched %d rides, want 1", n)
+	}
+	if got := store.status(soon.ID); got != types.StatusRequested {
+		t.Errorf("ride due in 10m is %s, want %s", got, types.StatusRequested)
+	}
+	if got := store.status(later.ID); got != types.StatusScheduled {
+		t.Errorf("ride due in 1h is %s, want %s", got, types.StatusScheduled)
+	}
+	offers, _ := store.ListOffersByRide(context.Background(), soon.ID)
+	if len(offers) != 1 || offers[0].DriverID != "driver-1" || !offers[0].ExpiresAt.Equal(start.Add(30*time.Second)) {
+		t.Errorf("offers = %+v, want one to driver-1 expiring after 30s", offers)
+	}
+
+	clk.Advance(50 * time.Minute)
+	if _, err := d.DispatchDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.status(later.ID); got != types.StatusRequested {
+		t.Errorf("ride due in 10m after advancing is %s, want %s", got, types.StatusRequested)
+	}
+}
+
+func TestDispatchDueReschedulesWhenNoDriver(t *testing.T) {
+	d, store, _, _ := newTestDispatcher(t)
+	ride := store.add(scheduledRide(start.Add(5 * time.Minute)))
+
+	n, err := d.DispatchDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("dispatched %d rides, want 0", n)
+	}
+	if got := store.status(ride.ID); got != types.StatusScheduled {
+		t.Errorf("ride is %s, want it back to %s", got, types.StatusScheduled)
+	}
+}
+
+func TestDispatchDueResetsStuckRides(t *testing.T) {
+	d, store, _, _ := newTestDispatcher(t, services.NearbyDriver{ID: "driver-1", Distance: 500})
+	stuck := scheduledRide(start.Add(5 * time.Minute))
+	stuck.Status = types.StatusDispatching
+	stuck.UpdatedAt = start.Add(-2 * time.Minute)
+	stuck = store.add(stuck)
+	inFlight := scheduledRide(start.Add(5 * time.Minute))
+	inFlight.Status = types.StatusDispatching
+	inFlight.UpdatedAt = start.Add(-10 * time.Second)
+	inFlight = store.add(inFlight)
+
+	if _, err := d.DispatchDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.status(stuck.ID); got != types.StatusRequested {
+		t.Errorf("ride dispatching for 2m is %s, want it dispatched again (%s)", got, types.StatusRequested)
+	}
+	if got := store.status(inFlight.ID); got != types.StatusDispatching {
+		t.Errorf("ride dispatching for 10s is %s, want it left %s", got, types.StatusDispatching)
+	}
+}
+
+func TestDispatchDueExpiresMissedRides(t *testing.T) {
+	d, store, _, _ := newTestDispatcher(t)
+	missed := store.add(scheduledRide(start.Add(-time.Hour)))
+	late := store.add(scheduledRide(start.Add(-10 * time.Minute)))
+
+	if _, err := d.DispatchDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.status(missed.ID); got != types.StatusNoDriverFound {
+		t.Errorf("ride 1h past pickup is %s, want %s", got, types.StatusNoDriverFound)
+	}
+	if got := store.status(late.ID); got != types.StatusScheduled {
+		t.Errorf("ride 10m past pickup is %s, want it still %s", got, types.StatusScheduled)
+	}
+}
+
+func TestDispatchDueReleasesPromotionsOfMissedRides(t *testing.T) {
+	d, store, _, _ := newTestDispatcher(t)
+	missed := scheduledRide(start.Add(-time.Hour))
+	missed.PromoCode = "WELCOME"
+	store.add(missed)
+	late := scheduledRide(start.Add(-10 * time.Minute))
+	late.PromoCode = "LATE"
+	store.add(late)
+
+	if _, err := d.DispatchDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.releasedPromotions(); !slices.Equal(got, []string{"WELCOME/passenger"}) {
+		t.Errorf("released promotions = %v, want only the missed ride's", got)
+	}
+}
+
+func requestedRide(t *testing.T, d *Dispatcher, store *memoryStore) *types.Ride {
+	t.Helper()
+	ride := store.add(&types.Ride{
+		PassengerID: "passenger",
+		FromZone:    "Downtown",
+		ToZone:      "Airport",
+		Status:      types.StatusRequested,
+		CreatedAt:   start,
+		UpdatedAt:   start,
+	})
+	if err := d.OfferNext(context.Background(), ride); err != nil {
+		t.Fatal(err)
+	}
+	return ride
+}
+
+func TestExpireOffersMovesToNextDriver(t *testing.T) {
+	d, store, _, clk := newTestDispatcher(t,
+		services.NearbyDriver{ID: "driver-1", Distance: 500},
+		services.NearbyDriver{ID: "driver-2", Distance: 900},
+	)
+	ride := requestedRide(t, d, store)
+
+	clk.Advance(29 * time.Second)
+	if n, err := d.ExpireOffers(context.Background()); err != nil || n != 0 {
+		t.Fatalf("ExpireOffers before the deadline = %d, %v; want 0", n, err)
+	}
+
+	clk.Advance(2 * time.Second)
+	if n, err := d.ExpireOffers(context.Background()); err != nil || n != 1 {
+		t.Fatalf("ExpireOffers after the deadline = %d, %v; want 1", n, err)
+	}
+
+	offers, _ := store.ListOffersByRide(context.Background(), ride.ID)
+	if len(offers) != 2 {
+		t.Fatalf("got %d offers, want 2", len(offers))
+	}
+	if offers[0].DriverID != "driver-1" || offers[0].Status != types.OfferExpired {
+		t.Errorf("first offer = %s to %s, want %s to driver-1", offers[0].Status, offers[0].DriverID, types.OfferExpired)
+	}
+	if offers[1].DriverID != "driver-2" || offers[1].Status != types.OfferPending || offers[1].Attempt != 2 {
+		t.Errorf("second offer = %s to %s (attempt %d), want %s to driver-2 (attempt 2)", offers[1].Status, offers[1].DriverID, offers[1].Attempt, types.OfferPending)
+	}
+	if got := store.status(ride.ID); got != types.StatusRequested {
+		t.Errorf("ride is %s, want %s", got, types.StatusRequested)
+	}
+}
+
+func TestExpireOffersGivesUpWhenNoDriverLeft(t *testing.T) {
+	d, store, _, clk := newTestDispatcher(t, services.NearbyDriver{ID: "driver-1", Distance: 500})
+	ride := requestedRide(t, d, store)
+
+	clk.Advance(time.Minute)
+	if n, err := d.ExpireOffers(context.Background()); err != nil || n != 1 {
+		t.Fatalf("ExpireOffers = %d, %v; want 1", n, err)
+	}
+	if got := store.status(ride.ID); got != types.StatusNoDriverFound {
+		t.Errorf("ride is %s, want %s", got, types.StatusNoDriverFound)
+	}
+}
+
+func TestAcceptAfterExpiryIsRejected(t *testing.T) {
+	d, store, _, clk := newTestDispatcher(t, services.NearbyDriver{ID: "driver-1", Distance: 500})
+	ride := requestedRide(t, d, store)
+	offers, _ := store.ListOffersByRide(context.Background(), ride.ID)
+
+	clk.Advance(31 * time.Second)
+	if _, err := d.Accept(context.Background(), ride.ID, offers[0].ID, "driver-1"); err != ErrOfferNotPending {
+		t.Errorf("Accept after the deadline = %v, want %v", err, ErrOfferNotPending)
+	}
+}
+
+func TestRedispatchVoidsPoolHoldsWhenNoDriverLeft(t *testing.T) {
+	d, store, payments, clk := newTestDispatcher(t, services.NearbyDriver{ID: "driver-1", Distance: 500})
+	joined := payments.Add(services.Payment{Amount: money.Cents(900), Status: "AUTHORIZED"})
+	ride := store.add(&types.Ride{
+		PassengerID: "passenger-1",
+		FromZone:    "Downtown",
+		ToZone:      "Airport",
+		Mode:        types.ModePool,
+		Status:      types.StatusRequested,
+		Passengers: []types.RidePassenger{
+			{PassengerID: "passenger-1", Status: types.PassengerWaiting},
+			{PassengerID: "passenger-2", Status: types.PassengerWaiting, PaymentID: joined, PaymentStatus: "PENDING"},
+		},
+		CreatedAt: start,
+		UpdatedAt: start,
+	})
+	if err := d.OfferNext(context.Background(), ride); err != nil {
+		t.Fatal(err)
+	}
+
+	clk.Advance(time.Minute)
+	if _, err := d.ExpireOffers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.status(ride.ID); got != types.StatusNoDriverFound {
+		t.Fatalf("ride is %s, want %s", got, types.StatusNoDriverFound)
+	}
+	if p, _ := payments.Payment(joined); p.Status != services.PaymentStatusVoided {
+		t.Errorf("payment of the passenger who joined is %s, want %s", p.Status, services.PaymentStatusVoided)
+	}
+	if got := store.get(ride.ID).Passengers[1].PaymentStatus; got != "VOIDED" {
+		t.Errorf("passenger payment status is %s, want VOIDED", got)
+	}
+}
+
+func TestRedispatchReleasesPoolPromotionsWhenNoDriverLeft(t *testing.T) {
+	d, store, _, clk := newTestDispatcher(t, services.NearbyDriver{ID: "driver-1", Distance: 500})
+	ride := store.add(&types.Ride{
+		PassengerID: "passenger-1",
+		FromZone:    "Downtown",
+		ToZone:      "Airport",
+		Mode:        types.ModePool,
+		Status:      types.StatusRequested,
+		PromoCode:   "WELCOME",
+		Passengers: []types.RidePassenger{
+			{PassengerID: "passenger-1", Status: types.PassengerWaiting, PromoCode: "WELCOME"},
+			{PassengerID: "passenger-2", Status: types.PassengerWaiting},
+			{PassengerID: "passenger-3", Status: types.PassengerWaiting, PromoCode: "FRIENDS"},
+		},
+		CreatedAt: start,
+		UpdatedAt: start,
+	})
+	if err := d.OfferNext(context.Background(), ride); err != nil {
+		t.Fatal(err)
+	}
+
+	clk.Advance(time.Minute)
+	if _, err := d.ExpireOffers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"WELCOME/passenger-1", "FRIENDS/passenger-3"}
+	if got := store.releasedPromotions(); !slices.Equal(got, want) {
+		t.Errorf("released promotions = %v, want %v", got, want)
+	}
+}
+
+func TestAcceptVoidsPaymentWhenRideIsNoLongerRequested(t *testing.T) {
+	d, store, payments, _ := newTestDispatcher(t, services.NearbyDriver{ID: "driver-1", Distance: 500})
+	ride := requestedRide(t, d, store)
+	store.rides[ride.ID].Price = money.Cents(2500)
+	offers, _ := store.ListOffersByRide(context.Background(), ride.ID)
+	store.beforeAssign = func(ride *types.Ride) { ride.Status = types.StatusCancelled }
+
+	if _, err := d.Accept(context.Background(), ride.ID, offers[0].ID, "driver-1"); err != ErrRideNotRequested {
+		t.Fatalf("Accept of a ride cancelled meanwhile = %v, want %v", err, ErrRideNotRequested)
+	}
+	authorized := payments.Payments()
+	if len(authorized) != 1 || authorized[0].Status != services.PaymentStatusVoided {
+		t.Errorf("payments = %+v, want a single %s payment", authorized, services.PaymentStatusVoided)
+	}
+}
+
+func TestAcceptVoidsPoolPaymentsWhenAnAuthorizationFails(t *testing.T) {
+	d, store, payments, _ := newTestDispatcher(t, services.NearbyDriver{ID: "driver-1", Distance: 500})
+	joined := payments.Add(services.Payment{Amount: money.Cents(900), Status: services.PaymentStatusAuthorized})
+	ride := store.add(&types.Ride{
+		PassengerID: "passenger-1",
+		FromZone:    "Downtown",
+		ToZone:      "Airport",
+		Mode:        types.ModePool,
+		Status:      types.StatusRequested,
+		Passengers: []types.RidePassenger{
+			{PassengerID: "passenger-1", Status: types.PassengerWaiting, Price: money.Cents(1200)},
+			{PassengerID: "passenger-2", Status: types.PassengerWaiting, PaymentID: joined, PaymentStatus: "PENDING"},
+			// A zero fare is refused by the payment service.
+			{PassengerID: "passenger-3", Status: types.PassengerWaiting},
+		},
+		CreatedAt: start,
+		UpdatedAt: start,
+	})
+	if err := d.OfferNext(context.Background(), ride); err != nil {
+		t.Fatal(err)
+	}
+	offers, _ := store.ListOffersByRide(context.Background(), ride.ID)
+
+	if _, err := d.Accept(context.Background(), ride.ID, offers[0].ID, "driver-1"); !errors.Is(err, ErrPaymentAuthorization) {
+		t.Fatalf("Accept = %v, want %v", err, ErrPaymentAuthorization)
+	}
+	if got := store.status(ride.ID); got != types.StatusCancelled {
+		t.Errorf("ride is %s, want %s", got, types.StatusCancelled)
+	}
+	for _, p := range payments.Payments() {
+		if p.Status != services.PaymentStatusVoided {
+			t.Errorf("payment %s is %s, want %s", p.PaymentID, p.Status, services.PaymentStatusVoided)
+		}
+	}
+	if n := len(payments.Payments()); n != 2 {
+		t.Errorf("got %d payments, want the joined passenger's and the first passenger's", n)
+	}
+}
@@ -0,0 +1,237 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"rides/internal/database"
+	"rides/internal/types"
+	"rides/internal/zones"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrOfferNotFound    = errors.New("offer not found")
+	ErrOfferNotPending  = errors.New("offer is no longer pending")
+	ErrOfferNotForYou   = errors.New("offer was made to another driver")
+	ErrRideNotRequested = errors.New("ride is no longer waiting for a driver")
+)
+
+// OfferNext offers a REQUESTED ride to the closest available driver it was not offered to yet.
+// It returns ErrNoDriverAvailable when no driver is left to ask or the ride has been offered
+// MaxOffers times already.
+func (d *Dispatcher) OfferNext(ctx context.Context, ride *types.Ride) error {
+	pickup, ok := zones.Get(ride.FromZone)
+	if !ok {
+		return fmt.Errorf("%w: unknown pickup zone %q", ErrNoDriverAvailable, ride.FromZone)
+	}
+
+	offers, err := d.db.ListOffersByRide(ctx, ride.ID)
+	if err != nil {
+		return err
+	}
+	if d.config.MaxOffers > 0 && len(offers) >= d.config.MaxOffers {
+		return fmt.Errorf("%w: offered to %d drivers already", ErrNoDriverAvailable, len(offers))
+	}
+	asked := make(map[string]bool, len(offers))
+	for _, o := range offers {
+		asked[o.DriverID] = true
+	}
+
+	candidates, err := d.userService.GetNearbyAvailableDrivers(pickup.Lat, pickup.Lng, d.config.SearchRadius, d.config.MinDriverRating)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNoDriverAvailable, err)
+	}
+
+	for _, c := range candidates {
+		if asked[c.ID] {
+			continue
+		}
+
+		now := d.clock.Now()
+		offer := &types.Offer{
+			RideID:    ride.ID,
+			DriverID:  c.ID,
+			Attempt:   len(offers) + 1,
+			DistanceM: c.Distance,
+			Status:    types.OfferPending,
+			OfferedAt: now,
+			ExpiresAt: now.Add(d.config.OfferTimeout),
+		}
+		err := d.db.CreateOffer(ctx, offer)
+		if errors.Is(err, database.ErrDriverBusy) {
+			// The driver is considering another ride; try the next one.
+			continue
+		}
+		if errors.Is(err, database.ErrRideAlreadyOffered) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[DISPATCH] Course %s proposée au chauffeur %s (tentative %d, %.0fm)", ride.ID.Hex(), c.ID, offer.Attempt, c.Distance)
+		return nil
+	}
+
+	return fmt.Errorf("%w: no driver left to offer the ride to within %.0fm", ErrNoDriverAvailable, d.config.SearchRadius)
+}
+
+// Accept records the driver's acceptance of a pending offer, authorizes the ride's payment and
+// assigns the driver. If the payment cannot be authorized the ride is cancelled.
+func (d *Dispatcher) Accept(ctx context.Context, rideID, offerID primitive.ObjectID, driverID string) (*types.Ride, error) {
+	if _, err := d.respond(ctx, rideID, offerID, driverID, types.OfferAccepted, ""); err != nil {
+		return nil, err
+	}
+
+	ride, err := d.db.GetRideByID(ctx, rideID)
+	if err != nil {
+		return nil, err
+	}
+	// Saves authorizing payments for a ride already gone; AssignDriver makes the final check.
+	if ride.Status != types.StatusRequested {
+		return nil, ErrRideNotRequested
+	}
+
+	// A driver still on another ride cannot take this one; it goes to the next driver.
+	if active, err := d.db.FindActiveRideByDriver(ctx, driverID); err == nil {
+		d.redispatch(ctx, rideID)
+		return nil, &database.ActiveRideError{Field: "driver", RideID: active.ID}
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if err := d.userService.UpdateDriverStatus(driverID, false); err != nil {
+		log.Printf("[WARN] Failed to update driver status: %v", err)
+	}
+
+	authorized, err := d.authorize(ride)
+	if err != nil {
+		d.voidAuthorized(ride, authorized)
+		d.ReleaseDriver(driverID)
+		cancelled, cancelErr := d.db.TransitionRideStatus(ctx, ride.ID, types.StatusRequested, types.StatusCancelled)
+		if cancelErr != nil {
+			log.Printf("[ERROR] Failed to cancel ride %s: %v", ride.ID.Hex(), cancelErr)
+		}
+		// Passengers who joined the pool while it was waiting for a driver were authorized.
+		if cancelled {
+			d.ReleasePayments(ctx, ride)
+			d.ReleasePromotions(ctx, ride)
+		}
+		if statusErr := d.db.UpdateRidePaymentStatus(ctx, ride.ID, "FAILED"); statusErr != nil {
+			log.Printf("[ERROR] Failed to update payment status: %v", statusErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrPaymentAuthorization, err)
+	}
+
+	ride.DriverID = driverID
+	assigned, err := d.db.AssignDriver(ctx, ride)
+	if err != nil || !assigned {
+		d.voidAuthorized(ride, authorized)
+		d.ReleaseDriver(driverID)
+		if err == nil {
+			err = ErrRideNotRequested
+		}
+		return nil, err
+	}
+	if ride.Mode == types.ModePool {
+		for _, p := range ride.Passengers {
+			if !slices.Contains(authorized, p.PaymentID) {
+				continue
+			}
+			if err := d.db.SetPoolPassengerPayment(ctx, ride.ID, p.PassengerID, p.PaymentID, p.PaymentStatus); err != nil {
+				log.Printf("[ERROR] Failed to record payment %s for pool %s: %v", p.PaymentID, ride.ID.Hex(), err)
+			}
+		}
+	}
+
+	log.Printf("[DISPATCH] Course %s acceptée par le chauffeur %s", ride.ID.Hex(), driverID)
+	return d.db.GetRideByID(ctx, ride.ID)
+}
+
+// Decline records the driver's refusal of a pending offer and offers the ride to the next
+// driver.
+func (d *Dispatcher) Decline(ctx context.Context, rideID, offerID primitive.ObjectID, driverID, reason string) (*types.Offer, error) {
+	offer, err := d.respond(ctx, rideID, offerID, driverID, types.OfferDeclined, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DISPATCH] Course %s refusée par le chauffeur %s", rideID.Hex(), driverID)
+	d.redispatch(ctx, rideID)
+	return offer, nil
+}
+
+func (d *Dispatcher) respond(ctx context.Context, rideID, offerID primitive.ObjectID, driverID, status, reason string) (*types.Offer, error) {
+	offer, err := d.db.GetOfferByID(ctx, offerID)
+	if err == mongo.ErrNoDocuments || (err == nil && offer.RideID != rideID) {
+		return nil, ErrOfferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offer.DriverID != driverID {
+		return nil, ErrOfferNotForYou
+	}
+
+	offer, err = d.db.RespondToOffer(ctx, offerID, driverID, status, reason, d.clock.Now())
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOfferNotPending
+	}
+	return offer, err
+}
+
+// ExpireOffers closes the pending offers whose deadline has passed and offers their rides to
+// the next driver.
+func (d *Dispatcher) ExpireOffers(ctx context.Context) (int, error) {
+	expired := 0
+	for {
+		offer, err := d.db.ExpireNextOffer(ctx, d.clock.Now())
+		if err == mongo.ErrNoDocuments {
+			return expired, nil
+		}
+		if err != nil {
+			return expired, err
+		}
+
+		log.Printf("[DISPATCH] Offre de la course %s au chauffeur %s expirée", offer.RideID.Hex(), offer.DriverID)
+		expired++
+		d.redispatch(ctx, offer.RideID)
+	}
+}
+
+// redispatch offers a ride still waiting for a driver to the next one, and gives up on it
+// once no driver is left to ask.
+func (d *Dispatcher) redispatch(ctx context.Context, rideID primitive.ObjectID) {
+	ride, err := d.db.GetRideByID(ctx, rideID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get ride %s: %v", rideID.Hex(), err)
+		return
+	}
+	if ride.Status != types.StatusRequested {
+		return
+	}
+
+	err = d.OfferNext(ctx, ride)
+	if errors.Is(err, ErrNoDriverAvailable) {
+		log.Printf("[WARN] No driver found for ride %s: %v", rideID.Hex(), err)
+		given, err := d.db.TransitionRideStatus(ctx, rideID, types.StatusRequested, types.StatusNoDriverFound)
+		if err != nil {
+			log.Printf("[ERROR] Failed to update ride status: %v", err)
+			return
+		}
+		// Passengers who joined the pool while it was waiting for a driver were authorized.
+		if given {
+			d.ReleasePayments(ctx, ride)
+			d.ReleasePromotions(ctx, ride)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to offer ride %s: %v", rideID.Hex(), err)
+	}
+}
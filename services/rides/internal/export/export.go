@@ -0,0 +1,175 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rides/internal/database"
+	"rides/internal/money"
+	"rides/internal/pricing"
+	"rides/internal/types"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxPeriod bounds the period of an export.
+const MaxPeriod = 366 * 24 * time.Hour
+
+// Row is one charge of an export: an exclusive ride, or one passenger's share of a pooled
+// ride. Subtotal (after discounts, before taxes), Discounts and Taxes are only known for rides
+// priced since fares are itemized; Total is always set. Tips only count captured tips.
+type Row struct {
+	RideID        string
+	CreatedAt     time.Time
+	CompletedAt   *time.Time
+	Status        string
+	Mode          string
+	PassengerID   string
+	DriverID      string
+	FromZone      string
+	ToZone        string
+	DistanceKm    float64
+	Subtotal      money.Money
+	Discounts     money.Money
+	Taxes         money.Money
+	Total         money.Money
+	Tips          money.Money
+	Currency      string
+	PromoCode     string
+	PaymentID     string
+	PaymentStatus string
+}
+
+// columns are the names of the fields of a Row in every format, in order.
+var columns = []string{
+	"ride_id", "created_at", "completed_at", "status", "mode", "passenger_id", "driver_id",
+	"from_zone", "to_zone", "distance_km", "subtotal", "discounts", "taxes", "total", "tips",
+	"currency", "promo_code", "payment_id", "payment_status",
+}
+
+// ParseDate reads a bound of an export period, either a date (midnight UTC) or an RFC 3339
+// timestamp.
+func ParseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// CheckFilter validates the period, statuses and mode of an export.
+func CheckFilter(f database.RideFilter) error {
+	if f.From.IsZero() || f.To.IsZero() {
+		return errors.New("from and to are required")
+	}
+	if !f.From.Before(f.To) {
+		return errors.New("from must be before to")
+	}
+	if f.To.Sub(f.From) > MaxPeriod {
+		return errors.New("period must not exceed a year")
+	}
+	for _, s := range f.Statuses {
+		if !slices.Contains(types.Statuses, s) {
+			return fmt.Errorf("invalid status %q", s)
+		}
+	}
+	if f.Mode != "" && f.Mode != types.ModeExclusive && f.Mode != types.ModePool {
+		return fmt.Errorf("invalid mode %q", f.Mode)
+	}
+	return nil
+}
+
+// ParseStatuses splits a comma-separated list of statuses.
+func ParseStatuses(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// Rides writes a row for every charge of the rides matching the filter, streaming them from
+// the database, and returns how many rows it wrote. On pooled rides, only the shares of the
+// filter's passenger are written when it is set. The writer is left open.
+func Rides(ctx context.Context, db *database.Database, filter database.RideFilter, w Writer) (int, error) {
+	n := 0
+	err := db.StreamRides(ctx, filter, func(ride *types.Ride) error {
+		for _, row := range rows(ride, filter.PassengerID) {
+			if err := w.Write(&row); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func rows(ride *types.Ride, passengerID string) []Row {
+	base := Row{
+		RideID:        ride.ID.Hex(),
+		CreatedAt:     ride.CreatedAt,
+		CompletedAt:   ride.CompletedAt,
+		Status:        ride.Status,
+		Mode:          ride.Mode,
+		PassengerID:   ride.PassengerID,
+		DriverID:      ride.DriverID,
+		FromZone:      ride.FromZone,
+		ToZone:        ride.ToZone,
+		Currency:      ride.Currency,
+		PromoCode:     ride.PromoCode,
+		PaymentID:     ride.PaymentID,
+		PaymentStatus: ride.PaymentStatus,
+	}
+	if base.Mode == "" {
+		base.Mode = types.ModeExclusive
+	}
+	if base.Currency == "" {
+		base.Currency = money.DefaultCurrency
+	}
+
+	if ride.Mode != types.ModePool {
+		row := base
+		row.setFare(ride.Fare, ride.Price)
+		row.Tips = capturedTips(ride.Tips, ride.PassengerID)
+		return []Row{row}
+	}
+
+	var rows []Row
+	for _, p := range ride.Passengers {
+		if passengerID != "" && p.PassengerID != passengerID {
+			continue
+		}
+		row := base
+		row.PassengerID, row.FromZone, row.ToZone = p.PassengerID, p.FromZone, p.ToZone
+		row.PromoCode, row.PaymentID, row.PaymentStatus = p.PromoCode, p.PaymentID, p.PaymentStatus
+		row.setFare(p.Fare, p.Price)
+		row.Tips = capturedTips(ride.Tips, p.PassengerID)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (r *Row) setFare(fare *pricing.Breakdown, price money.Money) {
+	r.Total = price
+	if fare == nil {
+		return
+	}
+	r.DistanceKm = fare.DistanceKm
+	r.Subtotal = fare.Subtotal
+	for _, d := range fare.Discounts {
+		r.Discounts = r.Discounts.Add(d.Amount)
+	}
+	for _, t := range fare.Taxes {
+		r.Taxes = r.Taxes.Add(t.Amount)
+	}
+}
+
+func capturedTips(tips []types.Tip, passengerID string) money.Money {
+	total := money.Cents(0)
+	for _, tip := range tips {
+		if tip.PassengerID == passengerID && tip.PaymentStatus == "CAPTURED" {
+			total = total.Add(tip.Amount)
+		}
+	}
+	return total
+}
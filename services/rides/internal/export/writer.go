@@ -0,0 +1,196 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"rides/internal/money"
+	"strconv"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Format is a file format rides can be exported to.
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+// ContentType is the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case NDJSON:
+		return "application/x-ndjson"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Writer writes the rows of an export one at a time. Close must be called once all rows are
+// written to complete the file.
+type Writer interface {
+	Write(row *Row) error
+	Close() error
+}
+
+// NewWriter returns a writer of the format to w.
+func NewWriter(w io.Writer, f Format) (Writer, error) {
+	switch f {
+	case CSV:
+		return newCSVWriter(w)
+	case NDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case Parquet:
+		return newParquetWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", f)
+	}
+}
+
+// csvWriter writes a header line, then a line per row. Amounts are decimals in major units
+// and dates RFC 3339 timestamps in UTC.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(r *Row) error {
+	completedAt := ""
+	if r.CompletedAt != nil {
+		completedAt = r.CompletedAt.UTC().Format(time.RFC3339)
+	}
+	return cw.w.Write([]string{
+		r.RideID, r.CreatedAt.UTC().Format(time.RFC3339), completedAt, r.Status, r.Mode,
+		r.PassengerID, r.DriverID, r.FromZone, r.ToZone,
+		strconv.FormatFloat(r.DistanceKm, 'f', 2, 64),
+		r.Subtotal.Decimal(), r.Discounts.Decimal(), r.Taxes.Decimal(), r.Total.Decimal(), r.Tips.Decimal(),
+		r.Currency, r.PromoCode, r.PaymentID, r.PaymentStatus,
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ndjsonWriter writes a JSON object per line, with the same fields as the CSV columns.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+type ndjsonRow struct {
+	RideID        string      `json:"ride_id"`
+	CreatedAt     time.Time   `json:"created_at"`
+	CompletedAt   *time.Time  `json:"completed_at"`
+	Status        string      `json:"status"`
+	Mode          string      `json:"mode"`
+	PassengerID   string      `json:"passenger_id"`
+	DriverID      string      `json:"driver_id"`
+	FromZone      string      `json:"from_zone"`
+	ToZone        string      `json:"to_zone"`
+	DistanceKm    float64     `json:"distance_km"`
+	Subtotal      money.Money `json:"subtotal"`
+	Discounts     money.Money `json:"discounts"`
+	Taxes         money.Money `json:"taxes"`
+	Total         money.Money `json:"total"`
+	Tips          money.Money `json:"tips"`
+	Currency      string      `json:"currency"`
+	PromoCode     string      `json:"promo_code"`
+	PaymentID     string      `json:"payment_id"`
+	PaymentStatus string      `json:"payment_status"`
+}
+
+func (nw *ndjsonWriter) Write(r *Row) error {
+	return nw.enc.Encode(ndjsonRow(*r))
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+// parquetWriter writes rows in row groups of parquetRowGroupSize bytes, the most an export
+// holds in memory. Amounts are decimals stored as cents and dates timestamps in milliseconds.
+type parquetWriter struct {
+	w *writer.ParquetWriter
+}
+
+const parquetRowGroupSize = 8 * 1024 * 1024
+
+type parquetRow struct {
+	RideID        string  `parquet:"name=ride_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CreatedAt     int64   `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	CompletedAt   *int64  `parquet:"name=completed_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	Status        string  `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Mode          string  `parquet:"name=mode, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	PassengerID   string  `parquet:"name=passenger_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	DriverID      string  `parquet:"name=driver_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FromZone      string  `parquet:"name=from_zone, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ToZone        string  `parquet:"name=to_zone, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	DistanceKm    float64 `parquet:"name=distance_km, type=DOUBLE"`
+	Subtotal      int64   `parquet:"name=subtotal, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Discounts     int64   `parquet:"name=discounts, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Taxes         int64   `parquet:"name=taxes, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Total         int64   `parquet:"name=total, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Tips          int64   `parquet:"name=tips, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Currency      string  `parquet:"name=currency, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	PromoCode     string  `parquet:"name=promo_code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PaymentID     string  `parquet:"name=payment_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PaymentStatus string  `parquet:"name=payment_status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+func newParquetWriter(w io.Writer) (*parquetWriter, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRow), 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &parquetWriter{w: pw}, nil
+}
+
+func (pw *parquetWriter) Write(r *Row) error {
+	row := parquetRow{
+		RideID:        r.RideID,
+		CreatedAt:     r.CreatedAt.UnixMilli(),
+		Status:        r.Status,
+		Mode:          r.Mode,
+		PassengerID:   r.PassengerID,
+		DriverID:      r.DriverID,
+		FromZone:      r.FromZone,
+		ToZone:        r.ToZone,
+		DistanceKm:    r.DistanceKm,
+		Subtotal:      r.Subtotal.Amount,
+		Discounts:     r.Discounts.Amount,
+		Taxes:         r.Taxes.Amount,
+		Total:         r.Total.Amount,
+		Tips:          r.Tips.Amount,
+		Currency:      r.Currency,
+		PromoCode:     r.PromoCode,
+		PaymentID:     r.PaymentID,
+		PaymentStatus: r.PaymentStatus,
+	}
+	if r.CompletedAt != nil {
+		completedAt := r.CompletedAt.UnixMilli()
+		row.CompletedAt = &completedAt
+	}
+	return pw.w.Write(row)
+}
+
+func (pw *parquetWriter) Close() error {
+	return pw.w.WriteStop()
+}
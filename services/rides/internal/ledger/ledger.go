@@ -0,0 +1,189 @@
+package ledger
+
+import (
+	"errors"
+	"rides/internal/money"
+	"rides/internal/pricing"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Accounts of the ledger. Captured payments are debited to Captured and credited to whoever
+// they are owed to: the driver, the platform or the tax authorities.
+const (
+	Captured    = "passengers:captured"
+	Commission  = "platform:commission"
+	BookingFees = "platform:booking_fees"
+	Adjustments = "platform:adjustments"
+	Taxes       = "taxes:payable"
+	Payouts     = "payouts:pending"
+)
+
+var ErrUnbalanced = errors.New("unbalanced transaction")
+
+// Driver is the account of what the platform owes a driver.
+func Driver(driverID string) string {
+	return "driver:" + driverID
+}
+
+// Fare records a captured fare: taxes are owed to the tax authorities, the booking fee and the
+// commission (a percentage of the rest) to the platform, and the remainder to the driver.
+// Fares priced before breakdowns were itemized are only split between the commission and the
+// driver.
+func Fare(driverID string, rideID primitive.ObjectID, paymentID string, fare *pricing.Breakdown, price money.Money, commissionPercent int64, at time.Time) *types.Transaction {
+	earned, bookingFee, taxes := price, money.Money{}, money.Money{}
+	if fare != nil {
+		bookingFee = fare.BookingFee
+		earned = fare.Subtotal.Sub(bookingFee)
+		for _, t := range fare.Taxes {
+			taxes = taxes.Add(t.Amount)
+		}
+	}
+	commission := earned.Percent(commissionPercent)
+
+	postings := []types.Posting{
+		{Account: Captured, Debit: price},
+		{Account: Driver(driverID), Credit: earned.Sub(commission)},
+		{Account: Commission, Credit: commission},
+		{Account: BookingFees, Credit: bookingFee},
+		{Account: Taxes, Credit: taxes},
+	}
+
+	return &types.Transaction{
+		Kind:      types.TransactionFare,
+		Reference: paymentID,
+		DriverID:  driverID,
+		RideID:    &rideID,
+		Postings:  withoutZero(postings),
+		CreatedAt: at,
+	}
+}
+
+// Tip records a captured tip, owed entirely to the driver.
+func Tip(driverID string, rideID primitive.ObjectID, paymentID string, amount money.Money, at time.Time) *types.Transaction {
+	return &types.Transaction{
+		Kind:      types.TransactionTip,
+		Reference: paymentID,
+		DriverID:  driverID,
+		RideID:    &rideID,
+		Postings: []types.Posting{
+			{Account: Captured, Debit: amount},
+			{Account: Driver(driverID), Credit: amount},
+		},
+		CreatedAt: at,
+	}
+}
+
+// Adjustment records a correction of a driver's earnings by support: a positive amount is
+// owed to the driver, a negative one deducted from their earnings.
+func Adjustment(driverID, reference string, rideID *primitive.ObjectID, amount money.Money, reason string, at time.Time) *types.Transaction {
+	postings := []types.Posting{
+		{Account: Adjustments, Debit: amount},
+		{Account: Driver(driverID), Credit: amount},
+	}
+	if !amount.IsPositive() {
+		amount = amount.Mul(-1)
+		postings = []types.Posting{
+			{Account: Driver(driverID), Debit: amount},
+			{Account: Adjustments, Credit: amount},
+		}
+	}
+
+	return &types.Transaction{
+		Kind:        types.TransactionAdjustment,
+		Reference:   reference,
+		DriverID:    driverID,
+		RideID:      rideID,
+		Description: reason,
+		Postings:    postings,
+		CreatedAt:   at,
+	}
+}
+
+// Payout records the amount of a payout statement as owed to the driver outside the
+// platform, settling their account.
+func Payout(driverID, reference string, amount money.Money, at time.Time) *types.Transaction {
+	return &types.Transaction{
+		Kind:      types.TransactionPayout,
+		Reference: reference,
+		DriverID:  driverID,
+		Postings: []types.Posting{
+			{Account: Driver(driverID), Debit: amount},
+			{Account: Payouts, Credit: amount},
+		},
+		CreatedAt: at,
+	}
+}
+
+// Validate checks that the transaction's debits and credits balance.
+func Validate(tx *types.Transaction) error {
+	var debits, credits money.Money
+	for _, p := range tx.Postings {
+		debits = debits.Add(p.Debit)
+		credits = credits.Add(p.Credit)
+	}
+	if len(tx.Postings) < 2 || !debits.Sub(credits).IsZero() {
+		return ErrUnbalanced
+	}
+	return nil
+}
+
+// Summarize totals the driver's earnings recorded by the transactions. Payouts settle earnings
+// and are not counted.
+func Summarize(driverID string, txs []types.Transaction) types.EarningsSummary {
+	var s types.EarningsSummary
+	account := Driver(driverID)
+	rides := map[primitive.ObjectID]bool{}
+
+	for _, tx := range txs {
+		var net, commission money.Money
+		for _, p := range tx.Postings {
+			switch p.Account {
+			case account:
+				net = net.Add(p.Credit).Sub(p.Debit)
+			case Commission:
+				commission = commission.Add(p.Credit)
+			}
+		}
+
+		switch tx.Kind {
+		case types.TransactionFare:
+			// A pooled ride credits one fare per passenger.
+			if tx.RideID != nil && !rides[*tx.RideID] {
+				rides[*tx.RideID] = true
+				s.Rides++
+			}
+			s.NetFares = s.NetFares.Add(net)
+			s.Commission = s.Commission.Add(commission)
+			s.GrossFares = s.GrossFares.Add(net).Add(commission)
+		case types.TransactionTip:
+			s.Tips = s.Tips.Add(net)
+		case types.TransactionAdjustment:
+			s.Adjustments = s.Adjustments.Add(net)
+		default:
+			continue
+		}
+		s.Net = s.Net.Add(net)
+	}
+	return s
+}
+
+// WeekStart returns the Monday, 00:00 UTC, starting the week of t. Payout statements cover
+// weeks from one Monday to the next.
+func WeekStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+func withoutZero(postings []types.Posting) []types.Posting {
+	kept := postings[:0]
+	for _, p := range postings {
+		if !p.Debit.IsZero() || !p.Credit.IsZero() {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,212 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// DefaultCurrency is the ISO 4217 currency fares are charged in.
+const DefaultCurrency = "CAD"
+
+// minorUnits is the number of minor units in a major unit. Every supported currency has two
+// decimals.
+const minorUnits = 100
+
+// Money is an amount in the minor unit (cents) of an ISO 4217 currency. Arithmetic is exact;
+// rounding only happens when scaling by a non-integer factor, half away from zero.
+//
+// In JSON a Money is a plain decimal number of major units (18.75), as prices always were; in
+// BSON it is a {amount, currency} document with the amount in minor units.
+type Money struct {
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+// Cents returns an amount of minor units in the default currency.
+func Cents(amount int64) Money {
+	return Money{Amount: amount, Currency: DefaultCurrency}
+}
+
+// FromFloat converts an amount of major units to the default currency, rounding to the
+// nearest minor unit.
+func FromFloat(v float64) Money {
+	return Cents(int64(math.Round(v * minorUnits)))
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: sameCurrency(m, o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: sameCurrency(m, o)}
+}
+
+// Mul scales the amount by a factor, rounding to the nearest minor unit.
+func (m Money) Mul(factor float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * factor)), Currency: m.Currency}
+}
+
+// Percent returns pct percent of the amount, rounded to the nearest minor unit.
+func (m Money) Percent(pct int64) Money {
+	return Money{Amount: divRound(m.Amount*pct, 100), Currency: m.Currency}
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+
+// GreaterThan compares two amounts of the same currency.
+func (m Money) GreaterThan(o Money) bool {
+	sameCurrency(m, o)
+	return m.Amount > o.Amount
+}
+
+// Float returns the amount in major units, for display or systems that only take decimals.
+func (m Money) Float() float64 {
+	return float64(m.Amount) / minorUnits
+}
+
+// Decimal formats the amount in major units with two decimals, e.g. "18.75".
+func (m Money) Decimal() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/minorUnits, amount%minorUnits)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.currency()
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON reads a decimal number of major units in the default currency. Amounts with
+// more than two decimals are rounded to the nearest minor unit.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("money: amount must be a number: %w", err)
+	}
+	r, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return fmt.Errorf("money: invalid amount %q", n)
+	}
+	r.Mul(r, big.NewRat(minorUnits, 1))
+	amount, ok := ratRound(r)
+	if !ok {
+		return fmt.Errorf("money: amount %s out of range", n)
+	}
+	*m = Cents(amount)
+	return nil
+}
+
+// UnmarshalBSONValue reads {amount, currency} documents, as well as the plain doubles prices
+// were stored as before.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var doc struct {
+			Amount   int64  `bson:"amount"`
+			Currency string `bson:"currency"`
+		}
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		*m = Money{Amount: doc.Amount, Currency: doc.Currency}
+		return nil
+	case bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.Decimal128:
+		var v float64
+		raw := bson.RawValue{Type: t, Value: data}
+		switch t {
+		case bsontype.Double:
+			v = raw.Double()
+		case bsontype.Int32:
+			v = float64(raw.Int32())
+		case bsontype.Int64:
+			v = float64(raw.Int64())
+		case bsontype.Decimal128:
+			f, err := strconv.ParseFloat(raw.Decimal128().String(), 64)
+			if err != nil {
+				return err
+			}
+			v = f
+		}
+		if cents := math.Round(v * minorUnits); math.IsNaN(cents) || cents < math.MinInt64 || cents >= math.MaxInt64 {
+			return fmt.Errorf("money: amount %v out of range", v)
+		}
+		*m = FromFloat(v)
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+		return nil
+	default:
+		return fmt.Errorf("money: cannot decode BSON %s", t)
+	}
+}
+
+// sameCurrency returns the currency shared by both amounts. A zero Money without currency
+// takes the other's, so that sums can start from Money{}.
+func sameCurrency(a, b Money) string {
+	switch {
+	case a.Currency == "":
+		return b.Currency
+	case b.Currency == "" || a.Currency == b.Currency:
+		return a.Currency
+	default:
+		panic(fmt.Sprintf("money: mixing %s and %s", a.Currency, b.Currency))
+	}
+}
+
+// divRound divides, rounding half away from zero.
+func divRound(n, d int64) int64 {
+	q, r := n/d, n%d
+	if 2*abs(r) >= abs(d) {
+		if (n < 0) != (d < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// ratRound rounds r to an integer, half away from zero. It reports false when the result
+// does not fit in an int64.
+func ratRound(r *big.Rat) (int64, bool) {
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, false
+	}
+	return q.Int64(), true
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,179 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPercentRoundsHalfAwayFromZero(t *testing.T) {
+	tests := []struct {
+		amount, pct, want int64
+	}{
+		{1875, 20, 375},
+		{250, 15, 38},   // 37.5
+		{249, 15, 37},   // 37.35
+		{-250, 15, -38}, // -37.5
+		{1, 50, 1},      // 0.5
+		{1, 49, 0},
+	}
+	for _, tt := range tests {
+		if got := Cents(tt.amount).Percent(tt.pct); got.Amount != tt.want {
+			t.Errorf("%d%% of %d = %d, want %d", tt.pct, tt.amount, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMulRoundsToTheNearestCent(t *testing.T) {
+	if got := Cents(1001).Mul(1.5); got.Amount != 1502 {
+		t.Errorf("10.01 × 1.5 = %s, want 15.02", got.Decimal())
+	}
+	if got := Cents(-1001).Mul(1.5); got.Amount != -1502 {
+		t.Errorf("-10.01 × 1.5 = %s, want -15.02", got.Decimal())
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := map[int64]string{0: "0.00", 5: "0.05", 1875: "18.75", -1875: "-18.75", -5: "-0.05"}
+	for amount, want := range tests {
+		if got := Cents(amount).Decimal(); got != want {
+			t.Errorf("Cents(%d).Decimal() = %s, want %s", amount, got, want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, amount := range []int64{0, 1, 1875, -1875, 100000} {
+		data, err := json.Marshal(Cents(amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if got != Cents(amount) {
+			t.Errorf("%d cents came back as %s from %s", amount, got, data)
+		}
+	}
+}
+
+func TestUnmarshalJSONRoundsToTheNearestCent(t *testing.T) {
+	tests := map[string]int64{
+		"18.75":  1875,
+		"18":     1800,
+		"18.745": 1875,
+		"18.744": 1874,
+		"-0.005": -1,
+		"1e2":    10000,
+		// Exact, where a float64 would read 1.0049999.
+		"1.005": 101,
+	}
+	for in, want := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err != nil {
+			t.Errorf("unmarshal %s: %v", in, err)
+			continue
+		}
+		if m != Cents(want) {
+			t.Errorf("%s decoded to %s, want %d cents", in, m, want)
+		}
+	}
+}
+
+func TestUnmarshalJSONRejectsInvalidAmounts(t *testing.T) {
+	for _, in := range []string{`"abc"`, `true`, `{}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err == nil {
+			t.Errorf("%s decoded to %s, want an error", in, m)
+		}
+	}
+}
+
+func TestUnmarshalJSONRejectsOverflow(t *testing.T) {
+	// 2^64 + 150 cents, which would wrap around to 150 cents.
+	for _, in := range []string{"184467440737095517.66", "92233720368547758.08", "-92233720368547758.09", "1e30"} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err == nil {
+			t.Errorf("%s decoded to %s, want an error", in, m)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte("92233720368547758.07"), &m); err != nil || m.Amount != 1<<63-1 {
+		t.Errorf("largest amount decoded to %s, %v", m, err)
+	}
+}
+
+func TestBSONRoundTrip(t *testing.T) {
+	in := struct {
+		Price Money `bson:"price"`
+	}{Price: Cents(1875)}
+	raw, err := bson.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	price, ok := doc["price"].(bson.M)
+	if !ok || price["amount"] != int64(1875) || price["currency"] != DefaultCurrency {
+		t.Errorf("price stored as %v, want {amount: 1875, currency: %s}", doc["price"], DefaultCurrency)
+	}
+
+	var out struct {
+		Price Money `bson:"price"`
+	}
+	if err := bson.Unmarshal(raw, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Price != in.Price {
+		t.Errorf("price came back as %s, want %s", out.Price, in.Price)
+	}
+}
+
+func TestUnmarshalBSONReadsLegacyNumbers(t *testing.T) {
+	tests := []struct {
+		value any
+		want  int64
+	}{
+		{18.75, 1875},
+		{0.1 + 0.2, 30},
+		{18.745, 1875},
+		{int32(18), 1800},
+		{int64(18), 1800},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		raw, err := bson.Marshal(bson.M{"price": tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Price Money `bson:"price"`
+		}
+		if err := bson.Unmarshal(raw, &out); err != nil {
+			t.Errorf("decode %v: %v", tt.value, err)
+			continue
+		}
+		if out.Price.Amount != tt.want {
+			t.Errorf("%v decoded to %d cents, want %d", tt.value, out.Price.Amount, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalBSONRejectsOverflow(t *testing.T) {
+	raw, err := bson.Marshal(bson.M{"price": 1e18})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Price Money `bson:"price"`
+	}
+	if err := bson.Unmarshal(raw, &out); err == nil {
+		t.Errorf("1e18 decoded to %s, want an error", out.Price)
+	}
+}
@@ -0,0 +1,131 @@
+package payouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"rides/internal/clock"
+	"rides/internal/database"
+	"rides/internal/ledger"
+	"rides/internal/money"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Generator issues weekly payout statements: once a week is over, every driver who earned
+// something during it gets a statement of their earnings and the amount paid out to them.
+type Generator struct {
+	db    *database.Database
+	clock clock.Clock
+}
+
+func NewGenerator(db *database.Database, clk clock.Clock) *Generator {
+	return &Generator{db: db, clock: clk}
+}
+
+// Generate issues the statements of the week starting at weekStart, which must be over. Drivers
+// whose statement was already issued are skipped, so it can safely run again. It returns the
+// statements it issued.
+func (g *Generator) Generate(ctx context.Context, weekStart time.Time) ([]types.Statement, error) {
+	weekStart = ledger.WeekStart(weekStart)
+	weekEnd := weekStart.AddDate(0, 0, 7)
+	if g.clock.Now().Before(weekEnd) {
+		return nil, fmt.Errorf("week of %s is not over", weekStart.Format(time.DateOnly))
+	}
+
+	drivers, err := g.db.ListEarningDrivers(ctx, weekStart, weekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []types.Statement{}
+	for _, driverID := range drivers {
+		statement, err := g.generate(ctx, driverID, weekStart, weekEnd)
+		if errors.Is(err, database.ErrStatementExists) {
+			continue
+		}
+		if err != nil {
+			return statements, fmt.Errorf("driver %s: %w", driverID, err)
+		}
+		statements = append(statements, *statement)
+	}
+	return statements, nil
+}
+
+func (g *Generator) generate(ctx context.Context, driverID string, weekStart, weekEnd time.Time) (*types.Statement, error) {
+	txs, err := g.db.ListTransactions(ctx, driverID, weekStart, weekEnd)
+	if err != nil {
+		return nil, err
+	}
+	summary := ledger.Summarize(driverID, txs)
+	earnings := 0
+	for _, tx := range txs {
+		if tx.Kind != types.TransactionPayout {
+			earnings++
+		}
+	}
+
+	// A negative balance left by the previous statement is deducted from this one.
+	var carriedOver money.Money
+	previous, err := g.db.GetPreviousStatement(ctx, driverID, weekStart)
+	switch {
+	case err == nil:
+		carriedOver = previous.Remainder
+	case err != mongo.ErrNoDocuments:
+		return nil, err
+	}
+
+	statement := &types.Statement{
+		DriverID:     driverID,
+		PeriodStart:  weekStart,
+		PeriodEnd:    weekEnd,
+		Summary:      summary,
+		CarriedOver:  carriedOver,
+		Transactions: earnings,
+		CreatedAt:    g.clock.Now(),
+	}
+	due := summary.Net.Add(carriedOver)
+	if due.IsPositive() {
+		statement.Payout = due
+	} else {
+		statement.Remainder = due
+	}
+
+	// The payout is posted first: its reference identifies the statement, so a statement
+	// that failed to be stored is posted once when generated again.
+	if statement.Payout.IsPositive() {
+		reference := fmt.Sprintf("%s:%s", driverID, weekStart.Format(time.DateOnly))
+		if err := g.db.PostTransaction(ctx, ledger.Payout(driverID, reference, statement.Payout, statement.CreatedAt)); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.db.CreateStatement(ctx, statement); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[PAYOUT] Relevé du chauffeur %s pour la semaine du %s: %s", driverID, weekStart.Format(time.DateOnly), statement.Payout)
+	return statement, nil
+}
+
+// Run issues the statements of the last week over on every tick, until ctx is cancelled.
+func (g *Generator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tickCtx, cancel := context.WithTimeout(ctx, interval)
+			lastWeek := ledger.WeekStart(g.clock.Now()).AddDate(0, 0, -7)
+			if _, err := g.Generate(tickCtx, lastWeek); err != nil {
+				log.Printf("[ERROR] Failed to generate payout statements: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package pricing
+
+import (
+	"math"
+	"rides/internal/money"
+	"rides/internal/zones"
+)
+
+// Fare components, in cents of the default currency.
+const (
+	baseFare      = 350
+	perKmRate     = 175
+	perMinuteRate = 30
+	bookingFee    = 150
+
+	// averageSpeedKmh converts a route's distance into its estimated duration.
+	averageSpeedKmh = 30.0
+
+	// PoolDiscountPercent is the share of the fare taken off for passengers of a pooled ride.
+	PoolDiscountPercent = 25
+)
+
+// Sales taxes charged on every fare, in percent of the subtotal.
+var taxes = []struct {
+	name string
+	rate float64
+}{
+	{"GST", 5},
+	{"QST", 9.975},
+}
+
+// Breakdown itemizes how a fare is computed: the base, distance and time components, scaled
+// by the surge multiplier, plus the booking fee, minus discounts, make the subtotal on which
+// taxes are added.
+type Breakdown struct {
+	DistanceKm      float64     `bson:"distance_km" json:"distanceKm"`
+	DurationMin     float64     `bson:"duration_min" json:"durationMin"`
+	BaseFare        money.Money `bson:"base_fare" json:"baseFare"`
+	DistanceFare    money.Money `bson:"distance_fare" json:"distanceFare"`
+	TimeFare        money.Money `bson:"time_fare" json:"timeFare"`
+	SurgeMultiplier float64     `bson:"surge_multiplier" json:"surgeMultiplier"`
+	Surge           money.Money `bson:"surge" json:"surge"`
+	BookingFee      money.Money `bson:"booking_fee" json:"bookingFee"`
+	Discounts       []Discount  `bson:"discounts,omitempty" json:"discounts,omitempty"`
+	Subtotal        money.Money `bson:"subtotal" json:"subtotal"`
+	Taxes           []Tax       `bson:"taxes" json:"taxes"`
+	Total           money.Money `bson:"total" json:"total"`
+}
+
+// Discount is an amount taken off a fare before taxes: either a Percent of the fare without the
+// booking fee, recomputed whenever the fare changes, or a Fixed amount. Amount is what was
+// actually taken off: the booking fee is always charged, so discounts never bring the subtotal
+// below it.
+type Discount struct {
+	Label   string      `bson:"label" json:"label"`
+	Percent int64       `bson:"percent,omitempty" json:"percent,omitempty"`
+	Fixed   money.Money `bson:"fixed,omitempty" json:"fixed,omitzero"`
+	Amount  money.Money `bson:"amount" json:"amount"`
+}
+
+// Tax is a sales tax charged on the subtotal.
+type Tax struct {
+	Name   string      `bson:"name" json:"name"`
+	Rate   float64     `bson:"rate" json:"rate"`
+	Amount money.Money `bson:"amount" json:"amount"`
+}
+
+// Price computes the fare between two catalog zones.
+func Price(from, to string) Breakdown {
+	return PriceRoute([]string{from, to})
+}
+
+// Route returns the ordered zones of a trip from one zone to another through the via zones.
+func Route(from string, via []string, to string) []string {
+	route := make([]string, 0, len(via)+2)
+	route = append(route, from)
+	route = append(route, via...)
+	return append(route, to)
+}
+
+// PriceRoute computes the fare of a route through the given catalog zones, in order. The
+// distance and time components sum every leg; the base fare and booking fee are charged once.
+func PriceRoute(route []string) Breakdown {
+	var distance float64
+	for i := 1; i < len(route); i++ {
+		distance += zones.DistanceKm(route[i-1], route[i])
+	}
+	duration := distance / averageSpeedKmh * 60
+
+	b := Breakdown{
+		DistanceKm:      round2(distance),
+		DurationMin:     round2(duration),
+		BaseFare:        money.Cents(baseFare),
+		DistanceFare:    money.Cents(perKmRate).Mul(distance),
+		TimeFare:        money.Cents(perMinuteRate).Mul(duration),
+		SurgeMultiplier: 1,
+		BookingFee:      money.Cents(bookingFee),
+	}
+	b.finalize()
+	return b
+}
+
+// Pool returns the breakdown with the pool discount applied.
+func (b Breakdown) Pool() Breakdown {
+	return b.WithDiscount(Discount{Label: "Pool discount", Percent: PoolDiscountPercent})
+}
+
+// WithDiscount returns the breakdown with the discount applied after the existing ones.
+func (b Breakdown) WithDiscount(d Discount) Breakdown {
+	b.Discounts = append(append([]Discount(nil), b.Discounts...), d)
+	b.finalize()
+	return b
+}
+
+// Reprice returns the breakdown of a ride whose route changed from oldRoute to newRoute. Only
+// the difference between both routes is applied, so a price locked by a quote stays honoured
+// for the part of the route it covered.
+func Reprice(b Breakdown, oldRoute, newRoute []string) Breakdown {
+	before, after := PriceRoute(oldRoute), PriceRoute(newRoute)
+
+	b.DistanceKm = round2(b.DistanceKm + after.DistanceKm - before.DistanceKm)
+	b.DurationMin = round2(b.DurationMin + after.DurationMin - before.DurationMin)
+	b.DistanceFare = b.DistanceFare.Add(after.DistanceFare).Sub(before.DistanceFare)
+	b.TimeFare = b.TimeFare.Add(after.TimeFare).Sub(before.TimeFare)
+	b.Discounts = append([]Discount(nil), b.Discounts...)
+	b.finalize()
+	return b
+}
+
+// finalize derives the surge, percentage discounts, subtotal, taxes and total from the fare
+// components.
+func (b *Breakdown) finalize() {
+	fare := b.BaseFare.Add(b.DistanceFare).Add(b.TimeFare)
+	b.Surge = fare.Mul(b.SurgeMultiplier - 1)
+	fare = fare.Add(b.Surge)
+
+	subtotal := fare.Add(b.BookingFee)
+	for i, d := range b.Discounts {
+		switch {
+		case d.Percent > 0:
+			d.Amount = fare.Percent(d.Percent)
+		case !d.Fixed.IsZero():
+			d.Amount = d.Fixed
+		}
+		if limit := subtotal.Sub(b.BookingFee); d.Amount.GreaterThan(limit) {
+			d.Amount = limit
+		}
+		b.Discounts[i] = d
+		subtotal = subtotal.Sub(d.Amount)
+	}
+	b.Subtotal = subtotal
+
+	b.Total = subtotal
+	b.Taxes = make([]Tax, 0, len(taxes))
+	for _, t := range taxes {
+		amount := subtotal.Mul(t.rate / 100)
+		b.Taxes = append(b.Taxes, Tax{Name: t.name, Rate: t.rate, Amount: amount})
+		b.Total = b.Total.Add(amount)
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,75 @@
+package pricing
+
+import (
+	"rides/internal/money"
+	"testing"
+)
+
+// beforeFee is the part of the fare that percentage discounts apply to.
+func beforeFee(b Breakdown) money.Money {
+	return b.BaseFare.Add(b.DistanceFare).Add(b.TimeFare).Add(b.Surge)
+}
+
+func TestPercentDiscountExcludesBookingFee(t *testing.T) {
+	fare := Price("downtown", "airport")
+	discounted := fare.WithDiscount(Discount{Label: "Promo", Percent: 20})
+
+	want := beforeFee(fare).Percent(20)
+	if got := discounted.Discounts[0].Amount; got != want {
+		t.Errorf("discount = %s, want %s (20%% of %s, booking fee excluded)", got, want, beforeFee(fare))
+	}
+	if got := discounted.Subtotal; got != fare.Subtotal.Sub(want) {
+		t.Errorf("subtotal = %s, want %s", got, fare.Subtotal.Sub(want))
+	}
+}
+
+func TestPoolDiscountExcludesBookingFee(t *testing.T) {
+	fare := Price("downtown", "suburbs")
+	pool := fare.Pool()
+
+	want := beforeFee(fare).Percent(PoolDiscountPercent)
+	if got := pool.Discounts[0].Amount; got != want {
+		t.Errorf("pool discount = %s, want %s", got, want)
+	}
+}
+
+func TestPercentDiscountsApplyToTheSameFare(t *testing.T) {
+	fare := Price("downtown", "airport")
+	discounted := fare.Pool().WithDiscount(Discount{Label: "Promo", Percent: 10})
+
+	if got, want := discounted.Discounts[1].Amount, beforeFee(fare).Percent(10); got != want {
+		t.Errorf("second discount = %s, want %s", got, want)
+	}
+}
+
+func TestDiscountsNeverWaiveBookingFee(t *testing.T) {
+	fare := Price("downtown", "airport")
+
+	for _, d := range []Discount{
+		{Label: "Free ride", Percent: 100},
+		{Label: "Voucher", Fixed: fare.Subtotal.Add(money.Cents(1000))},
+	} {
+		discounted := fare.WithDiscount(d)
+		if got := discounted.Subtotal; got != fare.BookingFee {
+			t.Errorf("%s: subtotal = %s, want the booking fee %s", d.Label, got, fare.BookingFee)
+		}
+		if got, want := discounted.Discounts[0].Amount, beforeFee(fare); got != want {
+			t.Errorf("%s: discount = %s, want %s", d.Label, got, want)
+		}
+	}
+}
+
+func TestTaxesApplyToDiscountedSubtotal(t *testing.T) {
+	discounted := Price("downtown", "airport").WithDiscount(Discount{Label: "Promo", Percent: 20})
+
+	total := discounted.Subtotal
+	for _, tax := range discounted.Taxes {
+		total = total.Add(tax.Amount)
+	}
+	if discounted.Total != total {
+		t.Errorf("total = %s, want subtotal plus taxes %s", discounted.Total, total)
+	}
+	if gst := discounted.Taxes[0]; gst.Amount != discounted.Subtotal.Mul(gst.Rate/100) {
+		t.Errorf("%s = %s, want %.2f%% of %s", gst.Name, gst.Amount, gst.Rate, discounted.Subtotal)
+	}
+}
@@ -0,0 +1,133 @@
+package pricing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rides/internal/clock"
+	"rides/internal/money"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrQuoteInvalid = errors.New("invalid quote")
+	ErrQuoteExpired = errors.New("quote expired")
+)
+
+// Quote is a fare offer for a route, valid until ExpiresAt. Its ID is a signed token
+// carrying the whole quote, so it can be checked without storing it.
+type Quote struct {
+	ID        string      `json:"id"`
+	FromZone  string      `json:"from_zone"`
+	Via       []string    `json:"via,omitempty"`
+	ToZone    string      `json:"to_zone"`
+	Price     money.Money `json:"price"`
+	Breakdown Breakdown   `json:"breakdown"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+type quotePayload struct {
+	Nonce     string    `json:"n"`
+	FromZone  string    `json:"f"`
+	Via       []string  `json:"v,omitempty"`
+	ToZone    string    `json:"t"`
+	Breakdown Breakdown `json:"b"`
+	ExpiresAt time.Time `json:"e"`
+}
+
+type QuoteSigner struct {
+	key   []byte
+	ttl   time.Duration
+	clock clock.Clock
+}
+
+func NewQuoteSigner(key []byte, ttl time.Duration, clk clock.Clock) *QuoteSigner {
+	return &QuoteSigner{key: key, ttl: ttl, clock: clk}
+}
+
+// Issue prices the trip from one zone to another through the via zones and returns a quote
+// locking that price for the signer's TTL.
+func (s *QuoteSigner) Issue(from string, via []string, to string) (*Quote, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate quote nonce: %w", err)
+	}
+
+	payload := quotePayload{
+		Nonce:     hex.EncodeToString(nonce),
+		FromZone:  from,
+		Via:       via,
+		ToZone:    to,
+		Breakdown: PriceRoute(Route(from, via, to)),
+		ExpiresAt: s.clock.Now().Add(s.ttl).UTC().Truncate(time.Second),
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal quote: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	token := encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded))
+
+	return payload.quote(token), nil
+}
+
+// Verify checks the quote's signature and expiry and returns the quote it carries.
+func (s *QuoteSigner) Verify(token string) (*Quote, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrQuoteInvalid
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.sign(encoded)) {
+		return nil, ErrQuoteInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrQuoteInvalid
+	}
+
+	var payload quotePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrQuoteInvalid
+	}
+
+	if !s.clock.Now().Before(payload.ExpiresAt) {
+		return nil, ErrQuoteExpired
+	}
+
+	return payload.quote(token), nil
+}
+
+func (s *QuoteSigner) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+func (p quotePayload) quote(token string) *Quote {
+	return &Quote{
+		ID:        token,
+		FromZone:  p.FromZone,
+		Via:       p.Via,
+		ToZone:    p.ToZone,
+		Price:     p.Breakdown.Total,
+		Breakdown: p.Breakdown,
+		ExpiresAt: p.ExpiresAt,
+	}
+}
+
+// Matches reports whether the quote was issued for exactly this route.
+func (q *Quote) Matches(route []string) bool {
+	return slices.Equal(Route(q.FromZone, q.Via, q.ToZone), route)
+}
@@ -0,0 +1,94 @@
+package ratings
+
+import (
+	"context"
+	"errors"
+	"log"
+	"rides/internal/clock"
+	"rides/internal/database"
+	"rides/internal/services"
+	"rides/internal/types"
+	"time"
+)
+
+const (
+	// retryDelay leaves the request that recorded a rating time to apply it before Run does.
+	retryDelay = time.Minute
+	// maxRatingsPerRun bounds how many ratings a run applies.
+	maxRatingsPerRun = 200
+)
+
+// Applier adds ratings to the averages the users service keeps for drivers and passengers.
+// A rating is applied as soon as it is recorded; the ones the users service could not take
+// then are applied again by Run until it does.
+type Applier struct {
+	db    *database.Database
+	users *services.UserService
+	clock clock.Clock
+}
+
+func NewApplier(db *database.Database, users *services.UserService, clk clock.Clock) *Applier {
+	return &Applier{db: db, users: users, clock: clk}
+}
+
+// Apply adds the rating to the ratee's average and records that it was applied.
+func (a *Applier) Apply(ctx context.Context, rating *types.Rating) error {
+	var err error
+	if rating.RatedBy == types.RatedByPassenger {
+		err = a.users.RateDriver(rating.RateeID, rating.ID.Hex(), rating.Score)
+	} else {
+		err = a.users.RatePassenger(rating.RateeID, rating.ID.Hex(), rating.Score)
+	}
+	if errors.Is(err, services.ErrRateeNotFound) {
+		// There is no average left to update.
+		log.Printf("[WARN] Rating %s of %s not applied: %v", rating.ID.Hex(), rating.RateeID, err)
+	} else if err != nil {
+		return err
+	}
+
+	if err := a.db.MarkRatingApplied(ctx, rating.ID); err != nil {
+		return err
+	}
+	rating.Applied = true
+	return nil
+}
+
+// ApplyPending applies the ratings left unapplied, oldest first, and returns how many it
+// applied. It stops at the first failure, which is most likely the users service being down.
+func (a *Applier) ApplyPending(ctx context.Context) (int, error) {
+	pending, err := a.db.ListUnappliedRatings(ctx, a.clock.Now().Add(-retryDelay), maxRatingsPerRun)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for i := range pending {
+		if err := a.Apply(ctx, &pending[i]); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	if applied > 0 {
+		log.Printf("[UPDATE] %d note(s) reportée(s) sur les moyennes", applied)
+	}
+	return applied, nil
+}
+
+// Run applies the pending ratings every interval until ctx is cancelled.
+func (a *Applier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tickCtx, cancel := context.WithTimeout(ctx, interval)
+			if _, err := a.ApplyPending(tickCtx); err != nil {
+				log.Printf("[WARN] Failed to apply pending ratings: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package receipt
+
+import (
+	"html/template"
+	"io"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Parse(`<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; color: #222; }
+table { width: 100%; border-collapse: collapse; margin-bottom: .5em; }
+td { padding: .2em 0; }
+td.amount { text-align: right; white-space: nowrap; }
+tr.total td { font-weight: bold; border-top: 1px solid #999; }
+.details, .payment { color: #666; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<dl>
+{{- range .Header}}
+<dt>{{.Label}}</dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+{{- range .Sections}}
+<section>
+<h2>{{.Title}}</h2>
+{{- if .Details}}
+<p class="details">{{.Details}}</p>
+{{- end}}
+<table>
+{{- range .Lines}}
+<tr{{if .Total}} class="total"{{end}}><td>{{.Label}}</td><td class="amount">{{.Amount}}</td></tr>
+{{- end}}
+</table>
+{{- if .Payment.Value}}
+<p class="payment">{{.Payment.Label}}: {{.Payment.Value}}</p>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML renders the receipt as a standalone HTML page.
+func WriteHTML(w io.Writer, r *Receipt) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,110 @@
+package receipt
+
+import (
+	"rides/internal/money"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Language is the language a receipt is worded and formatted in.
+type Language string
+
+const (
+	English Language = "en"
+	French  Language = "fr"
+)
+
+// messages are the words of a receipt in one language.
+type messages struct {
+	receipt, ride, date, driver, passenger, payment                       string
+	details, baseFare, distance, time, surge, bookingFee, subtotal, total string
+	tax, fare, tip, poolDiscount, promo                                   string
+	taxes                                                                 map[string]string
+}
+
+var translations = map[Language]*messages{
+	English: {
+		receipt: "Receipt", ride: "Ride", date: "Date", driver: "Driver", passenger: "Passenger", payment: "Payment",
+		details:  "Distance: %s km, estimated duration: %s min",
+		baseFare: "Base fare", distance: "Distance", time: "Time", surge: "Surge (x%s)",
+		bookingFee: "Booking fee", subtotal: "Subtotal", total: "Total",
+		tax: "%s (%s%%)", fare: "Fare", tip: "Tip", poolDiscount: "Pool discount", promo: "Promo",
+	},
+	French: {
+		receipt: "Reçu", ride: "Course", date: "Date", driver: "Chauffeur", passenger: "Passager", payment: "Paiement",
+		details:  "Distance : %s km, durée estimée : %s min",
+		baseFare: "Prise en charge", distance: "Distance", time: "Temps", surge: "Majoration (x%s)",
+		bookingFee: "Frais de réservation", subtotal: "Sous-total", total: "Total",
+		tax: "%s (%s %%)", fare: "Prix", tip: "Pourboire", poolDiscount: "Rabais covoiturage", promo: "Code promo",
+		taxes: map[string]string{"GST": "TPS", "QST": "TVQ"},
+	},
+}
+
+// ParseLanguage picks the receipt language preferred by an Accept-Language header, English
+// when it accepts neither English nor French.
+func ParseLanguage(acceptLanguage string) Language {
+	best, bestQ := English, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if lang := Language(primary); translations[lang] != nil && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+func (l Language) messages() *messages {
+	if t := translations[l]; t != nil {
+		return t
+	}
+	return translations[English]
+}
+
+// number formats a decimal number with the language's decimal separator.
+func (l Language) number(s string) string {
+	if l == French {
+		return strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
+
+// amount formats an amount and its currency, e.g. "43.47 CAD" or "43,47 CAD".
+func (l Language) amount(m money.Money) string {
+	return l.number(m.String())
+}
+
+func (l Language) date(t time.Time) string {
+	if l == French {
+		return t.UTC().Format("02/01/2006 15:04") + " UTC"
+	}
+	return t.UTC().Format("2006-01-02 15:04") + " UTC"
+}
+
+func (l Language) tax(name string) string {
+	if translated, ok := l.messages().taxes[name]; ok {
+		return translated
+	}
+	return name
+}
+
+// discount translates the labels given to discounts by pricing and promotions.
+func (l Language) discount(label string) string {
+	t := l.messages()
+	if label == translations[English].poolDiscount {
+		return t.poolDiscount
+	}
+	if code, ok := strings.CutPrefix(label, translations[English].promo+" "); ok {
+		return t.promo + " " + code
+	}
+	return label
+}
@@ -0,0 +1,148 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Page layout of PDF receipts, in points: A4 pages with the body set in Courier, whose glyphs
+// are all pdfCharWidth wide at pdfFontSize so that amounts can be right-aligned.
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+	pdfFontSize   = 10
+	pdfCharWidth  = 6
+	pdfLeading    = 14
+	pdfTitleSize  = 16
+)
+
+// pdfText is a line of text placed on a page.
+type pdfText struct {
+	font string
+	size int
+	x, y int
+	text string
+}
+
+// WritePDF renders the receipt as a PDF document, using only the standard PDF fonts so that
+// nothing needs to be embedded.
+func WritePDF(w io.Writer, r *Receipt) error {
+	var pages [][]pdfText
+	var page []pdfText
+	y := pdfPageHeight - pdfMargin
+
+	add := func(font string, size, x int, text string) {
+		page = append(page, pdfText{font: font, size: size, x: x, y: y, text: text})
+	}
+	next := func(advance int) {
+		y -= advance
+		if y < pdfMargin {
+			pages = append(pages, page)
+			page, y = nil, pdfPageHeight-pdfMargin
+		}
+	}
+	right := func(text string) int {
+		return pdfPageWidth - pdfMargin - len([]rune(text))*pdfCharWidth
+	}
+
+	add("F2", pdfTitleSize, pdfMargin, r.Title)
+	next(2 * pdfLeading)
+	for _, f := range r.Header {
+		add("F1", pdfFontSize, pdfMargin, f.Label+": "+f.Value)
+		next(pdfLeading)
+	}
+	for _, s := range r.Sections {
+		next(pdfLeading)
+		add("F2", pdfFontSize+1, pdfMargin, s.Title)
+		next(pdfLeading)
+		if s.Details != "" {
+			add("F1", pdfFontSize, pdfMargin, s.Details)
+			next(pdfLeading)
+		}
+		for _, l := range s.Lines {
+			font := "F1"
+			if l.Total {
+				font = "F3"
+			}
+			add(font, pdfFontSize, pdfMargin+2*pdfCharWidth, l.Label)
+			add(font, pdfFontSize, right(l.Amount), l.Amount)
+			next(pdfLeading)
+		}
+		if s.Payment.Value != "" {
+			add("F1", pdfFontSize, pdfMargin, s.Payment.Label+": "+s.Payment.Value)
+			next(pdfLeading)
+		}
+	}
+	if len(page) > 0 {
+		pages = append(pages, page)
+	}
+
+	return writePDFDocument(w, pages)
+}
+
+// writePDFDocument writes the pages as a PDF file: the catalog, the page tree, the fonts, then
+// every page and its content stream, followed by the cross-reference table.
+func writePDFDocument(w io.Writer, pages [][]pdfText) error {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	const firstPage = 6
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		for _, t := range page {
+			fmt.Fprintf(&content, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", t.font, t.size, t.x, t.y, pdfString(t.text))
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// pdfString encodes text for a PDF string literal in WinAnsiEncoding, which covers the
+// accented letters of French; other characters are replaced by '?'.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x80:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
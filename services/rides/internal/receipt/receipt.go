@@ -0,0 +1,137 @@
+package receipt
+
+import (
+	"fmt"
+	"rides/internal/money"
+	"rides/internal/pricing"
+	"rides/internal/types"
+	"strings"
+)
+
+// Receipt is the receipt of a completed ride, already worded and formatted in its language, so
+// that the text, HTML and PDF renderings only lay it out.
+type Receipt struct {
+	Language Language
+	Title    string
+	Header   []Field
+	Sections []Section
+}
+
+// Field is a labelled value of a receipt's header or of a section.
+type Field struct {
+	Label string
+	Value string
+}
+
+// Section is what one passenger was charged: their route, each line of their fare and their
+// tips, and the payment they were charged through.
+type Section struct {
+	Title   string
+	Details string
+	Lines   []Line
+	Payment Field
+}
+
+// Line is one amount of a section. Total lines are emphasized.
+type Line struct {
+	Label  string
+	Amount string
+	Total  bool
+}
+
+// New builds the receipt of the ride in the language. On a pooled ride, only the passenger's
+// own section is included when passengerID is set, every passenger's otherwise.
+func New(ride *types.Ride, passengerID string, lang Language) *Receipt {
+	t := lang.messages()
+	date := ride.CreatedAt
+	if ride.CompletedAt != nil {
+		date = *ride.CompletedAt
+	}
+
+	r := &Receipt{
+		Language: lang,
+		Title:    t.receipt,
+		Header: []Field{
+			{t.ride, ride.ID.Hex()},
+			{t.date, lang.date(date)},
+		},
+	}
+	if ride.DriverID != "" {
+		r.Header = append(r.Header, Field{t.driver, ride.DriverID})
+	}
+
+	if ride.Mode == types.ModePool {
+		for _, p := range ride.Passengers {
+			if passengerID != "" && p.PassengerID != passengerID {
+				continue
+			}
+			s := newSection(lang, p.PassengerID, []string{p.FromZone, p.ToZone}, p.Fare, p.Price, p.PaymentID)
+			s.Lines = append(s.Lines, tipLines(lang, ride.Tips, p.PassengerID)...)
+			r.Sections = append(r.Sections, s)
+		}
+		return r
+	}
+
+	route := []string{ride.FromZone, ride.ToZone}
+	if len(ride.Stops) > 0 {
+		route = make([]string, len(ride.Stops))
+		for i, stop := range ride.Stops {
+			route[i] = stop.Zone
+		}
+	}
+	s := newSection(lang, ride.PassengerID, route, ride.Fare, ride.Price, ride.PaymentID)
+	s.Lines = append(s.Lines, tipLines(lang, ride.Tips, ride.PassengerID)...)
+	r.Sections = append(r.Sections, s)
+	return r
+}
+
+// HasPassenger reports whether the receipt includes a section for at least one passenger.
+func (r *Receipt) HasPassenger() bool {
+	return len(r.Sections) > 0
+}
+
+// newSection lists the lines of a passenger's fare breakdown. Rides priced before fares were
+// itemized only show their total.
+func newSection(lang Language, passengerID string, route []string, fare *pricing.Breakdown, price money.Money, paymentID string) Section {
+	t := lang.messages()
+	s := Section{
+		Title:   fmt.Sprintf("%s %s: %s", t.passenger, passengerID, strings.Join(route, " -> ")),
+		Payment: Field{t.payment, paymentID},
+	}
+	if fare == nil {
+		s.Lines = []Line{{Label: t.fare, Amount: lang.amount(price), Total: true}}
+		return s
+	}
+
+	s.Details = fmt.Sprintf(t.details, lang.number(fmt.Sprintf("%.2f", fare.DistanceKm)), lang.number(fmt.Sprintf("%.0f", fare.DurationMin)))
+	s.Lines = append(s.Lines,
+		Line{Label: t.baseFare, Amount: lang.amount(fare.BaseFare)},
+		Line{Label: t.distance, Amount: lang.amount(fare.DistanceFare)},
+		Line{Label: t.time, Amount: lang.amount(fare.TimeFare)},
+	)
+	if !fare.Surge.IsZero() {
+		s.Lines = append(s.Lines, Line{Label: fmt.Sprintf(t.surge, lang.number(fmt.Sprintf("%.2f", fare.SurgeMultiplier))), Amount: lang.amount(fare.Surge)})
+	}
+	s.Lines = append(s.Lines, Line{Label: t.bookingFee, Amount: lang.amount(fare.BookingFee)})
+	for _, d := range fare.Discounts {
+		s.Lines = append(s.Lines, Line{Label: lang.discount(d.Label), Amount: lang.amount(d.Amount.Mul(-1))})
+	}
+	s.Lines = append(s.Lines, Line{Label: t.subtotal, Amount: lang.amount(fare.Subtotal)})
+	for _, tax := range fare.Taxes {
+		label := fmt.Sprintf(t.tax, lang.tax(tax.Name), lang.number(fmt.Sprintf("%g", tax.Rate)))
+		s.Lines = append(s.Lines, Line{Label: label, Amount: lang.amount(tax.Amount)})
+	}
+	s.Lines = append(s.Lines, Line{Label: t.total, Amount: lang.amount(fare.Total), Total: true})
+	return s
+}
+
+// tipLines lists the passenger's captured tips; tips whose payment failed were not charged.
+func tipLines(lang Language, tips []types.Tip, passengerID string) []Line {
+	var lines []Line
+	for _, tip := range tips {
+		if tip.PassengerID == passengerID && tip.PaymentStatus == "CAPTURED" {
+			lines = append(lines, Line{Label: lang.messages().tip, Amount: lang.amount(tip.Amount)})
+		}
+	}
+	return lines
+}
@@ -0,0 +1,37 @@
+package receipt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText renders the receipt as plain text, amounts right-aligned in a fixed-width column.
+func WriteText(w io.Writer, r *Receipt) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\n", r.Title)
+	for _, f := range r.Header {
+		fmt.Fprintf(&b, "%s: %s\n", f.Label, f.Value)
+	}
+	for _, s := range r.Sections {
+		fmt.Fprintf(&b, "\n%s\n", s.Title)
+		if s.Details != "" {
+			fmt.Fprintf(&b, "%s\n", s.Details)
+		}
+		for _, l := range s.Lines {
+			line(&b, l.Label, l.Amount)
+		}
+		if s.Payment.Value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", s.Payment.Label, s.Payment.Value)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// line writes a label and its amount, right-aligned in a fixed-width column.
+func line(w io.Writer, label, amount string) {
+	fmt.Fprintf(w, "  %-28s %14s\n", label, amount)
+}
@@ -0,0 +1,259 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"log"
+	"rides/internal/clock"
+	"rides/internal/database"
+	"rides/internal/ledger"
+	"rides/internal/money"
+	"rides/internal/pricing"
+	"rides/internal/services"
+	"rides/internal/types"
+	"time"
+)
+
+const (
+	// settleDelay leaves a completed ride's payments time to be queued for capture before the
+	// ride is reconciled.
+	settleDelay = 2 * time.Minute
+	// maxRidesPerRun bounds how many rides a run reconciles. Runs go through the unsettled
+	// rides oldest first, each resuming where the previous one stopped.
+	maxRidesPerRun = 500
+)
+
+// Reconciler settles the payments of completed rides that were not recorded as captured and
+// are not queued for capture, e.g. captures the queue gave up on or tips whose charge failed.
+// It checks each payment's real state at the payment service: payments found captured are
+// recorded as such, authorized ones are captured again, and whatever cannot be settled is
+// reported as a discrepancy.
+type Reconciler struct {
+	db                *database.Database
+	payments          *services.PaymentService
+	clock             clock.Clock
+	commissionPercent int64
+}
+
+func NewReconciler(db *database.Database, payments *services.PaymentService, clk clock.Clock, commissionPercent int64) *Reconciler {
+	return &Reconciler{db: db, payments: payments, clock: clk, commissionPercent: commissionPercent}
+}
+
+// charge is one payment of a completed ride: an exclusive ride's fare, a pooled passenger's
+// fare, or a tip.
+type charge struct {
+	ride        *types.Ride
+	passengerID string
+	kind        string
+	paymentID   string
+	status      string
+	amount      money.Money
+	fare        *pricing.Breakdown
+}
+
+// Reconcile reconciles the rides completed before the settle delay and stores the report of
+// the run.
+func (rc *Reconciler) Reconcile(ctx context.Context) (*types.ReconciliationReport, error) {
+	report := &types.ReconciliationReport{
+		StartedAt:     rc.clock.Now(),
+		Discrepancies: []types.Discrepancy{},
+	}
+
+	var after *types.RideCursor
+	previous, err := rc.db.ListReconciliationReports(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(previous) > 0 {
+		after = previous[0].Next
+	}
+
+	rides, err := rc.db.ListUnsettledRides(ctx, report.StartedAt.Add(-settleDelay), after, maxRidesPerRun)
+	if err != nil {
+		return nil, err
+	}
+	report.Rides = len(rides)
+	if len(rides) == maxRidesPerRun {
+		last := rides[len(rides)-1]
+		report.Next = &types.RideCursor{CompletedAt: *last.CompletedAt, RideID: last.ID}
+	}
+
+	for i := range rides {
+		rc.reconcileRide(ctx, &rides[i], report)
+	}
+
+	report.FinishedAt = rc.clock.Now()
+	if err := rc.db.CreateReconciliationReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	if report.Checked > 0 {
+		log.Printf("[RECONCILE] %d paiement(s) vérifié(s): %d capturé(s), %d déjà capturé(s), %d écart(s)",
+			report.Checked, report.Captured, report.Synced, len(report.Discrepancies))
+	}
+	return report, nil
+}
+
+func (rc *Reconciler) reconcileRide(ctx context.Context, ride *types.Ride, report *types.ReconciliationReport) {
+	var charges []charge
+	if ride.Mode == types.ModePool {
+		for _, p := range ride.Passengers {
+			charges = append(charges, charge{ride, p.PassengerID, services.PaymentKindFare, p.PaymentID, p.PaymentStatus, p.Price, p.Fare})
+		}
+	} else {
+		charges = append(charges, charge{ride, ride.PassengerID, services.PaymentKindFare, ride.PaymentID, ride.PaymentStatus, ride.Price, ride.Fare})
+	}
+
+	captured := 0
+	for _, c := range charges {
+		if c.status == "CAPTURED" {
+			captured++
+			continue
+		}
+		if rc.queued(ctx, c) {
+			continue
+		}
+		if rc.settle(ctx, c, report) {
+			captured++
+		}
+	}
+	if ride.PaymentStatus != "CAPTURED" && captured == len(charges) {
+		if err := rc.db.UpdateRidePaymentStatus(ctx, ride.ID, "CAPTURED"); err != nil {
+			log.Printf("[ERROR] Failed to update payment status of ride %s: %v", ride.ID.Hex(), err)
+		}
+	}
+
+	for _, tip := range ride.Tips {
+		if tip.PaymentStatus == "CAPTURED" {
+			continue
+		}
+		// A tip still being charged is left alone.
+		if tip.PaymentID == "" && tip.CreatedAt.After(report.StartedAt.Add(-settleDelay)) {
+			continue
+		}
+		rc.settle(ctx, charge{ride, tip.PassengerID, services.PaymentKindTip, tip.PaymentID, tip.PaymentStatus, tip.Amount, nil}, report)
+	}
+}
+
+// queued reports whether a fare is still queued for capture, in which case it is left to the
+// capture queue. Captures the queue gave up on are reconciled like any other.
+func (rc *Reconciler) queued(ctx context.Context, c charge) bool {
+	if c.paymentID == "" {
+		return false
+	}
+	queued, err := rc.db.CaptureQueued(ctx, c.paymentID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check capture queue for payment %s: %v", c.paymentID, err)
+		return true
+	}
+	return queued
+}
+
+// settle brings one uncaptured payment in line with the payment service, and reports whether
+// it ends up captured.
+func (rc *Reconciler) settle(ctx context.Context, c charge, report *types.ReconciliationReport) bool {
+	report.Checked++
+	discrepancy := func(kind string, payment *services.Payment, detail string) {
+		d := types.Discrepancy{
+			Kind:        kind,
+			RideID:      c.ride.ID,
+			PassengerID: c.passengerID,
+			PaymentKind: c.kind,
+			PaymentID:   c.paymentID,
+			RideStatus:  c.ride.Status,
+			LocalStatus: c.status,
+			Expected:    c.amount,
+			Detail:      detail,
+		}
+		if payment != nil {
+			d.PaymentStatus, d.Actual = payment.Status, &payment.Amount
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+
+	if c.paymentID == "" {
+		discrepancy(types.DiscrepancyMissingPayment, nil, "")
+		return false
+	}
+	payment, err := rc.payments.GetPayment(c.paymentID)
+	if errors.Is(err, services.ErrPaymentNotFound) {
+		discrepancy(types.DiscrepancyPaymentNotFound, nil, "")
+		return false
+	}
+	if err != nil {
+		discrepancy(types.DiscrepancyLookupFailed, nil, err.Error())
+		return false
+	}
+
+	// A mismatch is reported but does not prevent settling the payment as it stands.
+	if !payment.Amount.Sub(c.amount).IsZero() {
+		discrepancy(types.DiscrepancyAmountMismatch, payment, "")
+	}
+
+	switch payment.Status {
+	case services.PaymentStatusCaptured:
+		report.Synced++
+	case services.PaymentStatusAuthorized:
+		err := rc.payments.CapturePayment(c.paymentID)
+		if errors.Is(err, services.ErrPaymentAlreadyCaptured) {
+			report.Synced++
+			break
+		}
+		if err != nil {
+			discrepancy(types.DiscrepancyCaptureFailed, payment, err.Error())
+			return false
+		}
+		report.Captured++
+	default:
+		discrepancy(types.DiscrepancyPaymentStatus, payment, "")
+		return false
+	}
+
+	rc.record(ctx, c)
+	return true
+}
+
+// record marks a captured payment on the ride and credits it to the driver. Crediting is
+// idempotent, so a payment the ride completion already credited is not credited twice.
+func (rc *Reconciler) record(ctx context.Context, c charge) {
+	var err error
+	switch {
+	case c.kind == services.PaymentKindTip:
+		err = rc.db.SetTipPayment(ctx, c.ride.ID, c.passengerID, c.paymentID, "CAPTURED")
+	case c.ride.Mode == types.ModePool:
+		err = rc.db.SetPoolPassengerPayment(ctx, c.ride.ID, c.passengerID, "", "CAPTURED")
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to record captured payment %s: %v", c.paymentID, err)
+	}
+
+	if c.ride.DriverID == "" {
+		return
+	}
+	tx := ledger.Tip(c.ride.DriverID, c.ride.ID, c.paymentID, c.amount, rc.clock.Now())
+	if c.kind == services.PaymentKindFare {
+		tx = ledger.Fare(c.ride.DriverID, c.ride.ID, c.paymentID, c.fare, c.amount, rc.commissionPercent, rc.clock.Now())
+	}
+	if err := rc.db.PostTransaction(ctx, tx); err != nil {
+		log.Printf("[ERROR] Failed to credit payment %s to driver %s: %v", c.paymentID, c.ride.DriverID, err)
+	}
+}
+
+// Run reconciles on every tick, until ctx is cancelled.
+func (rc *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tickCtx, cancel := context.WithTimeout(ctx, interval)
+			if _, err := rc.Reconcile(tickCtx); err != nil {
+				log.Printf("[ERROR] Failed to reconcile payments: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"rides/internal/database"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultAnalyticsPeriod is the period covered by an analytics report without explicit bounds.
+	defaultAnalyticsPeriod = 30 * 24 * time.Hour
+	// maxAnalyticsBuckets bounds how many buckets a report may split its period in.
+	maxAnalyticsBuckets = 1000
+
+	defaultZonePairs = 50
+	maxZonePairs     = 500
+)
+
+// bucketLengths approximate the length of each bucket, to bound the number of buckets.
+var bucketLengths = map[string]time.Duration{
+	database.BucketHour:  time.Hour,
+	database.BucketDay:   24 * time.Hour,
+	database.BucketWeek:  7 * 24 * time.Hour,
+	database.BucketMonth: 28 * 24 * time.Hour,
+}
+
+// parseAnalyticsQuery reads the period of an analytics report (?from=...&to=..., RFC 3339,
+// the last 30 days by default) and its buckets (?bucket=hour|day|week|month, days by default,
+// in the IANA time zone ?tz=..., UTC by default). It answers the request itself when the
+// query is invalid.
+func (s *Server) parseAnalyticsQuery(w http.ResponseWriter, r *http.Request) (database.AnalyticsQuery, bool) {
+	query := r.URL.Query()
+	q := database.AnalyticsQuery{
+		To:       s.clock.Now(),
+		Bucket:   database.BucketDay,
+		Location: time.UTC,
+	}
+
+	errs := fieldErrors{}
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs["to"] = "must be an RFC 3339 timestamp"
+		}
+		q.To = t
+	}
+	q.From = q.To.Add(-defaultAnalyticsPeriod)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs["from"] = "must be an RFC 3339 timestamp"
+		}
+		q.From = t
+	}
+	if v := query.Get("bucket"); v != "" {
+		if _, ok := bucketLengths[v]; !ok {
+			errs["bucket"] = "must be hour, day, week or month"
+		}
+		q.Bucket = v
+	}
+	if v := query.Get("tz"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			errs["tz"] = "unknown time zone"
+		} else {
+			q.Location = loc
+		}
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid analytics query", errs)
+		return q, false
+	}
+
+	if !q.From.Before(q.To) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return q, false
+	}
+	if q.To.Sub(q.From)/bucketLengths[q.Bucket] > maxAnalyticsBuckets {
+		http.Error(w, "Too many buckets, use a shorter period or larger buckets", http.StatusBadRequest)
+		return q, false
+	}
+	return q, true
+}
+
+// writeAnalytics answers a report with its query and results.
+func writeAnalytics(w http.ResponseWriter, q database.AnalyticsQuery, results any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		From     time.Time `json:"from"`
+		To       time.Time `json:"to"`
+		Bucket   string    `json:"bucket"`
+		TimeZone string    `json:"tz"`
+		Results  any       `json:"results"`
+	}{
+		From:     q.From,
+		To:       q.To,
+		Bucket:   q.Bucket,
+		TimeZone: q.Location.String(),
+		Results:  results,
+	})
+}
+
+// getZonePairAnalytics counts the rides requested over the period per pair of zones, busiest
+// first (?limit=..., 50 by default).
+func (s *Server) getZonePairAnalytics(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.parseAnalyticsQuery(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultZonePairs
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxZonePairs {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stats, err := s.db.ZonePairStats(ctx, q, limit)
+	if err != nil {
+		log.Printf("[ERROR] Failed to aggregate rides per zone pair: %v", err)
+		http.Error(w, "Error computing analytics", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, q, stats)
+}
+
+// getRevenueAnalytics totals the fares, average price and tips of the rides completed over
+// the period, per bucket.
+func (s *Server) getRevenueAnalytics(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.parseAnalyticsQuery(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	buckets, err := s.db.RevenueByBucket(ctx, q)
+	if err != nil {
+		log.Printf("[ERROR] Failed to aggregate revenue: %v", err)
+		http.Error(w, "Error computing analytics", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, q, buckets)
+}
+
+// getCompletionAnalytics reports the completion and cancellation rates of the rides requested
+// over the period, per bucket.
+func (s *Server) getCompletionAnalytics(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.parseAnalyticsQuery(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	buckets, err := s.db.CompletionByBucket(ctx, q)
+	if err != nil {
+		log.Printf("[ERROR] Failed to aggregate ride outcomes: %v", err)
+		http.Error(w, "Error computing analytics", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, q, buckets)
+}
+
+// getDriverActivityAnalytics reports how many drivers completed rides and how busy they
+// were, per bucket.
+func (s *Server) getDriverActivityAnalytics(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.parseAnalyticsQuery(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	buckets, err := s.db.DriverActivityByBucket(ctx, q)
+	if err != nil {
+		log.Printf("[ERROR] Failed to aggregate driver activity: %v", err)
+		http.Error(w, "Error computing analytics", http.StatusInternalServerError)
+		return
+	}
+	writeAnalytics(w, q, buckets)
+}
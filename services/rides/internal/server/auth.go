@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/types"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// rideStatusFlow are the status changes the participants of a ride make in its normal course:
+// its driver starts and completes it, and its passengers cancel it before pickup, which only
+// takes them off a pooled ride they share with others. Any other change is an override, which
+// needs permRidesOverrideStatus.
+var rideStatusFlow = map[auth.Role]map[string][]string{
+	auth.RoleDriver: {
+		types.StatusAssigned:   {types.StatusInProgress},
+		types.StatusInProgress: {types.StatusCompleted},
+	},
+	auth.RolePassenger: {
+		types.StatusScheduled:   {types.StatusCancelled},
+		types.StatusDispatching: {types.StatusCancelled},
+		types.StatusRequested:   {types.StatusCancelled},
+		types.StatusAssigned:    {types.StatusCancelled},
+	},
+}
+
+// ownsRide is the ownership of the ride whose ID is the {id} path value: it belongs to its
+// passengers and its driver. Malformed and unknown IDs are left to the handler to answer; the
+// ride is denied when it cannot be read.
+func (s *Server) ownsRide(r *http.Request, p *auth.Principal) bool {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, err := s.db.GetRideByID(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return true
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to get ride %s to check its ownership: %v", id.Hex(), err)
+		return false
+	}
+	return participates(p, ride)
+}
+
+// participates reports whether the principal is one of the ride's passengers or its driver.
+func participates(p *auth.Principal, ride *types.Ride) bool {
+	switch p.Role {
+	case auth.RoleDriver:
+		return ride.DriverID != "" && ride.DriverID == p.Subject
+	case auth.RolePassenger:
+		return slices.Contains(ridePassengers(ride), p.Subject)
+	}
+	return false
+}
+
+// actingAs checks the permission on the driver or passenger ID of a request body, which
+// defaults to the principal's when empty, and answers 403 when it is denied.
+func (s *Server) actingAs(w http.ResponseWriter, r *http.Request, perm auth.Permission, role auth.Role, id *string) bool {
+	if p := auth.FromRequest(r); *id == "" && p.Role == role {
+		*id = p.Subject
+	}
+	if !s.authz.Allowed(r, perm, auth.Owner(*id)) {
+		auth.Forbid(w)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"rides/internal/types"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultCaptureJobs = 50
+	maxCaptureJobs     = 500
+)
+
+// getCaptureJobs lists the payments queued for capture, the next due first (?limit=...).
+func (s *Server) getCaptureJobs(w http.ResponseWriter, r *http.Request) {
+	s.listCaptureJobs(w, r, s.db.ListCaptureJobs)
+}
+
+// getDeadCaptureJobs lists the captures given up, the latest first (?limit=...), with the
+// error of their last attempt.
+func (s *Server) getDeadCaptureJobs(w http.ResponseWriter, r *http.Request) {
+	s.listCaptureJobs(w, r, s.db.ListDeadCaptureJobs)
+}
+
+func (s *Server) listCaptureJobs(w http.ResponseWriter, r *http.Request, list func(context.Context, int) ([]types.CaptureJob, error)) {
+	limit := defaultCaptureJobs
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxCaptureJobs {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	jobs, err := list(ctx, limit)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list capture jobs: %v", err)
+		http.Error(w, "Error retrieving capture jobs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// requeueCaptureJob puts a dead capture back in the queue, e.g. once the cause of its failure
+// is fixed, and answers the queued job.
+func (s *Server) requeueCaptureJob(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := s.captures.Requeue(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Dead capture job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to requeue capture job %s: %v", id.Hex(), err)
+		http.Error(w, "Error requeuing capture job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
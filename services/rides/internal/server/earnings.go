@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rides/internal/ledger"
+	"rides/internal/money"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultEarningsPeriod is the period covered by an earnings report without explicit bounds.
+	defaultEarningsPeriod = 7 * 24 * time.Hour
+	// maxEarningsPeriod bounds the period of an earnings report.
+	maxEarningsPeriod = 366 * 24 * time.Hour
+
+	// maxAdjustment bounds the amount of a single earnings adjustment, in cents.
+	maxAdjustment       = 100000
+	maxAdjustmentReason = 500
+)
+
+// creditTip posts a captured tip to the ledger, crediting it entirely to the ride's driver.
+func (s *Server) creditTip(ctx context.Context, ride *types.Ride, amount money.Money, paymentID string) {
+	if ride.DriverID == "" || paymentID == "" {
+		return
+	}
+	tx := ledger.Tip(ride.DriverID, ride.ID, paymentID, amount, s.clock.Now())
+	if err := s.db.PostTransaction(ctx, tx); err != nil {
+		log.Printf("[ERROR] Failed to credit tip %s to driver %s: %v", paymentID, ride.DriverID, err)
+	}
+}
+
+// earningsPeriod is the summary of a driver's earnings over one day or week of a report.
+type earningsPeriod struct {
+	Start   time.Time             `json:"start"`
+	End     time.Time             `json:"end"`
+	Summary types.EarningsSummary `json:"summary"`
+}
+
+// splitPeriods summarizes the transactions per day or per week (starting on Monday, UTC) of
+// [from, to), skipping the periods without any earnings.
+func splitPeriods(driverID string, txs []types.Transaction, from, to time.Time, weekly bool) []earningsPeriod {
+	start := time.Date(from.UTC().Year(), from.UTC().Month(), from.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	step := 1
+	if weekly {
+		start = ledger.WeekStart(from)
+		step = 7
+	}
+
+	periods := []earningsPeriod{}
+	for ; start.Before(to); start = start.AddDate(0, 0, step) {
+		end := start.AddDate(0, 0, step)
+		var in []types.Transaction
+		for _, tx := range txs {
+			if !tx.CreatedAt.Before(start) && tx.CreatedAt.Before(end) {
+				in = append(in, tx)
+			}
+		}
+		summary := ledger.Summarize(driverID, in)
+		if summary.Rides == 0 && summary.Net.IsZero() {
+			continue
+		}
+		periods = append(periods, earningsPeriod{Start: start, End: end, Summary: summary})
+	}
+	return periods
+}
+
+// getDriverEarnings reports what a driver earned over a period (?from=...&to=..., RFC 3339,
+// the last 7 days by default), in total and per day or per week (?period=day|week), with the
+// ledger transactions it comes from.
+func (s *Server) getDriverEarnings(w http.ResponseWriter, r *http.Request) {
+	driverID := r.PathValue("id")
+	query := r.URL.Query()
+
+	to := s.clock.Now()
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultEarningsPeriod)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxEarningsPeriod {
+		http.Error(w, "Period must not exceed a year", http.StatusBadRequest)
+		return
+	}
+	period := query.Get("period")
+	if period == "" {
+		period = "day"
+	}
+	if period != "day" && period != "week" {
+		http.Error(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	txs, err := s.db.ListTransactions(ctx, driverID, from, to)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list ledger transactions: %v", err)
+		http.Error(w, "Error retrieving earnings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		DriverID     string                `json:"driverId"`
+		From         time.Time             `json:"from"`
+		To           time.Time             `json:"to"`
+		Currency     string                `json:"currency"`
+		Summary      types.EarningsSummary `json:"summary"`
+		Periods      []earningsPeriod      `json:"periods"`
+		Transactions []types.Transaction   `json:"transactions"`
+	}{
+		DriverID:     driverID,
+		From:         from,
+		To:           to,
+		Currency:     money.DefaultCurrency,
+		Summary:      ledger.Summarize(driverID, txs),
+		Periods:      splitPeriods(driverID, txs, from, to, period == "week"),
+		Transactions: txs,
+	})
+}
+
+// adjustDriverEarnings posts a correction of a driver's earnings: a positive amount is owed
+// to the driver, a negative one deducted. The optional reference makes retries safe.
+func (s *Server) adjustDriverEarnings(w http.ResponseWriter, r *http.Request) {
+	driverID := r.PathValue("id")
+
+	var req struct {
+		Amount    money.Money `json:"amount"`
+		Reason    string      `json:"reason"`
+		RideID    string      `json:"rideId"`
+		Reference string      `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	errs := fieldErrors{}
+	limit := money.Cents(maxAdjustment)
+	if req.Amount.IsZero() || req.Amount.GreaterThan(limit) || req.Amount.Mul(-1).GreaterThan(limit) {
+		errs["amount"] = fmt.Sprintf("must be non-zero and between -%s and %s", limit.Decimal(), limit.Decimal())
+	}
+	if req.Reason == "" || len(req.Reason) > maxAdjustmentReason {
+		errs["reason"] = fmt.Sprintf("must be 1 to %d characters", maxAdjustmentReason)
+	}
+	var rideID *primitive.ObjectID
+	if req.RideID != "" {
+		id, err := primitive.ObjectIDFromHex(req.RideID)
+		if err != nil {
+			errs["rideId"] = "invalid ride ID"
+		}
+		rideID = &id
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid adjustment", errs)
+		return
+	}
+	if req.Reference == "" {
+		req.Reference = primitive.NewObjectID().Hex()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx := ledger.Adjustment(driverID, req.Reference, rideID, req.Amount, req.Reason, s.clock.Now())
+	if err := s.db.PostTransaction(ctx, tx); err != nil {
+		log.Printf("[ERROR] Failed to post adjustment for driver %s: %v", driverID, err)
+		http.Error(w, "Error posting adjustment", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[UPDATE] Ajustement de %s sur les gains du chauffeur %s: %s", req.Amount, driverID, req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tx)
+}
+
+func (s *Server) getDriverStatements(w http.ResponseWriter, r *http.Request) {
+	driverID := r.PathValue("id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	statements, err := s.db.ListStatements(ctx, driverID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list payout statements: %v", err)
+		http.Error(w, "Error retrieving statements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statements)
+}
+
+// generateStatements issues the payout statements of a past week (?week=YYYY-MM-DD, any day of
+// the week; the last week by default), e.g. to catch up after an outage.
+func (s *Server) generateStatements(w http.ResponseWriter, r *http.Request) {
+	week := ledger.WeekStart(s.clock.Now()).AddDate(0, 0, -7)
+	if v := r.URL.Query().Get("week"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			http.Error(w, "Invalid week", http.StatusBadRequest)
+			return
+		}
+		week = ledger.WeekStart(t)
+	}
+	if s.clock.Now().Before(week.AddDate(0, 0, 7)) {
+		http.Error(w, "Week is not over", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	statements, err := s.payouts.Generate(ctx, week)
+	if err != nil {
+		log.Printf("[ERROR] Failed to generate payout statements: %v", err)
+		http.Error(w, "Error generating statements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statements)
+}
@@ -3,10 +3,17 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
-	"math/rand"
 	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/database"
+	"rides/internal/dispatcher"
+	"rides/internal/pricing"
 	"rides/internal/types"
+	"rides/internal/zones"
+	"slices"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,61 +27,191 @@ func (s *Server) createRide(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		PassengerID string `json:"passengerId"`
-		FromZone    string `json:"from_zone"`
-		ToZone      string `json:"to_zone"`
+		PassengerID string     `json:"passengerId"`
+		FromZone    string     `json:"from_zone"`
+		Via         []string   `json:"via"`
+		ToZone      string     `json:"to_zone"`
+		ScheduledAt *time.Time `json:"scheduledAt"`
+		QuoteID     string     `json:"quoteId"`
+		Mode        string     `json:"mode"`
+		PromoCode   string     `json:"promoCode"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	price := getPrice(req.FromZone, req.ToZone)
-	driverID, err := s.userService.GetAvailableDriver()
-	if err != nil {
-		log.Printf("[ERROR] Failed to get available driver: %v", err)
-		http.Error(w, "No available driver found", http.StatusServiceUnavailable)
+	if !s.actingAs(w, r, permRidesCreate, auth.RolePassenger, &req.PassengerID) {
 		return
 	}
 
-	rideID := primitive.NewObjectID()
+	now := s.clock.Now()
 
-	paymentID, err := s.paymentService.AuthorizePayment(rideID.Hex(), price)
-	if err != nil {
-		log.Printf("[WARN] Failed to authorize payment: %v", err)
-		http.Error(w, "Failed to authorize payment", http.StatusInternalServerError)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errs := fieldErrors{}
+
+	var quote *pricing.Quote
+	if req.QuoteID != "" {
+		var err error
+		quote, err = s.quotes.Verify(req.QuoteID)
+		switch {
+		case errors.Is(err, pricing.ErrQuoteExpired):
+			errs["quoteId"] = "quote has expired"
+		case err != nil:
+			errs["quoteId"] = "invalid quote"
+		case req.FromZone == "" && len(req.Via) == 0 && req.ToZone == "":
+			req.FromZone, req.Via, req.ToZone = quote.FromZone, quote.Via, quote.ToZone
+		}
+	}
+
+	route := validateRoute(errs, req.FromZone, req.Via, req.ToZone)
+	if quote != nil && !quote.Matches(route) {
+		errs["quoteId"] = "quote does not match the requested route"
+	}
+	validateSchedule(errs, req.ScheduledAt, now)
+	validateMode(errs, req.Mode, req.Via, req.ScheduledAt)
+	if err := s.validatePassenger(errs, req.PassengerID); err != nil {
+		log.Printf("[ERROR] Failed to verify passenger: %v", err)
+		http.Error(w, "Unable to verify passenger", http.StatusServiceUnavailable)
+		return
+	}
+	var promotion *types.Promotion
+	if req.PromoCode != "" && len(errs) == 0 {
+		var err error
+		promotion, err = s.lookupPromotion(ctx, errs, req.PromoCode, route, now)
+		if err != nil {
+			log.Printf("[ERROR] Failed to get promotion: %v", err)
+			http.Error(w, "Error creating ride", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid ride request", errs)
+		return
+	}
+
+	fare := pricing.PriceRoute(route)
+	if quote != nil {
+		fare = quote.Breakdown
+	}
+	if promotion != nil {
+		fare = fare.WithDiscount(promotion.Discount())
 	}
 
 	ride := &types.Ride{
-		ID:            rideID,
+		ID:            primitive.NewObjectID(),
 		PassengerID:   req.PassengerID,
-		PaymentID:     paymentID,
-		DriverID:      driverID,
-		FromZone:      req.FromZone,
-		ToZone:        req.ToZone,
-		Price:         price,
-		Status:        "ASSIGNED",
+		FromZone:      route[0],
+		ToZone:        route[len(route)-1],
+		Stops:         types.NewStops(route),
+		Price:         fare.Total,
+		Fare:          &fare,
+		Currency:      fare.Total.Currency,
+		QuoteID:       req.QuoteID,
+		Status:        types.StatusScheduled,
+		ScheduledAt:   req.ScheduledAt,
 		PaymentStatus: "PENDING",
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	if promotion != nil {
+		ride.PromoCode = promotion.Code
+	}
+
+	if req.Mode == types.ModePool {
+		ride.Mode = types.ModePool
+		ride.Stops = nil
+		poolFare := fare.Pool()
+		ride.Price = poolFare.Total
+		ride.Fare = nil
+		ride.Passengers = []types.RidePassenger{{
+			PassengerID:   ride.PassengerID,
+			FromZone:      ride.FromZone,
+			ToZone:        ride.ToZone,
+			Price:         poolFare.Total,
+			Fare:          &poolFare,
+			PromoCode:     ride.PromoCode,
+			PaymentStatus: "PENDING",
+			Status:        types.PassengerWaiting,
+			JoinedAt:      now,
+		}}
+	}
+
+	// The promo code is consumed before booking, so that concurrent bookings cannot exceed its
+	// limits, and given back if the ride ends up not being booked.
+	booked := false
+	if promotion != nil {
+		if !s.redeemPromotion(ctx, w, promotion, req.PassengerID, now) {
+			return
+		}
+		defer func() {
+			if booked {
+				return
+			}
+			if err := s.db.ReleasePromotion(ctx, promotion.Code, req.PassengerID); err != nil {
+				log.Printf("[ERROR] Failed to release promotion %s for passenger %s: %v", promotion.Code, req.PassengerID, err)
+			}
+		}()
+	}
+
+	// Scheduled rides are stored as is; the dispatcher requests a driver ahead of pickup.
+	if ride.ScheduledAt == nil {
+		existing, err := s.db.FindActiveRideByPassenger(ctx, req.PassengerID)
+		if err == nil {
+			writeActiveRideConflict(w, &database.ActiveRideError{Field: "passenger", RideID: existing.ID})
+			return
+		}
+		if err != mongo.ErrNoDocuments {
+			log.Printf("[ERROR] Failed to check active rides: %v", err)
+			http.Error(w, "Error creating ride", http.StatusInternalServerError)
+			return
+		}
+
+		// A pooled request first tries to join a compatible pool; a new pool is opened otherwise.
+		if ride.Mode == types.ModePool {
+			if answered, joined := s.joinPool(ctx, w, ride); answered {
+				booked = joined
+				return
+			}
+		}
 
-	_, err = s.db.CreateRide(ctx, ride)
+		ride.Status = types.StatusRequested
+	}
+
+	_, err := s.db.CreateRide(ctx, ride)
+	var conflict *database.ActiveRideError
+	if errors.As(err, &conflict) {
+		log.Printf("[WARN] Ride rejected: %v", conflict)
+		writeActiveRideConflict(w, conflict)
+		return
+	}
 	if err != nil {
 		log.Printf("[ERROR] Failed to create ride: %v", err)
 		http.Error(w, "Error creating ride", http.StatusInternalServerError)
 		return
 	}
 
-	if err := s.userService.UpdateDriverStatus(driverID, false); err != nil {
-		log.Printf("[WARN] Failed to update driver status: %v", err)
+	// The ride is offered to the closest driver, who has to accept it before it is assigned.
+	if ride.Status == types.StatusRequested {
+		if err := s.dispatcher.OfferNext(ctx, ride); err != nil {
+			log.Printf("[ERROR] Failed to offer ride %s: %v", ride.ID.Hex(), err)
+			if err := s.db.UpdateRideStatus(ctx, ride.ID, types.StatusNoDriverFound); err != nil {
+				log.Printf("[ERROR] Failed to update ride status: %v", err)
+			}
+			if errors.Is(err, dispatcher.ErrNoDriverAvailable) {
+				http.Error(w, "No available driver found", http.StatusServiceUnavailable)
+				return
+			}
+			http.Error(w, "Error creating ride", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	log.Printf("[CREATE] Nouvelle course créée: ID=%s, Passenger=%s, Driver=%s", ride.ID.Hex(), ride.PassengerID, ride.DriverID)
+	booked = true
+	log.Printf("[CREATE] Nouvelle course créée: ID=%s, Passenger=%s, Status=%s", ride.ID.Hex(), ride.PassengerID, ride.Status)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -124,34 +261,85 @@ func (s *Server) updateRideStatus(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !slices.Contains(types.Statuses, req.Status) {
+		http.Error(w, "Status must be one of "+strings.Join(types.Statuses, ", "), http.StatusBadRequest)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err = s.db.UpdateRideStatus(ctx, id, req.Status)
+	current, err := s.db.GetRideByID(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Ride not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to get ride: %v", err)
+		http.Error(w, "Error updating ride status", http.StatusInternalServerError)
+		return
+	}
+	flow := rideStatusFlow[auth.FromRequest(r).Role][current.Status]
+	if !slices.Contains(flow, req.Status) && !s.authz.Allowed(r, permRidesOverrideStatus, nil) {
+		auth.Forbid(w)
+		return
+	}
+
+	// A passenger cancelling a ride they share only leaves it: a pooled ride is cancelled for
+	// all of its passengers by an override.
+	if p := auth.FromRequest(r); p.Role == auth.RolePassenger && req.Status == types.StatusCancelled &&
+		current.Mode == types.ModePool && len(current.Passengers) > 1 {
+		s.leavePool(ctx, w, current, p.Subject)
+		return
+	}
+
+	transitioned, err := s.db.TransitionRideStatus(ctx, id, current.Status, req.Status)
+	var conflict *database.ActiveRideError
+	if errors.As(err, &conflict) {
+		writeActiveRideConflict(w, conflict)
+		return
+	}
 	if err != nil {
 		log.Printf("[ERROR] Failed to update ride status: %v", err)
 		http.Error(w, "Error updating ride status", http.StatusInternalServerError)
 		return
 	}
+	if !transitioned {
+		http.Error(w, "Ride status was updated concurrently", http.StatusConflict)
+		return
+	}
 
-	// If status is COMPLETED, capture payment
-	if req.Status == "COMPLETED" {
-		ride, err := s.db.GetRideByID(ctx, id)
-		if err == nil && ride.PaymentID != "" {
-			err = s.paymentService.CapturePayment(ride.PaymentID)
-			if err != nil {
-				log.Printf("[ERROR] Failed to capture payment: %v", err)
-			} else {
-				err = s.db.UpdateRidePaymentStatus(ctx, id, "CAPTURED")
-				if err != nil {
-					log.Printf("[ERROR] Failed to update payment status: %v", err)
-				}
+	// A cancelled ride is withdrawn from the driver it is being offered to, or released by the
+	// driver it was assigned to. Its payments are voided, including those of the passengers
+	// who joined a pool still waiting for a driver, and its promo codes given back.
+	if req.Status == types.StatusCancelled {
+		if err := s.db.CancelPendingOffers(ctx, id, s.clock.Now()); err != nil {
+			log.Printf("[ERROR] Failed to cancel ride offers: %v", err)
+		}
+		if slices.Contains(types.ActiveStatuses, current.Status) {
+			if current.DriverID != "" {
+				s.dispatcher.ReleaseDriver(current.DriverID)
 			}
+			s.dispatcher.ReleasePayments(ctx, current)
+		}
+		if current.Status == types.StatusScheduled || current.Status == types.StatusDispatching || slices.Contains(types.ActiveStatuses, current.Status) {
+			s.dispatcher.ReleasePromotions(ctx, current)
 		}
+	}
 
-		if err := s.userService.UpdateDriverStatus(ride.DriverID, true); err != nil {
-			log.Printf("[WARN] Failed to update driver status: %v", err)
+	// If status is COMPLETED, queue the capture of its payments
+	if req.Status == types.StatusCompleted {
+		ride, err := s.db.GetRideByID(ctx, id)
+		if err != nil {
+			log.Printf("[ERROR] Failed to get completed ride: %v", err)
+		} else {
+			if err := s.captures.Enqueue(ctx, ride, ""); err != nil {
+				log.Printf("[ERROR] Failed to queue payment capture: %v", err)
+			}
+
+			if err := s.userService.UpdateDriverStatus(ride.DriverID, true); err != nil {
+				log.Printf("[WARN] Failed to update driver status: %v", err)
+			}
 		}
 	}
 
@@ -169,6 +357,20 @@ func (s *Server) updateRideStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(ride)
 }
 
-func getPrice(from, to string) float64 {
-	return float64(rand.Intn(50) + 10)
+func writeActiveRideConflict(w http.ResponseWriter, conflict *database.ActiveRideError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/rides/"+conflict.RideID.Hex())
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(struct {
+		Error          string `json:"error"`
+		ExistingRideID string `json:"existingRideId"`
+	}{
+		Error:          "The " + conflict.Field + " already has an active ride",
+		ExistingRideID: conflict.RideID.Hex(),
+	})
+}
+
+func (s *Server) getZones(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(zones.All())
 }
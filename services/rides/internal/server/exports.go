@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"rides/internal/database"
+	"rides/internal/export"
+	"time"
+)
+
+// exportTimeout bounds how long an export may stream.
+const exportTimeout = 10 * time.Minute
+
+// exportRides streams the rides created over a period as a CSV, NDJSON or Parquet file
+// (?from=...&to=..., dates or RFC 3339 timestamps; ?format=csv|ndjson|parquet, CSV by
+// default), optionally filtered by status (comma-separated), mode, driverId, passengerId and
+// zone. Rows are written as they are read, so the response is never held in memory; an error
+// once streaming started can only cut the file short, which is logged.
+func (s *Server) exportRides(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := database.RideFilter{
+		Statuses:    export.ParseStatuses(query.Get("status")),
+		Mode:        query.Get("mode"),
+		DriverID:    query.Get("driverId"),
+		PassengerID: query.Get("passengerId"),
+		Zone:        query.Get("zone"),
+	}
+	errs := fieldErrors{}
+	for field, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		v := query.Get(field)
+		if v == "" {
+			errs[field] = "is required"
+			continue
+		}
+		t, err := export.ParseDate(v)
+		if err != nil {
+			errs[field] = "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"
+			continue
+		}
+		*bound = t
+	}
+	format := export.Format(query.Get("format"))
+	if format == "" {
+		format = export.CSV
+	}
+	if format != export.CSV && format != export.NDJSON && format != export.Parquet {
+		errs["format"] = "must be csv, ndjson or parquet"
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid export", errs)
+		return
+	}
+	if err := export.CheckFilter(filter); err != nil {
+		http.Error(w, "Invalid export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The export stops when the client goes away.
+	ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="rides-%s-%s.%s"`,
+		filter.From.Format(time.DateOnly), filter.To.Format(time.DateOnly), format))
+
+	out, err := export.NewWriter(w, format)
+	if err != nil {
+		log.Printf("[ERROR] Failed to start ride export: %v", err)
+		http.Error(w, "Error exporting rides", http.StatusInternalServerError)
+		return
+	}
+	n, err := export.Rides(ctx, s.db, filter, out)
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		log.Printf("[ERROR] Ride export interrupted after %d row(s): %v", n, err)
+		return
+	}
+
+	log.Printf("[READ] Export des courses du %s au %s (%s) -> %d ligne(s)", filter.From.Format(time.DateOnly), filter.To.Format(time.DateOnly), format, n)
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"rides/internal/money"
+	"rides/internal/types"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// passengerRide is a ride as seen by one of its passengers: on a pooled ride, their own trip
+// and fare rather than the whole ride's.
+type passengerRide struct {
+	ID          primitive.ObjectID `json:"id"`
+	Mode        string             `json:"mode,omitempty"`
+	Status      string             `json:"status"`
+	FromZone    string             `json:"from_zone"`
+	ToZone      string             `json:"to_zone"`
+	Price       money.Money        `json:"price"`
+	Tips        money.Money        `json:"tips"`
+	Currency    string             `json:"currency"`
+	DriverID    string             `json:"driverId,omitempty"`
+	ScheduledAt *time.Time         `json:"scheduledAt,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	CompletedAt *time.Time         `json:"completedAt,omitempty"`
+}
+
+// passengerTotals counts a passenger's rides and what they spent on the completed ones.
+type passengerTotals struct {
+	Rides     int         `json:"rides"`
+	Completed int         `json:"completed"`
+	Cancelled int         `json:"cancelled"`
+	Spent     money.Money `json:"spent"`
+	Currency  string      `json:"currency"`
+}
+
+func newPassengerRide(ride *types.Ride, passengerID string) passengerRide {
+	view := passengerRide{
+		ID:          ride.ID,
+		Mode:        ride.Mode,
+		Status:      ride.Status,
+		FromZone:    ride.FromZone,
+		ToZone:      ride.ToZone,
+		Price:       ride.Price,
+		Tips:        money.Cents(0),
+		Currency:    ride.Currency,
+		DriverID:    ride.DriverID,
+		ScheduledAt: ride.ScheduledAt,
+		CreatedAt:   ride.CreatedAt,
+		CompletedAt: ride.CompletedAt,
+	}
+	if ride.Mode == types.ModePool {
+		for _, p := range ride.Passengers {
+			if p.PassengerID == passengerID {
+				view.FromZone, view.ToZone, view.Price = p.FromZone, p.ToZone, p.Price
+			}
+		}
+	}
+	for _, tip := range ride.Tips {
+		if tip.PassengerID == passengerID && tip.PaymentStatus == "CAPTURED" {
+			view.Tips = view.Tips.Add(tip.Amount)
+		}
+	}
+	return view
+}
+
+// getPassengerRides lists a passenger's rides, most recent first, a page at a time
+// (?limit=...&before=<ride ID>, the nextCursor of the previous page), with totals over all
+// their rides and their latest ride.
+func (s *Server) getPassengerRides(w http.ResponseWriter, r *http.Request) {
+	passengerID := r.PathValue("id")
+	query := r.URL.Query()
+
+	limit := defaultHistoryLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var before *primitive.ObjectID
+	if v := query.Get("before"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+		before = &id
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// One more ride than asked tells whether there is a next page.
+	rides, err := s.db.ListPassengerRides(ctx, passengerID, before, limit+1)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list rides of passenger %s: %v", passengerID, err)
+		http.Error(w, "Error retrieving rides", http.StatusInternalServerError)
+		return
+	}
+	history, err := s.db.GetPassengerHistory(ctx, passengerID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to total rides of passenger %s: %v", passengerID, err)
+		http.Error(w, "Error retrieving rides", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(rides) > limit {
+		rides = rides[:limit]
+		nextCursor = rides[limit-1].ID.Hex()
+	}
+	views := make([]passengerRide, len(rides))
+	for i := range rides {
+		views[i] = newPassengerRide(&rides[i], passengerID)
+	}
+	var lastRide *passengerRide
+	if history.LastRide != nil {
+		view := newPassengerRide(history.LastRide, passengerID)
+		lastRide = &view
+	}
+
+	log.Printf("[READ] Historique du passager %s -> %d course(s)", passengerID, len(views))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		PassengerID string          `json:"passengerId"`
+		Rides       []passengerRide `json:"rides"`
+		NextCursor  string          `json:"nextCursor,omitempty"`
+		Totals      passengerTotals `json:"totals"`
+		LastRide    *passengerRide  `json:"lastRide,omitempty"`
+	}{
+		PassengerID: passengerID,
+		Rides:       views,
+		NextCursor:  nextCursor,
+		Totals: passengerTotals{
+			Rides:     history.Rides,
+			Completed: history.Completed,
+			Cancelled: history.Cancelled,
+			Spent:     history.Spent,
+			Currency:  money.DefaultCurrency,
+		},
+		LastRide: lastRide,
+	})
+}
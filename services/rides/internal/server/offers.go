@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/database"
+	"rides/internal/dispatcher"
+	"rides/internal/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// offerIDs parses the ride and offer IDs of an offer route.
+func offerIDs(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	rideID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return rideID, rideID, false
+	}
+	offerID, err := primitive.ObjectIDFromHex(r.PathValue("offerId"))
+	if err != nil {
+		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+		return rideID, offerID, false
+	}
+	return rideID, offerID, true
+}
+
+func (s *Server) acceptOffer(w http.ResponseWriter, r *http.Request) {
+	rideID, offerID, ok := offerIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DriverID string `json:"driverId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.actingAs(w, r, permOffersRespond, auth.RoleDriver, &req.DriverID) {
+		return
+	}
+	if req.DriverID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, err := s.dispatcher.Accept(ctx, rideID, offerID, req.DriverID)
+	if err != nil {
+		var conflict *database.ActiveRideError
+		if errors.As(err, &conflict) {
+			writeActiveRideConflict(w, conflict)
+			return
+		}
+		if errors.Is(err, dispatcher.ErrPaymentAuthorization) {
+			log.Printf("[WARN] Failed to authorize payment: %v", err)
+			http.Error(w, "Failed to authorize payment", http.StatusInternalServerError)
+			return
+		}
+		writeOfferError(w, err)
+		return
+	}
+
+	log.Printf("[UPDATE] Offre %s acceptée: course %s assignée au chauffeur %s", offerID.Hex(), rideID.Hex(), req.DriverID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ride)
+}
+
+func (s *Server) declineOffer(w http.ResponseWriter, r *http.Request) {
+	rideID, offerID, ok := offerIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DriverID string `json:"driverId"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.actingAs(w, r, permOffersRespond, auth.RoleDriver, &req.DriverID) {
+		return
+	}
+	if req.DriverID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	offer, err := s.dispatcher.Decline(ctx, rideID, offerID, req.DriverID, req.Reason)
+	if err != nil {
+		writeOfferError(w, err)
+		return
+	}
+
+	log.Printf("[UPDATE] Offre %s refusée par le chauffeur %s", offerID.Hex(), req.DriverID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
+
+func writeOfferError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, dispatcher.ErrOfferNotFound), err == mongo.ErrNoDocuments:
+		http.Error(w, "Offer not found", http.StatusNotFound)
+	case errors.Is(err, dispatcher.ErrOfferNotForYou):
+		http.Error(w, "Offer was made to another driver", http.StatusForbidden)
+	case errors.Is(err, dispatcher.ErrOfferNotPending):
+		http.Error(w, "Offer has expired or was already answered", http.StatusConflict)
+	case errors.Is(err, dispatcher.ErrRideNotRequested):
+		http.Error(w, "Ride is no longer waiting for a driver", http.StatusConflict)
+	default:
+		log.Printf("[ERROR] Failed to answer offer: %v", err)
+		http.Error(w, "Error answering offer", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) getRideOffers(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	offers, err := s.db.ListOffersByRide(ctx, id)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list ride offers: %v", err)
+		http.Error(w, "Error retrieving offers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offers)
+}
+
+func (s *Server) getDriverOffers(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", types.OfferPending, types.OfferAccepted, types.OfferDeclined, types.OfferExpired, types.OfferCancelled:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	offers, err := s.db.ListOffersByDriver(ctx, r.PathValue("id"), status)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list driver offers: %v", err)
+		http.Error(w, "Error retrieving offers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offers)
+}
@@ -0,0 +1,144 @@
+package server
+
+import "ridenow/pkg/auth"
+
+const (
+	permQuotesCreate        auth.Permission = "quotes:create"
+	permPromotionsRead      auth.Permission = "promotions:read"
+	permPromotionsManage    auth.Permission = "promotions:manage"
+	permZonesRead           auth.Permission = "zones:read"
+	permRidesCreate         auth.Permission = "rides:create"
+	permRidesRead           auth.Permission = "rides:read"
+	permRidesUpdate         auth.Permission = "rides:update"
+	permRidesOverrideStatus auth.Permission = "rides:override-status"
+	permRidesDrive          auth.Permission = "rides:drive"
+	permRidesRate           auth.Permission = "rides:rate"
+	permRidesTip            auth.Permission = "rides:tip"
+	permRidesExport         auth.Permission = "rides:export"
+	permOffersRead          auth.Permission = "offers:read"
+	permOffersRespond       auth.Permission = "offers:respond"
+	permPassengerRides      auth.Permission = "passengers:rides"
+	permEarningsRead        auth.Permission = "earnings:read"
+	permEarningsAdjust      auth.Permission = "earnings:adjust"
+	permPayoutsGenerate     auth.Permission = "payouts:generate"
+	permPaymentsManage      auth.Permission = "payments:manage"
+	permAnalyticsRead       auth.Permission = "analytics:read"
+)
+
+// policy grants the permissions of the rides API. Passengers and drivers only act on their own
+// account and the rides they take part in, dispatchers follow every ride, and admins and the
+// other services, which the service token also stands for in operations tooling, may do
+// anything.
+var policy = auth.Policy{
+	permQuotesCreate: {
+		auth.RolePassenger:  auth.ScopeAll,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permPromotionsRead: {
+		auth.RolePassenger:  auth.ScopeAll,
+		auth.RoleDriver:     auth.ScopeAll,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permPromotionsManage: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permZonesRead: {
+		auth.RolePassenger:  auth.ScopeAll,
+		auth.RoleDriver:     auth.ScopeAll,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permRidesCreate: {
+		auth.RolePassenger:  auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permRidesRead: {
+		auth.RolePassenger:  auth.ScopeOwn,
+		auth.RoleDriver:     auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	// Status changes outside of the normal course of a ride also need permRidesOverrideStatus.
+	permRidesUpdate: {
+		auth.RolePassenger:  auth.ScopeOwn,
+		auth.RoleDriver:     auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	// Pickups, drop-offs and stops are reported by the driver of the ride.
+	permRidesDrive: {
+		auth.RoleDriver:     auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permRidesOverrideStatus: {
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permRidesRate: {
+		auth.RolePassenger: auth.ScopeOwn,
+		auth.RoleDriver:    auth.ScopeOwn,
+		auth.RoleAdmin:     auth.ScopeAll,
+		auth.RoleService:   auth.ScopeAll,
+	},
+	permRidesTip: {
+		auth.RolePassenger: auth.ScopeOwn,
+		auth.RoleAdmin:     auth.ScopeAll,
+		auth.RoleService:   auth.ScopeAll,
+	},
+	permRidesExport: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permOffersRead: {
+		auth.RoleDriver:     auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permOffersRespond: {
+		auth.RoleDriver:  auth.ScopeOwn,
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permPassengerRides: {
+		auth.RolePassenger:  auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permEarningsRead: {
+		auth.RoleDriver:  auth.ScopeOwn,
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permEarningsAdjust: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permPayoutsGenerate: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permPaymentsManage: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permAnalyticsRead: {
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"rides/internal/database"
+	"rides/internal/types"
+	"rides/internal/zones"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// poolSeats bounds the number of passengers sharing a pooled ride.
+	poolSeats = 3
+
+	// poolMatchRadiusKm is how far apart two pickups, and two drop-offs, can be for the
+	// routes to be shared.
+	poolMatchRadiusKm = 2.0
+)
+
+// compatibleRoute reports whether a trip can be added to a pooled ride: its pickup and
+// drop-off must both be close to the ones of the passenger who opened the pool.
+func compatibleRoute(pool *types.Ride, from, to string) bool {
+	return zones.DistanceKm(pool.FromZone, from) <= poolMatchRadiusKm &&
+		zones.DistanceKm(pool.ToZone, to) <= poolMatchRadiusKm
+}
+
+// joinPool seats the pooled request's passenger on a compatible pool opened within the match
+// window and authorizes their fare. It reports whether it answered the request and whether
+// the passenger joined a pool; when no pool could be joined it writes nothing and the caller
+// opens a new pool.
+func (s *Server) joinPool(ctx context.Context, w http.ResponseWriter, request *types.Ride) (answered, joined bool) {
+	member := request.Passengers[0]
+
+	pools, err := s.db.FindOpenPools(ctx, s.clock.Now().Add(-s.config.PoolMatchWindow), poolSeats)
+	if err != nil {
+		log.Printf("[ERROR] Failed to find open pools: %v", err)
+		http.Error(w, "Error creating ride", http.StatusInternalServerError)
+		return true, false
+	}
+
+	for _, pool := range pools {
+		if !compatibleRoute(&pool, member.FromZone, member.ToZone) {
+			continue
+		}
+
+		joined, err := s.db.JoinPool(ctx, pool.ID, member, poolSeats)
+		var conflict *database.ActiveRideError
+		if errors.As(err, &conflict) {
+			writeActiveRideConflict(w, conflict)
+			return true, false
+		}
+		if err != nil {
+			log.Printf("[ERROR] Failed to join pool %s: %v", pool.ID.Hex(), err)
+			http.Error(w, "Error creating ride", http.StatusInternalServerError)
+			return true, false
+		}
+		if !joined {
+			continue
+		}
+
+		paymentID, err := s.paymentService.AuthorizePayment(pool.ID.Hex(), member.Price)
+		if err != nil {
+			log.Printf("[WARN] Failed to authorize payment: %v", err)
+			if _, err := s.db.LeavePool(ctx, &pool, member); err != nil {
+				log.Printf("[ERROR] Failed to remove passenger %s from pool %s: %v", member.PassengerID, pool.ID.Hex(), err)
+			}
+			http.Error(w, "Failed to authorize payment", http.StatusInternalServerError)
+			return true, false
+		}
+		if err := s.db.SetPoolPassengerPayment(ctx, pool.ID, member.PassengerID, paymentID, "PENDING"); err != nil {
+			log.Printf("[ERROR] Failed to record payment %s for pool %s: %v", paymentID, pool.ID.Hex(), err)
+		}
+
+		log.Printf("[CREATE] Passager %s ajouté à la course partagée %s (Driver=%s)", member.PassengerID, pool.ID.Hex(), pool.DriverID)
+
+		ride, err := s.db.GetRideByID(ctx, pool.ID)
+		if err != nil {
+			log.Printf("[ERROR] Failed to get updated ride: %v", err)
+			http.Error(w, "Error retrieving updated ride", http.StatusInternalServerError)
+			return true, false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ride)
+		return true, true
+	}
+
+	return false, false
+}
+
+func (s *Server) updatePoolPassengerStatus(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	passengerID := r.PathValue("passengerId")
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// A passenger is picked up once a driver is assigned, and dropped off during the trip.
+	var from string
+	var rideStatuses []string
+	switch req.Status {
+	case types.PassengerPickedUp:
+		from = types.PassengerWaiting
+		rideStatuses = []string{types.StatusAssigned, types.StatusInProgress}
+	case types.PassengerDroppedOff:
+		from = types.PassengerPickedUp
+		rideStatuses = []string{types.StatusInProgress}
+	default:
+		http.Error(w, "Status must be PICKED_UP or DROPPED_OFF", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, ok := s.loadRide(ctx, w, id)
+	if !ok {
+		return
+	}
+
+	if ride.Mode != types.ModePool {
+		http.Error(w, "Ride is not pooled", http.StatusConflict)
+		return
+	}
+	if !slices.Contains(rideStatuses, ride.Status) {
+		http.Error(w, "Ride is "+ride.Status+", expected "+strings.Join(rideStatuses, " or "), http.StatusConflict)
+		return
+	}
+	i := slices.IndexFunc(ride.Passengers, func(p types.RidePassenger) bool { return p.PassengerID == passengerID })
+	if i < 0 {
+		http.Error(w, "Passenger not found on this ride", http.StatusNotFound)
+		return
+	}
+
+	updated, err := s.db.UpdatePoolPassengerStatus(ctx, id, rideStatuses, passengerID, from, req.Status, s.clock.Now())
+	if err != nil {
+		log.Printf("[ERROR] Failed to update passenger status: %v", err)
+		http.Error(w, "Error updating passenger status", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Passenger is "+ride.Passengers[i].Status+", expected "+from, http.StatusConflict)
+		return
+	}
+
+	// Each passenger pays for their own leg as soon as they are dropped off.
+	if req.Status == types.PassengerDroppedOff {
+		if err := s.captures.Enqueue(ctx, ride, passengerID); err != nil {
+			log.Printf("[ERROR] Failed to queue payment capture of passenger %s: %v", passengerID, err)
+		}
+	}
+
+	log.Printf("[UPDATE] Course partagée %s, passager %s: %s", idStr, passengerID, req.Status)
+
+	s.writeRide(ctx, w, id)
+}
+
+// leavePool takes a passenger who cancels before being picked up off a pooled ride that other
+// passengers share: only their own payment is voided and their promo code given back, and the
+// ride carries on for the others.
+func (s *Server) leavePool(ctx context.Context, w http.ResponseWriter, ride *types.Ride, passengerID string) {
+	i := slices.IndexFunc(ride.Passengers, func(p types.RidePassenger) bool { return p.PassengerID == passengerID })
+	if i < 0 {
+		http.Error(w, "Passenger not found on this ride", http.StatusNotFound)
+		return
+	}
+	member := ride.Passengers[i]
+	if member.Status != types.PassengerWaiting {
+		http.Error(w, "Passenger is "+member.Status+", expected "+types.PassengerWaiting, http.StatusConflict)
+		return
+	}
+
+	left, err := s.db.LeavePool(ctx, ride, member)
+	if err != nil {
+		log.Printf("[ERROR] Failed to remove passenger %s from pool %s: %v", passengerID, ride.ID.Hex(), err)
+		http.Error(w, "Error updating ride status", http.StatusInternalServerError)
+		return
+	}
+	if !left {
+		http.Error(w, "Ride was modified concurrently", http.StatusConflict)
+		return
+	}
+
+	s.dispatcher.ReleasePassengerPayment(ctx, ride.ID, member)
+	s.dispatcher.ReleasePassengerPromotion(ctx, member)
+
+	log.Printf("[UPDATE] Passager %s retiré de la course partagée %s", passengerID, ride.ID.Hex())
+
+	s.writeRide(ctx, w, ride.ID)
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"rides/internal/database"
+	"rides/internal/money"
+	"rides/internal/types"
+	"rides/internal/zones"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxPromotionFixed bounds the amount of a fixed promotion discount, in cents.
+const maxPromotionFixed = 10000
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,20}$`)
+
+// normalizePromoCode makes promo codes case-insensitive.
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func validatePromotion(errs fieldErrors, p *types.Promotion) {
+	if !promoCodePattern.MatchString(p.Code) {
+		errs["code"] = "must be 3 to 20 letters, digits, '-' or '_'"
+	}
+	switch p.Kind {
+	case types.PromotionPercent:
+		if p.Percent < 1 || p.Percent > 100 {
+			errs["percent"] = "must be between 1 and 100"
+		}
+	case types.PromotionFixed:
+		if !p.Amount.IsPositive() || p.Amount.GreaterThan(money.Cents(maxPromotionFixed)) {
+			errs["amount"] = fmt.Sprintf("must be between 0.01 and %s", money.Cents(maxPromotionFixed).Decimal())
+		}
+	default:
+		errs["kind"] = fmt.Sprintf("must be %s or %s", types.PromotionPercent, types.PromotionFixed)
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		errs["endsAt"] = "must be after startsAt"
+	}
+	for i, name := range p.Zones {
+		zone, ok := zones.Lookup(name)
+		if !ok {
+			errs[fmt.Sprintf("zones[%d]", i)] = fmt.Sprintf("unknown zone %q", name)
+		}
+		p.Zones[i] = zone
+	}
+	if p.MaxRedemptions < 0 {
+		errs["maxRedemptions"] = "must not be negative"
+	}
+	if p.MaxPerPassenger < 0 {
+		errs["maxPerPassenger"] = "must not be negative"
+	}
+}
+
+func (s *Server) createPromotion(w http.ResponseWriter, r *http.Request) {
+	var promotion types.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	promotion.Code = normalizePromoCode(promotion.Code)
+	if promotion.Kind == types.PromotionPercent {
+		promotion.Amount = money.Money{}
+	} else {
+		promotion.Percent = 0
+	}
+	errs := fieldErrors{}
+	validatePromotion(errs, &promotion)
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid promotion", errs)
+		return
+	}
+	promotion.Redemptions = 0
+	promotion.CreatedAt = s.clock.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.db.CreatePromotion(ctx, &promotion)
+	if errors.Is(err, database.ErrPromotionExists) {
+		http.Error(w, "Promotion code already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to create promotion: %v", err)
+		http.Error(w, "Error creating promotion", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[CREATE] Nouvelle promotion créée: %s (%s)", promotion.Code, promotion.Kind)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(promotion)
+}
+
+func (s *Server) getPromotions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	promotions, err := s.db.ListPromotions(ctx)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list promotions: %v", err)
+		http.Error(w, "Error retrieving promotions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotions)
+}
+
+func (s *Server) getPromotion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	promotion, err := s.db.GetPromotionByCode(ctx, normalizePromoCode(r.PathValue("code")))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Promotion not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[ERROR] Failed to get promotion: %v", err)
+		http.Error(w, "Error retrieving promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotion)
+}
+
+// lookupPromotion checks that the promo code entered for a trip exists and applies to it at
+// the given time. It records the reason in errs when it does not, and returns an error only
+// when the promotion could not be read.
+func (s *Server) lookupPromotion(ctx context.Context, errs fieldErrors, code string, route []string, now time.Time) (*types.Promotion, error) {
+	promotion, err := s.db.GetPromotionByCode(ctx, normalizePromoCode(code))
+	if err == mongo.ErrNoDocuments {
+		errs["promoCode"] = "unknown promo code"
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !promotion.ActiveAt(now):
+		errs["promoCode"] = "promo code is not active"
+	case !promotion.AppliesTo(route[0], route[len(route)-1]):
+		errs["promoCode"] = "promo code does not apply to this trip"
+	case promotion.MaxRedemptions > 0 && promotion.Redemptions >= promotion.MaxRedemptions:
+		errs["promoCode"] = "promo code usage limit reached"
+	}
+	return promotion, nil
+}
+
+// redeemPromotion consumes one use of the promotion for the passenger, answering the request
+// itself when it cannot.
+func (s *Server) redeemPromotion(ctx context.Context, w http.ResponseWriter, promotion *types.Promotion, passengerID string, now time.Time) bool {
+	err := s.db.RedeemPromotion(ctx, promotion, passengerID, now)
+	switch {
+	case err == nil:
+		log.Printf("[UPDATE] Promotion %s utilisée par le passager %s", promotion.Code, passengerID)
+		return true
+	case errors.Is(err, database.ErrPromotionLimitReached):
+		writeFieldErrors(w, "Invalid ride request", fieldErrors{"promoCode": "promo code usage limit reached"})
+	case err == mongo.ErrNoDocuments:
+		writeFieldErrors(w, "Invalid ride request", fieldErrors{"promoCode": "promo code is not active"})
+	default:
+		log.Printf("[ERROR] Failed to redeem promotion %s: %v", promotion.Code, err)
+		http.Error(w, "Error creating ride", http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func (s *Server) createQuote(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FromZone string   `json:"from_zone"`
+		Via      []string `json:"via"`
+		ToZone   string   `json:"to_zone"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	errs := fieldErrors{}
+	route := validateRoute(errs, req.FromZone, req.Via, req.ToZone)
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid quote request", errs)
+		return
+	}
+
+	quote, err := s.quotes.Issue(route[0], route[1:len(route)-1], route[len(route)-1])
+	if err != nil {
+		log.Printf("[ERROR] Failed to issue quote: %v", err)
+		http.Error(w, "Error creating quote", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[CREATE] Devis émis: %s -> %s, prix=%s, expire=%s", quote.FromZone, quote.ToZone, quote.Price, quote.ExpiresAt.Format("15:04:05"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/database"
+	"rides/internal/types"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxRatingComment = 500
+	maxRatingTags    = 5
+	maxRatingTagLen  = 30
+)
+
+// ridePassengers returns the IDs of everyone who travelled on the ride.
+func ridePassengers(ride *types.Ride) []string {
+	if ride.Mode != types.ModePool {
+		return []string{ride.PassengerID}
+	}
+	ids := make([]string, 0, len(ride.Passengers))
+	for _, p := range ride.Passengers {
+		ids = append(ids, p.PassengerID)
+	}
+	return ids
+}
+
+func validateRating(errs fieldErrors, score int, comment string, tags []string) {
+	if score < 1 || score > 5 {
+		errs["score"] = "must be between 1 and 5"
+	}
+	if len(comment) > maxRatingComment {
+		errs["comment"] = fmt.Sprintf("at most %d characters", maxRatingComment)
+	}
+	if len(tags) > maxRatingTags {
+		errs["tags"] = fmt.Sprintf("at most %d tags", maxRatingTags)
+	}
+	for _, tag := range tags {
+		if tag == "" || len(tag) > maxRatingTagLen {
+			errs["tags"] = fmt.Sprintf("tags must be 1 to %d characters", maxRatingTagLen)
+		}
+	}
+}
+
+// rateRide records a participant's rating of a completed ride: the passenger rates the driver,
+// the driver rates the passenger (on a pooled ride, the one named by passengerId).
+func (s *Server) rateRide(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		RaterID     string   `json:"raterId"`
+		PassengerID string   `json:"passengerId"`
+		Score       int      `json:"score"`
+		Comment     string   `json:"comment"`
+		Tags        []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// Drivers rate as themselves, anyone else as a passenger.
+	raterRole := auth.RolePassenger
+	if auth.FromRequest(r).Role == auth.RoleDriver {
+		raterRole = auth.RoleDriver
+	}
+	if !s.actingAs(w, r, permRidesRate, raterRole, &req.RaterID) {
+		return
+	}
+
+	errs := fieldErrors{}
+	validateRating(errs, req.Score, req.Comment, req.Tags)
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid rating", errs)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, ok := s.loadRide(ctx, w, id)
+	if !ok {
+		return
+	}
+	if ride.Status != types.StatusCompleted {
+		http.Error(w, "Ride is not completed", http.StatusConflict)
+		return
+	}
+
+	rating := &types.Rating{
+		RideID:    ride.ID,
+		RaterID:   req.RaterID,
+		Score:     req.Score,
+		Comment:   req.Comment,
+		Tags:      req.Tags,
+		CreatedAt: s.clock.Now(),
+	}
+
+	passengers := ridePassengers(ride)
+	switch {
+	case req.RaterID != "" && req.RaterID == ride.DriverID:
+		rating.RatedBy = types.RatedByDriver
+		rating.RateeID = req.PassengerID
+		if rating.RateeID == "" && len(passengers) == 1 {
+			rating.RateeID = passengers[0]
+		}
+		if !slices.Contains(passengers, rating.RateeID) {
+			writeFieldErrors(w, "Invalid rating", fieldErrors{"passengerId": "must be a passenger of the ride"})
+			return
+		}
+	case slices.Contains(passengers, req.RaterID):
+		rating.RatedBy = types.RatedByPassenger
+		rating.RateeID = ride.DriverID
+	default:
+		http.Error(w, "Only the ride's driver and passengers can rate it", http.StatusForbidden)
+		return
+	}
+
+	err = s.db.CreateRating(ctx, rating)
+	if errors.Is(err, database.ErrAlreadyRated) {
+		http.Error(w, "Ride already rated", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to create rating: %v", err)
+		http.Error(w, "Error rating ride", http.StatusInternalServerError)
+		return
+	}
+
+	// The rating is kept even if the average cannot be updated right away; it is retried later.
+	if err := s.ratings.Apply(ctx, rating); err != nil {
+		log.Printf("[WARN] Failed to update average rating of %s, will retry: %v", rating.RateeID, err)
+	}
+
+	log.Printf("[CREATE] Course %s notée %d/5 par %s (%s)", idStr, rating.Score, rating.RaterID, rating.RatedBy)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rating)
+}
+
+func (s *Server) getRideRatings(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ratings, err := s.db.ListRatingsByRide(ctx, id)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list ride ratings: %v", err)
+		http.Error(w, "Error retrieving ratings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/receipt"
+	"rides/internal/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// receiptFormats are the renderings of a receipt, by media type, in order of preference when
+// the client accepts several equally.
+var receiptFormats = []struct {
+	mediaType   string
+	name        string
+	contentType string
+	write       func(io.Writer, *receipt.Receipt) error
+}{
+	{"text/plain", "text", "text/plain; charset=utf-8", receipt.WriteText},
+	{"text/html", "html", "text/html; charset=utf-8", receipt.WriteHTML},
+	{"application/pdf", "pdf", "application/pdf", receipt.WritePDF},
+}
+
+// negotiateReceiptFormat picks the receipt rendering the Accept header prefers, or -1 if it
+// accepts none of them. A missing header accepts any.
+func negotiateReceiptFormat(accept string) int {
+	if accept == "" {
+		return 0
+	}
+	best, bestQ := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		for i, f := range receiptFormats {
+			major, _, _ := strings.Cut(f.mediaType, "/")
+			matches := mediaType == f.mediaType || mediaType == major+"/*" || mediaType == "*/*"
+			if matches && (q > bestQ || q == bestQ && i < best) {
+				best, bestQ = i, q
+			}
+		}
+	}
+	return best
+}
+
+// getRideReceipt renders the receipt of a completed ride whose payment was captured, itemizing
+// the fare and tips of each passenger, or of one passenger of a pooled ride (?passengerId=...).
+// The rendering is negotiated from the Accept header (text/plain, text/html or
+// application/pdf) unless ?format=text|html|pdf is given, and the language from
+// Accept-Language unless ?lang=en|fr is given.
+func (s *Server) getRideReceipt(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+
+	format := negotiateReceiptFormat(r.Header.Get("Accept"))
+	if v := query.Get("format"); v != "" {
+		format = -1
+		for i, f := range receiptFormats {
+			if f.name == v {
+				format = i
+			}
+		}
+		if format < 0 {
+			http.Error(w, "Invalid format", http.StatusBadRequest)
+			return
+		}
+	}
+	if format < 0 {
+		http.Error(w, "Receipts are available as text/plain, text/html or application/pdf", http.StatusNotAcceptable)
+		return
+	}
+
+	lang := receipt.ParseLanguage(r.Header.Get("Accept-Language"))
+	if v := query.Get("lang"); v != "" {
+		lang = receipt.Language(v)
+		if lang != receipt.English && lang != receipt.French {
+			http.Error(w, "Invalid lang", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, ok := s.loadRide(ctx, w, id)
+	if !ok {
+		return
+	}
+	if ride.Status != types.StatusCompleted || ride.PaymentStatus != "CAPTURED" {
+		http.Error(w, "Receipt is available once the ride is completed and paid", http.StatusConflict)
+		return
+	}
+
+	// A passenger of a pooled ride only gets their own part of the receipt.
+	passengerID := query.Get("passengerId")
+	if p := auth.FromRequest(r); p.Role == auth.RolePassenger && ride.Mode == types.ModePool {
+		if passengerID != "" && passengerID != p.Subject {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		passengerID = p.Subject
+	}
+
+	rec := receipt.New(ride, passengerID, lang)
+	if !rec.HasPassenger() {
+		http.Error(w, "Passenger not found on this ride", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := receiptFormats[format].write(&buf, rec); err != nil {
+		log.Printf("[ERROR] Failed to render receipt for ride %s: %v", idStr, err)
+		http.Error(w, "Error rendering receipt", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[READ] Reçu de la course %s (%s, %s)", idStr, receiptFormats[format].name, lang)
+
+	w.Header().Set("Content-Type", receiptFormats[format].contentType)
+	w.Header().Set("Content-Language", string(lang))
+	w.Header().Add("Vary", "Accept, Accept-Language")
+	if receiptFormats[format].name == "pdf" {
+		w.Header().Set("Content-Disposition", `inline; filename="receipt-`+idStr+`.pdf"`)
+	}
+	buf.WriteTo(w)
+}
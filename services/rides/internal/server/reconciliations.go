@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultReconciliationReports = 20
+	maxReconciliationReports     = 100
+)
+
+// reconcilePayments runs a payment reconciliation now, e.g. once the payment service is back
+// after an outage, and answers its report.
+func (s *Server) reconcilePayments(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := s.reconciler.Reconcile(ctx)
+	if err != nil {
+		log.Printf("[ERROR] Failed to reconcile payments: %v", err)
+		http.Error(w, "Error reconciling payments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// getReconciliations lists the latest reconciliation reports, most recent first (?limit=...).
+func (s *Server) getReconciliations(w http.ResponseWriter, r *http.Request) {
+	limit := defaultReconciliationReports
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxReconciliationReports {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reports, err := s.db.ListReconciliationReports(ctx, limit)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list reconciliation reports: %v", err)
+		http.Error(w, "Error retrieving reconciliation reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
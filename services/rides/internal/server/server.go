@@ -2,26 +2,98 @@ package server
 
 import (
 	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/capture"
+	"rides/internal/clock"
 	"rides/internal/database"
+	"rides/internal/dispatcher"
+	"rides/internal/payouts"
+	"rides/internal/pricing"
+	"rides/internal/ratings"
+	"rides/internal/reconcile"
 	"rides/internal/services"
+	"time"
 )
 
 type Server struct {
 	db             *database.Database
 	userService    *services.UserService
 	paymentService *services.PaymentService
+	dispatcher     *dispatcher.Dispatcher
+	quotes         *pricing.QuoteSigner
+	payouts        *payouts.Generator
+	reconciler     *reconcile.Reconciler
+	captures       *capture.Queue
+	ratings        *ratings.Applier
+	authn          *auth.Authenticator
+	authz          *auth.Authorizer
+	clock          clock.Clock
+	config         Config
 }
 
-func NewServer(db *database.Database, userService *services.UserService, paymentService *services.PaymentService) *Server {
-	return &Server{db: db, userService: userService, paymentService: paymentService}
+// Config holds the tunable business rules of the rides API.
+type Config struct {
+	// PoolMatchWindow is how long after it was opened a pooled ride accepts new passengers.
+	PoolMatchWindow time.Duration
+	// TipWindow is how long after completion passengers can tip the driver.
+	TipWindow time.Duration
+	// CommissionPercent is the share of each fare, before taxes and the booking fee, kept by
+	// the platform.
+	CommissionPercent int64
+}
+
+func NewServer(db *database.Database, userService *services.UserService, paymentService *services.PaymentService, dispatcher *dispatcher.Dispatcher, quotes *pricing.QuoteSigner, payouts *payouts.Generator, reconciler *reconcile.Reconciler, captures *capture.Queue, ratings *ratings.Applier, authn *auth.Authenticator, audit *auth.AuditLog, clk clock.Clock, config Config) *Server {
+	return &Server{db: db, userService: userService, paymentService: paymentService, dispatcher: dispatcher, quotes: quotes, payouts: payouts, reconciler: reconciler, captures: captures, ratings: ratings, authn: authn, authz: auth.NewAuthorizer(policy, audit), clock: clk, config: config}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("POST /rides", s.createRide)
-	mux.HandleFunc("GET /rides/{id}", s.getRide)
-	mux.HandleFunc("PATCH /rides/{id}/status", s.updateRideStatus)
+	mux.HandleFunc("POST /quotes", s.authz.Require(permQuotesCreate, nil, s.createQuote))
+
+	mux.HandleFunc("POST /promotions", s.authz.Require(permPromotionsManage, nil, s.createPromotion))
+	mux.HandleFunc("GET /promotions", s.authz.Require(permPromotionsRead, nil, s.getPromotions))
+	mux.HandleFunc("GET /promotions/{code}", s.authz.Require(permPromotionsRead, nil, s.getPromotion))
+
+	// Rides are only visible to their passengers and driver; offers to the driver they are made to.
+	mux.HandleFunc("POST /rides", s.authz.Require(permRidesCreate, auth.Anyone, s.createRide))
+	mux.HandleFunc("GET /rides/{id}", s.authz.Require(permRidesRead, s.ownsRide, s.getRide))
+	mux.HandleFunc("PATCH /rides/{id}/status", s.authz.Require(permRidesUpdate, s.ownsRide, s.updateRideStatus))
+	mux.HandleFunc("POST /rides/{id}/stops", s.authz.Require(permRidesUpdate, s.ownsRide, s.addStop))
+	mux.HandleFunc("PATCH /rides/{id}/stops/{index}", s.authz.Require(permRidesDrive, s.ownsRide, s.updateStopStatus))
+	mux.HandleFunc("PATCH /rides/{id}/passengers/{passengerId}/status", s.authz.Require(permRidesDrive, s.ownsRide, s.updatePoolPassengerStatus))
+	mux.HandleFunc("GET /rides/{id}/driver/location", s.authz.Require(permRidesRead, s.ownsRide, s.trackDriver))
+	mux.HandleFunc("GET /rides/{id}/offers", s.authz.Require(permRidesRead, s.ownsRide, s.getRideOffers))
+	mux.HandleFunc("POST /rides/{id}/offers/{offerId}/accept", s.authz.Require(permOffersRespond, auth.Anyone, s.acceptOffer))
+	mux.HandleFunc("POST /rides/{id}/offers/{offerId}/decline", s.authz.Require(permOffersRespond, auth.Anyone, s.declineOffer))
+	mux.HandleFunc("POST /rides/{id}/ratings", s.authz.Require(permRidesRate, s.ownsRide, s.rateRide))
+	mux.HandleFunc("GET /rides/{id}/ratings", s.authz.Require(permRidesRead, s.ownsRide, s.getRideRatings))
+	mux.HandleFunc("POST /rides/{id}/tip", s.authz.Require(permRidesTip, s.ownsRide, s.tipRide))
+	mux.HandleFunc("GET /rides/{id}/receipt", s.authz.Require(permRidesRead, s.ownsRide, s.getRideReceipt))
+
+	mux.HandleFunc("GET /passengers/{id}/rides", s.authz.Require(permPassengerRides, auth.Self, s.getPassengerRides))
+
+	mux.HandleFunc("GET /drivers/{id}/offers", s.authz.Require(permOffersRead, auth.Self, s.getDriverOffers))
+	mux.HandleFunc("GET /drivers/{id}/earnings", s.authz.Require(permEarningsRead, auth.Self, s.getDriverEarnings))
+	mux.HandleFunc("POST /drivers/{id}/adjustments", s.authz.Require(permEarningsAdjust, nil, s.adjustDriverEarnings))
+	mux.HandleFunc("GET /drivers/{id}/statements", s.authz.Require(permEarningsRead, auth.Self, s.getDriverStatements))
+
+	mux.HandleFunc("POST /payouts/statements", s.authz.Require(permPayoutsGenerate, nil, s.generateStatements))
+
+	mux.HandleFunc("POST /payments/reconciliations", s.authz.Require(permPaymentsManage, nil, s.reconcilePayments))
+	mux.HandleFunc("GET /payments/reconciliations", s.authz.Require(permPaymentsManage, nil, s.getReconciliations))
+	mux.HandleFunc("GET /payments/captures", s.authz.Require(permPaymentsManage, nil, s.getCaptureJobs))
+	mux.HandleFunc("GET /payments/captures/dead", s.authz.Require(permPaymentsManage, nil, s.getDeadCaptureJobs))
+	mux.HandleFunc("POST /payments/captures/dead/{id}/requeue", s.authz.Require(permPaymentsManage, nil, s.requeueCaptureJob))
+
+	mux.HandleFunc("GET /exports/rides", s.authz.Require(permRidesExport, nil, s.exportRides))
+
+	mux.HandleFunc("GET /analytics/zone-pairs", s.authz.Require(permAnalyticsRead, nil, s.getZonePairAnalytics))
+	mux.HandleFunc("GET /analytics/revenue", s.authz.Require(permAnalyticsRead, nil, s.getRevenueAnalytics))
+	mux.HandleFunc("GET /analytics/completion", s.authz.Require(permAnalyticsRead, nil, s.getCompletionAnalytics))
+	mux.HandleFunc("GET /analytics/drivers", s.authz.Require(permAnalyticsRead, nil, s.getDriverActivityAnalytics))
+
+	mux.HandleFunc("GET /zones", s.authz.Require(permZonesRead, nil, s.getZones))
 
-	mux.ServeHTTP(w, r)
+	s.authn.Middleware(mux).ServeHTTP(w, r)
 }
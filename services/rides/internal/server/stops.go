@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/pricing"
+	"rides/internal/types"
+	"rides/internal/zones"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *Server) updateStopStatus(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 {
+		http.Error(w, "Invalid stop index", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Status != types.StopArrived && req.Status != types.StopDeparted {
+		http.Error(w, "Status must be ARRIVED or DEPARTED", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, ok := s.loadRide(ctx, w, id)
+	if !ok {
+		return
+	}
+
+	if !slices.Contains(types.ActiveStatuses, ride.Status) {
+		http.Error(w, "Ride is not active", http.StatusConflict)
+		return
+	}
+	if len(ride.Stops) == 0 {
+		http.Error(w, "Ride does not track stops", http.StatusConflict)
+		return
+	}
+	if index >= len(ride.Stops) {
+		http.Error(w, "Stop not found", http.StatusNotFound)
+		return
+	}
+
+	stop := ride.Stops[index]
+	var from string
+	switch req.Status {
+	case types.StopArrived:
+		if index > 0 && ride.Stops[index-1].Status != types.StopDeparted {
+			http.Error(w, "Previous stop has not been departed yet", http.StatusConflict)
+			return
+		}
+		from = types.StopPending
+	case types.StopDeparted:
+		if index == len(ride.Stops)-1 {
+			http.Error(w, "Cannot depart from the destination", http.StatusConflict)
+			return
+		}
+		from = types.StopArrived
+	}
+	if stop.Status != from {
+		http.Error(w, fmt.Sprintf("Stop is %s, expected %s", stop.Status, from), http.StatusConflict)
+		return
+	}
+
+	updated, err := s.db.UpdateStopStatus(ctx, id, index, from, req.Status, s.clock.Now())
+	if err != nil {
+		log.Printf("[ERROR] Failed to update stop status: %v", err)
+		http.Error(w, "Error updating stop status", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Stop was updated concurrently", http.StatusConflict)
+		return
+	}
+
+	log.Printf("[UPDATE] Course %s, arrêt %d (%s): %s", idStr, index, stop.Zone, req.Status)
+
+	s.writeRide(ctx, w, id)
+}
+
+func (s *Server) addStop(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		PassengerID string `json:"passengerId"`
+		Zone        string `json:"zone"`
+		Position    *int   `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.actingAs(w, r, permRidesUpdate, auth.RolePassenger, &req.PassengerID) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, ok := s.loadRide(ctx, w, id)
+	if !ok {
+		return
+	}
+
+	if req.PassengerID != ride.PassengerID {
+		http.Error(w, "Only the ride's passenger can add a stop", http.StatusForbidden)
+		return
+	}
+	if ride.Status != types.StatusScheduled && !slices.Contains(types.ActiveStatuses, ride.Status) {
+		http.Error(w, "Ride is not active", http.StatusConflict)
+		return
+	}
+	if len(ride.Stops) == 0 {
+		http.Error(w, "Ride does not track stops", http.StatusConflict)
+		return
+	}
+
+	// A stop can only be inserted after the last visited one and before the destination.
+	first := 1
+	for i, stop := range ride.Stops {
+		if stop.Status != types.StopPending {
+			first = max(first, i+1)
+		}
+	}
+	last := len(ride.Stops) - 1
+	position := last
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	errs := fieldErrors{}
+	zone, known := zones.Lookup(req.Zone)
+	switch {
+	case req.Zone == "":
+		errs["zone"] = "required"
+	case !known:
+		errs["zone"] = fmt.Sprintf("unknown zone %q", req.Zone)
+	}
+	switch {
+	case len(ride.Stops)-2 >= maxVia:
+		errs["zone"] = fmt.Sprintf("at most %d intermediate stops", maxVia)
+	case first > last:
+		errs["position"] = "the destination has already been reached"
+	case position < first || position > last:
+		errs["position"] = fmt.Sprintf("must be between %d and %d", first, last)
+	case known && (zone == ride.Stops[position-1].Zone || zone == ride.Stops[position].Zone):
+		errs["zone"] = "must differ from the neighbouring stops"
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid stop", errs)
+		return
+	}
+
+	oldRoute := make([]string, len(ride.Stops))
+	for i, stop := range ride.Stops {
+		oldRoute[i] = stop.Zone
+	}
+	stops := slices.Insert(slices.Clone(ride.Stops), position, types.Stop{Zone: zone, Status: types.StopPending})
+	newRoute := slices.Insert(slices.Clone(oldRoute), position, zone)
+
+	// Rides booked before fares were itemized are repriced from their original route.
+	fare := pricing.PriceRoute(oldRoute)
+	if ride.Fare != nil {
+		fare = *ride.Fare
+	}
+	fare = pricing.Reprice(fare, oldRoute, newRoute)
+
+	// The stops are saved before the payment authorization is raised, and taken back if it
+	// cannot be, so that an authorization is never raised for a stop that was not added.
+	now := s.clock.Now()
+	updated, err := s.db.ReplaceStops(ctx, id, ride.UpdatedAt, now, stops, fare)
+	if err != nil {
+		log.Printf("[ERROR] Failed to add stop to ride %s: %v", idStr, err)
+		http.Error(w, "Error adding stop", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Ride was modified concurrently", http.StatusConflict)
+		return
+	}
+
+	if delta := fare.Total.Sub(ride.Price); delta.IsPositive() && ride.PaymentID != "" {
+		if err := s.paymentService.IncrementAuthorization(ride.PaymentID, delta); err != nil {
+			log.Printf("[ERROR] Failed to increment payment authorization: %v", err)
+			if restored, err := s.db.RestoreStops(ctx, ride, now); err != nil || !restored {
+				log.Printf("[ERROR] Failed to remove stop from ride %s after payment %s was not adjusted (restored=%t): %v", idStr, ride.PaymentID, restored, err)
+			}
+			http.Error(w, "Failed to adjust payment authorization", http.StatusBadGateway)
+			return
+		}
+	}
+
+	log.Printf("[UPDATE] Course %s: arrêt %s ajouté en position %d, nouveau prix %s", idStr, zone, position, fare.Total)
+
+	s.writeRide(ctx, w, id)
+}
+
+// loadRide fetches a ride, answering 404 or 500 itself when it cannot.
+func (s *Server) loadRide(ctx context.Context, w http.ResponseWriter, id primitive.ObjectID) (*types.Ride, bool) {
+	ride, err := s.db.GetRideByID(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Ride not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("[ERROR] Failed to get ride: %v", err)
+		http.Error(w, "Error retrieving ride", http.StatusInternalServerError)
+		return nil, false
+	}
+	return ride, true
+}
+
+// writeRide answers with the current state of the ride.
+func (s *Server) writeRide(ctx context.Context, w http.ResponseWriter, id primitive.ObjectID) {
+	ride, err := s.db.GetRideByID(ctx, id)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get updated ride: %v", err)
+		http.Error(w, "Error retrieving updated ride", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ride)
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"ridenow/pkg/auth"
+	"rides/internal/money"
+	"rides/internal/types"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxTip bounds the amount of a single tip, in cents.
+const maxTip = 10000
+
+// tipRide charges a tip from a passenger of a completed ride, within TipWindow of completion.
+// The tip is captured right away and credited to the driver apart from the fare.
+func (s *Server) tipRide(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		PassengerID string      `json:"passengerId"`
+		Amount      money.Money `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.actingAs(w, r, permRidesTip, auth.RolePassenger, &req.PassengerID) {
+		return
+	}
+
+	amount := req.Amount
+	if !amount.IsPositive() || amount.GreaterThan(money.Cents(maxTip)) {
+		writeFieldErrors(w, "Invalid tip", fieldErrors{"amount": fmt.Sprintf("must be between 0.01 and %s", money.Cents(maxTip).Decimal())})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, ok := s.loadRide(ctx, w, id)
+	if !ok {
+		return
+	}
+	if ride.Status != types.StatusCompleted || ride.CompletedAt == nil {
+		http.Error(w, "Ride is not completed", http.StatusConflict)
+		return
+	}
+	if s.clock.Now().After(ride.CompletedAt.Add(s.config.TipWindow)) {
+		http.Error(w, "Tipping window has closed", http.StatusConflict)
+		return
+	}
+	if !slices.Contains(ridePassengers(ride), req.PassengerID) {
+		http.Error(w, "Only the ride's passengers can tip", http.StatusForbidden)
+		return
+	}
+
+	// The tip is reserved on the ride first, so that a passenger cannot be charged twice.
+	added, err := s.db.AddTip(ctx, id, types.Tip{
+		PassengerID:   req.PassengerID,
+		Amount:        amount,
+		PaymentStatus: "PENDING",
+		CreatedAt:     s.clock.Now(),
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to add tip: %v", err)
+		http.Error(w, "Error adding tip", http.StatusInternalServerError)
+		return
+	}
+	if !added {
+		http.Error(w, "Ride already tipped", http.StatusConflict)
+		return
+	}
+
+	paymentID, err := s.paymentService.ChargeTip(ride.ID.Hex(), amount)
+	if err != nil {
+		log.Printf("[WARN] Failed to charge tip: %v", err)
+		if paymentID != "" {
+			// Authorized but not captured: keep it so it can be settled later.
+			if err := s.db.SetTipPayment(ctx, id, req.PassengerID, paymentID, "AUTHORIZED"); err != nil {
+				log.Printf("[ERROR] Failed to record tip payment %s: %v", paymentID, err)
+			}
+		} else if err := s.db.RemoveTip(ctx, id, req.PassengerID); err != nil {
+			log.Printf("[ERROR] Failed to remove tip of passenger %s: %v", req.PassengerID, err)
+		}
+		http.Error(w, "Failed to charge tip", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.SetTipPayment(ctx, id, req.PassengerID, paymentID, "CAPTURED"); err != nil {
+		log.Printf("[ERROR] Failed to record tip payment %s: %v", paymentID, err)
+	}
+	s.creditTip(ctx, ride, amount, paymentID)
+
+	log.Printf("[UPDATE] Course %s: pourboire de %s du passager %s", idStr, amount, req.PassengerID)
+
+	ride, err = s.db.GetRideByID(ctx, id)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get updated ride: %v", err)
+		http.Error(w, "Error retrieving updated ride", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ride)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"rides/internal/types"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// trackDriver lets the passenger follow the ride's driver: it opens a WebSocket and relays the
+// positions pushed by the users service for the assigned driver until either side closes.
+func (s *Server) trackDriver(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ride, ok := s.loadRide(ctx, w, id)
+	if !ok {
+		return
+	}
+	if ride.DriverID == "" || !slices.Contains(types.ActiveStatuses, ride.Status) {
+		http.Error(w, "Ride has no active driver", http.StatusConflict)
+		return
+	}
+
+	upstream, err := s.userService.SubscribeDriverLocation(ctx, ride.DriverID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to subscribe to driver location: %v", err)
+		http.Error(w, "Driver location unavailable", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	log.Printf("[TRACK] Suivi du chauffeur %s pour la course %s", ride.DriverID, idStr)
+
+	// Closing either connection ends both relays.
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				upstream.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		_, data, err := upstream.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rides/internal/pricing"
+	"rides/internal/services"
+	"rides/internal/types"
+	"rides/internal/zones"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fieldErrors maps a request field (as named in the JSON body) to the reason it was rejected.
+type fieldErrors map[string]string
+
+func writeFieldErrors(w http.ResponseWriter, message string, errs fieldErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Error  string      `json:"error"`
+		Fields fieldErrors `json:"fields"`
+	}{
+		Error:  message,
+		Fields: errs,
+	})
+}
+
+// maxVia bounds the number of intermediate stops on a ride.
+const maxVia = 5
+
+// validateRoute checks every zone of the route against the catalog and returns the route's
+// canonical zones, from origin to destination. Consecutive stops must differ.
+func validateRoute(errs fieldErrors, from string, via []string, to string) []string {
+	if len(via) > maxVia {
+		errs["via"] = fmt.Sprintf("at most %d intermediate stops", maxVia)
+	}
+
+	fields := make([]string, 0, len(via)+2)
+	fields = append(fields, "from_zone")
+	for i := range via {
+		fields = append(fields, fmt.Sprintf("via[%d]", i))
+	}
+	fields = append(fields, "to_zone")
+
+	raw := pricing.Route(from, via, to)
+	route := make([]string, len(raw))
+	for i, name := range raw {
+		zone, ok := zones.Lookup(name)
+		switch {
+		case name == "":
+			errs[fields[i]] = "required"
+		case !ok:
+			errs[fields[i]] = fmt.Sprintf("unknown zone %q", name)
+		case i > 0 && zone == route[i-1]:
+			errs[fields[i]] = "must differ from the previous stop"
+		}
+		route[i] = zone
+	}
+
+	return route
+}
+
+// maxScheduleAhead bounds how far in advance a ride can be booked.
+const maxScheduleAhead = 30 * 24 * time.Hour
+
+func validateSchedule(errs fieldErrors, scheduledAt *time.Time, now time.Time) {
+	if scheduledAt == nil {
+		return
+	}
+	switch {
+	case !scheduledAt.After(now):
+		errs["scheduledAt"] = "must be in the future"
+	case scheduledAt.Sub(now) > maxScheduleAhead:
+		errs["scheduledAt"] = "must be within 30 days"
+	}
+}
+
+func validateMode(errs fieldErrors, mode string, via []string, scheduledAt *time.Time) {
+	switch mode {
+	case "", types.ModeExclusive:
+	case types.ModePool:
+		if len(via) > 0 {
+			errs["via"] = "not supported for pooled rides"
+		}
+		if scheduledAt != nil {
+			errs["scheduledAt"] = "not supported for pooled rides"
+		}
+	default:
+		errs["mode"] = "must be EXCLUSIVE or POOL"
+	}
+}
+
+// validatePassenger checks that the passenger exists in the users service. Only failures to
+// reach the users service are returned as an error; an unknown passenger is a field error.
+func (s *Server) validatePassenger(errs fieldErrors, passengerID string) error {
+	if passengerID == "" {
+		errs["passengerId"] = "required"
+		return nil
+	}
+	if !primitive.IsValidObjectID(passengerID) {
+		errs["passengerId"] = "must be a valid passenger ID"
+		return nil
+	}
+
+	_, err := s.userService.GetPassenger(passengerID)
+	if errors.Is(err, services.ErrPassengerNotFound) {
+		errs["passengerId"] = "passenger not found"
+		return nil
+	}
+	return err
+}
@@ -3,12 +3,76 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"rides/internal/money"
+	"strings"
 	"time"
 )
 
+// Errors answered by the payment service. They are matched with errors.Is against the
+// *PaymentError the client returns, which also carries the service's own message.
+var (
+	// ErrPaymentNotFound is answered with a 404.
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrInvalidPaymentRequest is answered with a 400, e.g. for a refund above the captured amount.
+	ErrInvalidPaymentRequest = errors.New("invalid payment request")
+	// ErrPaymentConflict is answered with a 409, when the payment's status does not allow the
+	// operation.
+	ErrPaymentConflict = errors.New("payment status conflict")
+	// ErrPaymentAlreadyCaptured is a conflict on a payment that was already captured, including
+	// one refunded since.
+	ErrPaymentAlreadyCaptured = errors.New("payment already captured")
+	// ErrPaymentServiceUnavailable is answered with a 5xx; retrying later may succeed.
+	ErrPaymentServiceUnavailable = errors.New("payment service unavailable")
+)
+
+// PaymentError is an error status answered by the payment service.
+type PaymentError struct {
+	StatusCode int
+	// Message is the error reported by the payment service.
+	Message string
+	// PaymentStatus is the payment's status, reported along with conflicts.
+	PaymentStatus string
+}
+
+func (e *PaymentError) Error() string {
+	if e.PaymentStatus != "" {
+		return fmt.Sprintf("payment service returned status %d: %s (payment is %s)", e.StatusCode, e.Message, e.PaymentStatus)
+	}
+	return fmt.Sprintf("payment service returned status %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *PaymentError) Is(target error) bool {
+	switch target {
+	case ErrPaymentNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrInvalidPaymentRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrPaymentConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrPaymentAlreadyCaptured:
+		return e.StatusCode == http.StatusConflict && IsCapturedPaymentStatus(e.PaymentStatus)
+	case ErrPaymentServiceUnavailable:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// newPaymentError reads the {error, status} body the payment service answers errors with.
+func newPaymentError(statusCode int, body []byte) *PaymentError {
+	var answer struct {
+		Error  string `json:"error"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &answer); err != nil || answer.Error == "" {
+		answer.Error = strings.TrimSpace(string(body))
+	}
+	return &PaymentError{StatusCode: statusCode, Message: answer.Error, PaymentStatus: answer.Status}
+}
+
 type PaymentService struct {
 	paymentServiceURL string
 	client            *http.Client
@@ -23,9 +87,38 @@ func NewPaymentService(paymentServiceURL string) *PaymentService {
 	}
 }
 
+// Payment kinds: a ride's fare and the tips added after it are separate payments.
+const (
+	PaymentKindFare = "FARE"
+	PaymentKindTip  = "TIP"
+)
+
+// Payment statuses. An authorized payment is either captured or voided; a captured one can then
+// be refunded, in one or several times.
+const (
+	PaymentStatusAuthorized        = "AUTHORIZED"
+	PaymentStatusCaptured          = "CAPTURED"
+	PaymentStatusVoided            = "VOIDED"
+	PaymentStatusPartiallyRefunded = "PARTIALLY_REFUNDED"
+	PaymentStatusRefunded          = "REFUNDED"
+)
+
+// IsCapturedPaymentStatus reports whether a payment in this status was captured, even if it was
+// refunded since.
+func IsCapturedPaymentStatus(status string) bool {
+	switch status {
+	case PaymentStatusCaptured, PaymentStatusPartiallyRefunded, PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// Amounts are sent as decimal numbers of major units, along with their currency.
 type AuthorizeRequest struct {
-	RideID string  `json:"ride_id"`
-	Amount float64 `json:"amount"`
+	RideID   string      `json:"ride_id"`
+	Amount   money.Money `json:"amount"`
+	Currency string      `json:"currency"`
+	Kind     string      `json:"kind"`
 }
 
 type AuthorizeResponse struct {
@@ -33,6 +126,29 @@ type AuthorizeResponse struct {
 	Status    string `json:"status"`
 }
 
+type IncrementRequest struct {
+	Amount   money.Money `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+type IncrementResponse struct {
+	PaymentID string      `json:"payment_id"`
+	Status    string      `json:"status"`
+	Amount    money.Money `json:"amount"`
+}
+
+// Payment is the state of a payment as recorded by the payment service.
+type Payment struct {
+	PaymentID      string      `json:"payment_id"`
+	RideID         string      `json:"ride_id"`
+	Amount         money.Money `json:"amount"`
+	RefundedAmount money.Money `json:"refunded_amount"`
+	Currency       string      `json:"currency"`
+	Status         string      `json:"status"`
+	Kind           string      `json:"kind"`
+	Timestamp      time.Time   `json:"timestamp"`
+}
+
 type CaptureRequest struct {
 	PaymentID string `json:"payment_id"`
 }
@@ -42,67 +158,144 @@ type CaptureResponse struct {
 	Status    string `json:"status"`
 }
 
-func (s *PaymentService) AuthorizePayment(rideID string, amount float64) (string, error) {
-	url := fmt.Sprintf("%s/payments/authorize", s.paymentServiceURL)
+type VoidResponse struct {
+	PaymentID string `json:"payment_id"`
+	Status    string `json:"status"`
+}
 
-	reqBody := AuthorizeRequest{
-		RideID: rideID,
-		Amount: amount,
-	}
+// RefundRequest refunds the given amount, or whatever is left to refund when it is nil.
+type RefundRequest struct {
+	Amount   *money.Money `json:"amount,omitempty"`
+	Currency string       `json:"currency,omitempty"`
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+// RefundResponse holds the captured amount and the total refunded so far, this refund included.
+type RefundResponse struct {
+	PaymentID      string      `json:"payment_id"`
+	Status         string      `json:"status"`
+	Amount         money.Money `json:"amount"`
+	RefundedAmount money.Money `json:"refunded_amount"`
+	Currency       string      `json:"currency"`
+}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
+func (s *PaymentService) AuthorizePayment(rideID string, amount money.Money) (string, error) {
+	return s.authorize(rideID, amount, PaymentKindFare)
+}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+// AuthorizeTip authorizes a tip on a ride, separately from its fare.
+func (s *PaymentService) AuthorizeTip(rideID string, amount money.Money) (string, error) {
+	return s.authorize(rideID, amount, PaymentKindTip)
+}
 
-	resp, err := s.client.Do(httpReq)
+// ChargeTip authorizes and immediately captures a tip. When the capture fails, the ID of the
+// authorized payment is returned along with the error.
+func (s *PaymentService) ChargeTip(rideID string, amount money.Money) (string, error) {
+	paymentID, err := s.AuthorizeTip(rideID, amount)
 	if err != nil {
-		return "", fmt.Errorf("failed to call payment service: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	if err := s.CapturePayment(paymentID); err != nil {
+		return paymentID, err
 	}
+	return paymentID, nil
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("payment service returned status %d: %s", resp.StatusCode, string(body))
+func (s *PaymentService) authorize(rideID string, amount money.Money, kind string) (string, error) {
+	reqBody := AuthorizeRequest{
+		RideID:   rideID,
+		Amount:   amount,
+		Currency: amount.Currency,
+		Kind:     kind,
 	}
 
 	var authorizeResp AuthorizeResponse
-	if err := json.Unmarshal(body, &authorizeResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	if err := s.call("POST", "/payments/authorize", reqBody, http.StatusCreated, &authorizeResp); err != nil {
+		return "", err
 	}
-
 	return authorizeResp.PaymentID, nil
 }
 
+// CapturePayment captures an authorized payment. Capturing it again fails with
+// ErrPaymentAlreadyCaptured.
 func (s *PaymentService) CapturePayment(paymentID string) error {
-	url := fmt.Sprintf("%s/payments/capture", s.paymentServiceURL)
-
 	reqBody := CaptureRequest{
 		PaymentID: paymentID,
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+	var captureResp CaptureResponse
+	return s.call("POST", "/payments/capture", reqBody, http.StatusOK, &captureResp)
+}
+
+// IncrementAuthorization raises an authorized payment's amount by the given amount.
+func (s *PaymentService) IncrementAuthorization(paymentID string, amount money.Money) error {
+	reqBody := IncrementRequest{
+		Amount:   amount,
+		Currency: amount.Currency,
+	}
+
+	var incrementResp IncrementResponse
+	return s.call("POST", fmt.Sprintf("/payments/%s/increment", paymentID), reqBody, http.StatusOK, &incrementResp)
+}
+
+// VoidPayment releases an authorized payment that will not be captured. A captured payment
+// cannot be voided, it has to be refunded.
+func (s *PaymentService) VoidPayment(paymentID string) error {
+	var voidResp VoidResponse
+	return s.call("POST", fmt.Sprintf("/payments/%s/void", paymentID), nil, http.StatusOK, &voidResp)
+}
+
+// RefundPayment refunds whatever is left to refund of a captured payment.
+func (s *PaymentService) RefundPayment(paymentID string) (*RefundResponse, error) {
+	return s.refund(paymentID, RefundRequest{})
+}
+
+// PartiallyRefundPayment refunds part of a captured payment. Refunding more than is left to
+// refund fails with ErrInvalidPaymentRequest.
+func (s *PaymentService) PartiallyRefundPayment(paymentID string, amount money.Money) (*RefundResponse, error) {
+	return s.refund(paymentID, RefundRequest{Amount: &amount, Currency: amount.Currency})
+}
+
+func (s *PaymentService) refund(paymentID string, reqBody RefundRequest) (*RefundResponse, error) {
+	var refundResp RefundResponse
+	if err := s.call("POST", fmt.Sprintf("/payments/%s/refund", paymentID), reqBody, http.StatusOK, &refundResp); err != nil {
+		return nil, err
+	}
+	refundResp.Amount.Currency = refundResp.Currency
+	refundResp.RefundedAmount.Currency = refundResp.Currency
+	return &refundResp, nil
+}
+
+// GetPayment returns the payment's current state at the payment service.
+func (s *PaymentService) GetPayment(paymentID string) (*Payment, error) {
+	var payment Payment
+	if err := s.call("GET", fmt.Sprintf("/payments/%s", paymentID), nil, http.StatusOK, &payment); err != nil {
+		return nil, err
+	}
+	payment.Amount.Currency = payment.Currency
+	payment.RefundedAmount.Currency = payment.Currency
+
+	return &payment, nil
+}
+
+// call sends a request to the payment service, with reqBody as JSON unless nil, and decodes its
+// answer into respBody. Any status other than want is returned as a *PaymentError.
+func (s *PaymentService) call(method, path string, reqBody any, want int, respBody any) error {
+	var body io.Reader
+	if reqBody != nil {
+		jsonData, err := json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequest(method, s.paymentServiceURL+path, body)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
+	if reqBody != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := s.client.Do(httpReq)
 	if err != nil {
@@ -110,19 +303,17 @@ func (s *PaymentService) CapturePayment(paymentID string) error {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("payment service returned status %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode != want {
+		return newPaymentError(resp.StatusCode, data)
 	}
 
-	var captureResp CaptureResponse
-	if err := json.Unmarshal(body, &captureResp); err != nil {
+	if err := json.Unmarshal(data, respBody); err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
-
 	return nil
 }
@@ -0,0 +1,153 @@
+package services_test
+
+import (
+	"errors"
+	"net/http"
+	"rides/internal/clock"
+	"rides/internal/money"
+	"rides/internal/services"
+	"rides/internal/services/paymenttest"
+	"testing"
+	"time"
+)
+
+func newPaymentServer(t *testing.T) (*paymenttest.Server, *services.PaymentService) {
+	t.Helper()
+	stub := paymenttest.NewServer(clock.NewMock(time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)))
+	t.Cleanup(stub.Close)
+	return stub, stub.PaymentService()
+}
+
+// paymentStatus returns the status of a payment at the stub.
+func paymentStatus(t *testing.T, stub *paymenttest.Server, paymentID string) string {
+	t.Helper()
+	p, ok := stub.Payment(paymentID)
+	if !ok {
+		t.Fatalf("payment %s not found", paymentID)
+	}
+	return p.Status
+}
+
+func TestVoidPayment(t *testing.T) {
+	stub, payments := newPaymentServer(t)
+	id, err := payments.AuthorizePayment("ride-1", money.Cents(2500))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := payments.VoidPayment(id); err != nil {
+		t.Fatalf("VoidPayment: %v", err)
+	}
+	if got := paymentStatus(t, stub, id); got != services.PaymentStatusVoided {
+		t.Errorf("status = %s, want %s", got, services.PaymentStatusVoided)
+	}
+
+	// A voided payment can no longer be captured, and is not reported as captured.
+	err = payments.CapturePayment(id)
+	if !errors.Is(err, services.ErrPaymentConflict) || errors.Is(err, services.ErrPaymentAlreadyCaptured) {
+		t.Errorf("capture of a voided payment: got %v, want a conflict other than ErrPaymentAlreadyCaptured", err)
+	}
+}
+
+func TestVoidPaymentErrors(t *testing.T) {
+	stub, payments := newPaymentServer(t)
+	captured := stub.Add(services.Payment{Amount: money.Cents(2500), Status: services.PaymentStatusCaptured})
+	refunded := stub.Add(services.Payment{Amount: money.Cents(2500), RefundedAmount: money.Cents(2500), Status: services.PaymentStatusRefunded})
+	voided := stub.Add(services.Payment{Amount: money.Cents(2500), Status: services.PaymentStatusVoided})
+
+	tests := []struct {
+		name      string
+		paymentID string
+		want      error
+		captured  bool
+	}{
+		{"captured", captured, services.ErrPaymentAlreadyCaptured, true},
+		{"refunded", refunded, services.ErrPaymentAlreadyCaptured, true},
+		{"voided", voided, services.ErrPaymentConflict, false},
+		{"unknown", "P-unknown", services.ErrPaymentNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := payments.VoidPayment(tt.paymentID)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if got := errors.Is(err, services.ErrPaymentAlreadyCaptured); got != tt.captured {
+				t.Errorf("errors.Is(err, ErrPaymentAlreadyCaptured) = %t, want %t", got, tt.captured)
+			}
+			var perr *services.PaymentError
+			if !errors.As(err, &perr) || perr.Message == "" {
+				t.Errorf("got %#v, want a *PaymentError with the service's message", err)
+			}
+		})
+	}
+}
+
+func TestRefundPayment(t *testing.T) {
+	stub, payments := newPaymentServer(t)
+	id := stub.Add(services.Payment{Amount: money.Cents(2500), Status: services.PaymentStatusCaptured})
+
+	refund, err := payments.PartiallyRefundPayment(id, money.Cents(1000))
+	if err != nil {
+		t.Fatalf("PartiallyRefundPayment: %v", err)
+	}
+	if refund.Status != services.PaymentStatusPartiallyRefunded || refund.RefundedAmount != money.Cents(1000) || refund.Amount != money.Cents(2500) {
+		t.Errorf("partial refund = %+v, want 10.00 of 25.00 refunded", refund)
+	}
+
+	// Refunding more than is left is rejected without touching the payment.
+	_, err = payments.PartiallyRefundPayment(id, money.Cents(2000))
+	if !errors.Is(err, services.ErrInvalidPaymentRequest) {
+		t.Errorf("refund above the remaining amount: got %v, want ErrInvalidPaymentRequest", err)
+	}
+
+	refund, err = payments.RefundPayment(id)
+	if err != nil {
+		t.Fatalf("RefundPayment: %v", err)
+	}
+	if refund.Status != services.PaymentStatusRefunded || refund.RefundedAmount != money.Cents(2500) {
+		t.Errorf("refund = %+v, want all 25.00 refunded", refund)
+	}
+
+	// A fully refunded payment was still captured: it can neither be refunded nor voided.
+	if _, err := payments.RefundPayment(id); !errors.Is(err, services.ErrPaymentConflict) {
+		t.Errorf("refund of a refunded payment: got %v, want ErrPaymentConflict", err)
+	}
+	if err := payments.VoidPayment(id); !errors.Is(err, services.ErrPaymentAlreadyCaptured) {
+		t.Errorf("void of a refunded payment: got %v, want ErrPaymentAlreadyCaptured", err)
+	}
+}
+
+func TestRefundPaymentErrors(t *testing.T) {
+	stub, payments := newPaymentServer(t)
+	authorized := stub.Add(services.Payment{Amount: money.Cents(2500), Status: services.PaymentStatusAuthorized})
+
+	if _, err := payments.RefundPayment(authorized); !errors.Is(err, services.ErrPaymentConflict) || errors.Is(err, services.ErrPaymentAlreadyCaptured) {
+		t.Errorf("refund of an authorized payment: got %v, want a conflict other than ErrPaymentAlreadyCaptured", err)
+	}
+	if _, err := payments.PartiallyRefundPayment("P-unknown", money.Cents(100)); !errors.Is(err, services.ErrPaymentNotFound) {
+		t.Errorf("refund of an unknown payment: got %v, want ErrPaymentNotFound", err)
+	}
+	if got := paymentStatus(t, stub, authorized); got != services.PaymentStatusAuthorized {
+		t.Errorf("status = %s, want it left %s", got, services.PaymentStatusAuthorized)
+	}
+}
+
+func TestPaymentServiceUnavailable(t *testing.T) {
+	stub, payments := newPaymentServer(t)
+	id := stub.Add(services.Payment{Amount: money.Cents(2500), Status: services.PaymentStatusAuthorized})
+
+	stub.Fail(paymenttest.OpVoid, http.StatusServiceUnavailable)
+	err := payments.VoidPayment(id)
+	if !errors.Is(err, services.ErrPaymentServiceUnavailable) {
+		t.Fatalf("got %v, want ErrPaymentServiceUnavailable", err)
+	}
+	if errors.Is(err, services.ErrPaymentConflict) {
+		t.Errorf("an unavailable service is reported as a conflict: %v", err)
+	}
+
+	stub.Fail(paymenttest.OpVoid, 0)
+	if err := payments.VoidPayment(id); err != nil {
+		t.Errorf("VoidPayment once the service is back: %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+// Package paymenttest provides an in-memory payment service for tests. It answers the routes of
+// services/payment with the same statuses and bodies, so code using services.PaymentService can
+// be exercised without Express nor PostgreSQL.
+package paymenttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"rides/internal/clock"
+	"rides/internal/money"
+	"rides/internal/services"
+	"sort"
+	"sync"
+)
+
+// Operations, as passed to Server.Fail.
+const (
+	OpAuthorize = "authorize"
+	OpCapture   = "capture"
+	OpIncrement = "increment"
+	OpVoid      = "void"
+	OpRefund    = "refund"
+	OpGet       = "get"
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Server is a running stub payment service. Close it once done.
+type Server struct {
+	*httptest.Server
+
+	clock    clock.Clock
+	mu       sync.Mutex
+	payments map[string]*services.Payment
+	failures map[string]int
+	lastID   int
+}
+
+// NewServer starts a stub payment service timestamping payments with clk.
+func NewServer(clk clock.Clock) *Server {
+	s := &Server{
+		clock:    clk,
+		payments: map[string]*services.Payment{},
+		failures: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payments/authorize", s.failable(OpAuthorize, s.authorize))
+	mux.HandleFunc("POST /payments/capture", s.failable(OpCapture, s.capture))
+	mux.HandleFunc("POST /payments/{id}/increment", s.failable(OpIncrement, s.increment))
+	mux.HandleFunc("POST /payments/{id}/void", s.failable(OpVoid, s.void))
+	mux.HandleFunc("POST /payments/{id}/refund", s.failable(OpRefund, s.refund))
+	mux.HandleFunc("GET /payments/{id}", s.failable(OpGet, s.get))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// PaymentService returns a client of the stub.
+func (s *Server) PaymentService() *services.PaymentService {
+	return services.NewPaymentService(s.URL)
+}
+
+// Add records a payment in whatever status, as if earlier requests had left it so, and returns
+// its ID. An ID is generated when the payment has none.
+func (s *Server) Add(p services.Payment) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.PaymentID == "" {
+		p.PaymentID = s.nextID()
+	}
+	if p.Currency == "" {
+		p.Currency = money.DefaultCurrency
+	}
+	if p.Kind == "" {
+		p.Kind = services.PaymentKindFare
+	}
+	if p.Timestamp.IsZero() {
+		p.Timestamp = s.clock.Now()
+	}
+	p.Amount.Currency = p.Currency
+	p.RefundedAmount.Currency = p.Currency
+	s.payments[p.PaymentID] = &p
+	return p.PaymentID
+}
+
+// Payment returns the current state of a payment.
+func (s *Server) Payment(paymentID string) (services.Payment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[paymentID]
+	if !ok {
+		return services.Payment{}, false
+	}
+	return *p, true
+}
+
+// Payments returns every payment, ordered by ID.
+func (s *Server) Payments() []services.Payment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payments := make([]services.Payment, 0, len(s.payments))
+	for _, p := range s.payments {
+		payments = append(payments, *p)
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].PaymentID < payments[j].PaymentID })
+	return payments
+}
+
+// Fail makes an operation answer statusCode, without touching any payment, until it is called
+// again with 0.
+func (s *Server) Fail(op string, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if statusCode == 0 {
+		delete(s.failures, op)
+		return
+	}
+	s.failures[op] = statusCode
+}
+
+// nextID returns sequential IDs, so tests can tell payments apart by their order. The caller
+// holds s.mu.
+func (s *Server) nextID() string {
+	s.lastID++
+	return fmt.Sprintf("P-%06d", s.lastID)
+}
+
+// failable answers with the failure set for op, if any, and calls handler otherwise. Handlers
+// run with s.mu held.
+func (s *Server) failable(op string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if statusCode, ok := s.failures[op]; ok {
+			writeJSON(w, statusCode, map[string]any{"error": http.StatusText(statusCode)})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+type authorizeRequest struct {
+	RideID   string       `json:"ride_id"`
+	Amount   *money.Money `json:"amount"`
+	Currency string       `json:"currency"`
+	Kind     string       `json:"kind"`
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest{Currency: money.DefaultCurrency, Kind: services.PaymentKindFare}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RideID == "" || req.Amount == nil || !req.Amount.IsPositive() {
+		writeError(w, http.StatusBadRequest, "Invalid ride_id or amount")
+		return
+	}
+	if req.Kind != services.PaymentKindFare && req.Kind != services.PaymentKindTip {
+		writeError(w, http.StatusBadRequest, "Invalid kind")
+		return
+	}
+	if !currencyPattern.MatchString(req.Currency) {
+		writeError(w, http.StatusBadRequest, "Invalid currency")
+		return
+	}
+
+	p := &services.Payment{
+		PaymentID:      s.nextID(),
+		RideID:         req.RideID,
+		Amount:         money.Money{Amount: req.Amount.Amount, Currency: req.Currency},
+		RefundedAmount: money.Money{Currency: req.Currency},
+		Currency:       req.Currency,
+		Status:         services.PaymentStatusAuthorized,
+		Kind:           req.Kind,
+		Timestamp:      s.clock.Now(),
+	}
+	s.payments[p.PaymentID] = p
+
+	writeJSON(w, http.StatusCreated, map[string]any{"payment_id": p.PaymentID, "status": p.Status})
+}
+
+func (s *Server) capture(w http.ResponseWriter, r *http.Request) {
+	var req services.CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PaymentID == "" {
+		writeError(w, http.StatusBadRequest, "payment_id required")
+		return
+	}
+
+	p, ok := s.payments[req.PaymentID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Payment not found")
+		return
+	}
+	if services.IsCapturedPaymentStatus(p.Status) {
+		writeConflict(w, "Payment already captured", p)
+		return
+	}
+	if p.Status != services.PaymentStatusAuthorized {
+		writeConflict(w, "Payment is not authorized", p)
+		return
+	}
+
+	p.Status = services.PaymentStatusCaptured
+	writeJSON(w, http.StatusOK, map[string]any{"payment_id": p.PaymentID, "status": p.Status})
+}
+
+type incrementRequest struct {
+	Amount   *money.Money `json:"amount"`
+	Currency *string      `json:"currency"`
+}
+
+func (s *Server) increment(w http.ResponseWriter, r *http.Request) {
+	var req incrementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount == nil || !req.Amount.IsPositive() {
+		writeError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	p, ok := s.payments[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Payment not found")
+		return
+	}
+	// Like the service, an amount in another currency conflicts with the payment.
+	if p.Status != services.PaymentStatusAuthorized || (req.Currency != nil && *req.Currency != p.Currency) {
+		writeConflict(w, "Payment is not authorized", p)
+		return
+	}
+
+	p.Amount.Amount += req.Amount.Amount
+	writeJSON(w, http.StatusOK, map[string]any{"payment_id": p.PaymentID, "status": p.Status, "amount": p.Amount})
+}
+
+func (s *Server) void(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.payments[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Payment not found")
+		return
+	}
+	if services.IsCapturedPaymentStatus(p.Status) {
+		writeConflict(w, "Payment already captured", p)
+		return
+	}
+	if p.Status != services.PaymentStatusAuthorized {
+		writeConflict(w, "Payment is not authorized", p)
+		return
+	}
+
+	p.Status = services.PaymentStatusVoided
+	writeJSON(w, http.StatusOK, map[string]any{"payment_id": p.PaymentID, "status": p.Status})
+}
+
+func (s *Server) refund(w http.ResponseWriter, r *http.Request) {
+	var req services.RefundRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+	if req.Amount != nil && !req.Amount.IsPositive() {
+		writeError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	p, ok := s.payments[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Payment not found")
+		return
+	}
+	if p.Status != services.PaymentStatusCaptured && p.Status != services.PaymentStatusPartiallyRefunded {
+		writeConflict(w, "Payment is not captured", p)
+		return
+	}
+	if req.Currency != "" && req.Currency != p.Currency {
+		writeError(w, http.StatusBadRequest, "Currency mismatch")
+		return
+	}
+
+	remaining := p.Amount.Amount - p.RefundedAmount.Amount
+	refund := remaining
+	if req.Amount != nil {
+		refund = req.Amount.Amount
+	}
+	if refund > remaining {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":      "Refund exceeds the captured amount",
+			"payment_id": p.PaymentID,
+			"refundable": money.Money{Amount: remaining, Currency: p.Currency},
+		})
+		return
+	}
+
+	p.RefundedAmount.Amount += refund
+	p.Status = services.PaymentStatusPartiallyRefunded
+	if refund == remaining {
+		p.Status = services.PaymentStatusRefunded
+	}
+	writeJSON(w, http.StatusOK, services.RefundResponse{
+		PaymentID:      p.PaymentID,
+		Status:         p.Status,
+		Amount:         p.Amount,
+		RefundedAmount: p.RefundedAmount,
+		Currency:       p.Currency,
+	})
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.payments[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Payment not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]any{"error": message})
+}
+
+func writeConflict(w http.ResponseWriter, message string, p *services.Payment) {
+	writeJSON(w, http.StatusConflict, map[string]any{"error": message, "payment_id": p.PaymentID, "status": p.Status})
+}
@@ -3,61 +3,139 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrPassengerNotFound = errors.New("passenger not found")
+	// ErrRateeNotFound means the driver or passenger to rate does not exist.
+	ErrRateeNotFound = errors.New("rated driver or passenger not found")
 )
 
+type Passenger struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// NearbyDriver is an available driver and their distance to a pickup point, in meters.
+type NearbyDriver struct {
+	ID       string  `json:"id"`
+	Distance float64 `json:"distance_m"`
+}
+
 type UserService struct {
 	usersServiceURL string
+	serviceToken    string
 }
 
-func NewUserService(usersServiceURL string) *UserService {
-	return &UserService{usersServiceURL: usersServiceURL}
+// NewUserService returns a client of the users service, authenticated with the token shared by
+// the RideNow services.
+func NewUserService(usersServiceURL, serviceToken string) *UserService {
+	return &UserService{usersServiceURL: usersServiceURL, serviceToken: serviceToken}
 }
 
-func (s *UserService) GetAvailableDriver() (string, error) {
-	url := fmt.Sprintf("%s/drivers?available=true", s.usersServiceURL)
+// header returns the headers authenticating requests to the users service.
+func (s *UserService) header() http.Header {
+	return http.Header{"Authorization": {"Bearer " + s.serviceToken}}
+}
+
+// GetNearbyAvailableDrivers returns the available drivers within radius meters of the point,
+// closest first. Drivers whose last known position is stale, or rated below minRating, are
+// ignored; a zero minRating disables the rating filter.
+func (s *UserService) GetNearbyAvailableDrivers(lat, lng, radius, minRating float64) ([]NearbyDriver, error) {
+	url := fmt.Sprintf("%s/drivers/nearby?available=true&fresh=true&lat=%f&lng=%f&radius=%.0f", s.usersServiceURL, lat, lng, radius)
+	if minRating > 0 {
+		url += fmt.Sprintf("&min_rating=%g", minRating)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header = s.header()
 
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call users service: %w", err)
+		return nil, fmt.Errorf("failed to call users service: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("users service returned status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("users service returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var drivers []struct {
-		ID          string `json:"id"`
-		Name        string `json:"name"`
-		IsAvailable bool   `json:"is_available"`
+	var drivers []NearbyDriver
+	if err := json.NewDecoder(resp.Body).Decode(&drivers); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&drivers); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	return drivers, nil
+}
+
+func (s *UserService) GetPassenger(passengerID string) (*Passenger, error) {
+	url := fmt.Sprintf("%s/passengers/%s", s.usersServiceURL, passengerID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = s.header()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call users service: %w", err)
 	}
+	defer resp.Body.Close()
 
-	if len(drivers) == 0 {
-		return "", fmt.Errorf("no available drivers found")
+	// The users service answers 400 for malformed IDs, which cannot match any passenger either.
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return nil, ErrPassengerNotFound
 	}
 
-	// Return the first available driver's ID
-	return drivers[0].ID, nil
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("users service returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var passenger Passenger
+	if err := json.NewDecoder(resp.Body).Decode(&passenger); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &passenger, nil
+}
+
+// SubscribeDriverLocation opens a WebSocket on which the users service pushes the driver's
+// positions as they are reported.
+func (s *UserService) SubscribeDriverLocation(ctx context.Context, driverID string) (*websocket.Conn, error) {
+	url := fmt.Sprintf("%s/drivers/%s/location/subscribe", s.usersServiceURL, driverID)
+	url = "ws" + strings.TrimPrefix(url, "http")
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, url, s.header())
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("users service returned status %d: %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("failed to call users service: %w", err)
+	}
+	return conn, nil
 }
 
 func (s *UserService) UpdateDriverStatus(driverID string, isAvailable bool) error {
@@ -82,6 +160,7 @@ func (s *UserService) UpdateDriverStatus(driverID string, isAvailable bool) erro
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
+	req.Header = s.header()
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 5 * time.Second}
@@ -99,3 +178,58 @@ func (s *UserService) UpdateDriverStatus(driverID string, isAvailable bool) erro
 	log.Printf("[UPDATE] Driver %s availability set to %v", driverID, isAvailable)
 	return nil
 }
+
+// RateDriver adds a ride's score to the driver's average rating. The users service adds a
+// rating only once, so it can be sent again when the outcome of a call is unknown.
+func (s *UserService) RateDriver(driverID, ratingID string, score int) error {
+	return s.rate(fmt.Sprintf("%s/drivers/%s/ratings", s.usersServiceURL, driverID), ratingID, score)
+}
+
+// RatePassenger adds a ride's score to the passenger's average rating, once per rating like
+// RateDriver.
+func (s *UserService) RatePassenger(passengerID, ratingID string, score int) error {
+	return s.rate(fmt.Sprintf("%s/passengers/%s/ratings", s.usersServiceURL, passengerID), ratingID, score)
+}
+
+func (s *UserService) rate(url, ratingID string, score int) error {
+	payload := struct {
+		RatingID string `json:"rating_id"`
+		Score    int    `json:"score"`
+	}{
+		RatingID: ratingID,
+		Score:    score,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(jsonData)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header = s.header()
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call users service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrRateeNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("users service returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
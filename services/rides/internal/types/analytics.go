@@ -0,0 +1,53 @@
+package types
+
+import (
+	"rides/internal/money"
+	"time"
+)
+
+// ZonePairStats counts the rides between two zones. Revenue sums the fares of the completed
+// ones and AveragePrice is their average.
+type ZonePairStats struct {
+	FromZone     string      `bson:"from_zone" json:"from_zone"`
+	ToZone       string      `bson:"to_zone" json:"to_zone"`
+	Rides        int         `bson:"rides" json:"rides"`
+	Completed    int         `bson:"completed" json:"completed"`
+	Cancelled    int         `bson:"cancelled" json:"cancelled"`
+	Revenue      money.Money `bson:"revenue" json:"revenue"`
+	AveragePrice money.Money `bson:"average_price" json:"averagePrice"`
+}
+
+// RevenueBucket totals the fares and captured tips of the rides completed during a bucket.
+type RevenueBucket struct {
+	Start        time.Time   `bson:"start" json:"start"`
+	Rides        int         `bson:"rides" json:"rides"`
+	Fares        money.Money `bson:"fares" json:"fares"`
+	Tips         money.Money `bson:"tips" json:"tips"`
+	AveragePrice money.Money `bson:"average_price" json:"averagePrice"`
+}
+
+// CompletionBucket counts how the rides requested during a bucket ended. Rates are shares of
+// all the bucket's rides, those still active included.
+type CompletionBucket struct {
+	Start            time.Time `bson:"start" json:"start"`
+	Rides            int       `bson:"rides" json:"rides"`
+	Completed        int       `bson:"completed" json:"completed"`
+	Cancelled        int       `bson:"cancelled" json:"cancelled"`
+	NoDriverFound    int       `bson:"no_driver_found" json:"noDriverFound"`
+	CompletionRate   float64   `bson:"-" json:"completionRate"`
+	CancellationRate float64   `bson:"-" json:"cancellationRate"`
+}
+
+// DriverActivityBucket measures how busy the drivers who completed rides during a bucket were:
+// BusyMinutes sums the time from pickup to drop-off, and BusyShare is its share of the
+// bucket's duration times the number of active drivers. BusyShare is not a utilization rate:
+// drivers are counted for the whole bucket, whether or not they were online all of it. Rides
+// whose pickup time was not recorded count as rides but not as busy time.
+type DriverActivityBucket struct {
+	Start          time.Time `bson:"start" json:"start"`
+	ActiveDrivers  int       `bson:"active_drivers" json:"activeDrivers"`
+	Rides          int       `bson:"rides" json:"rides"`
+	BusyMinutes    float64   `bson:"busy_minutes" json:"busyMinutes"`
+	RidesPerDriver float64   `bson:"-" json:"ridesPerDriver"`
+	BusyShare      float64   `bson:"-" json:"busyShare"`
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CaptureJob is a payment to capture in the background: the fare of a completed ride, or of a
+// pooled ride's passenger once dropped off. Jobs that keep failing are moved to the dead
+// letters, where they stay until requeued.
+type CaptureJob struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RideID primitive.ObjectID `bson:"ride_id" json:"rideId"`
+	// PassengerID is set for the fare of a pooled ride's passenger.
+	PassengerID string `bson:"passenger_id,omitempty" json:"passengerId,omitempty"`
+	PaymentID   string `bson:"payment_id" json:"paymentId"`
+	Attempts    int    `bson:"attempts" json:"attempts"`
+	// AvailableAt is when the job can next be claimed by a worker: its next retry, or the end
+	// of the lease of the worker processing it.
+	AvailableAt time.Time  `bson:"available_at" json:"availableAt"`
+	LastError   string     `bson:"last_error,omitempty" json:"lastError,omitempty"`
+	CreatedAt   time.Time  `bson:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updatedAt"`
+	DeadAt      *time.Time `bson:"dead_at,omitempty" json:"deadAt,omitempty"`
+}
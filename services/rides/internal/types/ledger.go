@@ -0,0 +1,64 @@
+package types
+
+import (
+	"rides/internal/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of ledger transactions.
+const (
+	TransactionFare       = "FARE"
+	TransactionTip        = "TIP"
+	TransactionAdjustment = "ADJUSTMENT"
+	TransactionPayout     = "PAYOUT"
+)
+
+// Posting is one side of a ledger transaction on an account: either a debit or a credit.
+type Posting struct {
+	Account string      `bson:"account" json:"account"`
+	Debit   money.Money `bson:"debit,omitempty" json:"debit,omitzero"`
+	Credit  money.Money `bson:"credit,omitempty" json:"credit,omitzero"`
+}
+
+// Transaction is a balanced set of postings: its debits and credits sum to the same amount.
+// Reference identifies what it records (a payment, an adjustment, a payout) so that it is
+// posted once per Kind.
+type Transaction struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Kind        string              `bson:"kind" json:"kind"`
+	Reference   string              `bson:"reference" json:"reference"`
+	DriverID    string              `bson:"driver_id" json:"driverId"`
+	RideID      *primitive.ObjectID `bson:"ride_id,omitempty" json:"rideId,omitempty"`
+	Description string              `bson:"description,omitempty" json:"description,omitempty"`
+	Postings    []Posting           `bson:"postings" json:"postings"`
+	CreatedAt   time.Time           `bson:"created_at" json:"createdAt"`
+}
+
+// EarningsSummary totals what a driver earned over a period. Fares are credited net of the
+// platform commission; Net is what the driver is owed for the period.
+type EarningsSummary struct {
+	Rides       int         `bson:"rides" json:"rides"`
+	GrossFares  money.Money `bson:"gross_fares" json:"grossFares"`
+	Commission  money.Money `bson:"commission" json:"commission"`
+	NetFares    money.Money `bson:"net_fares" json:"netFares"`
+	Tips        money.Money `bson:"tips" json:"tips"`
+	Adjustments money.Money `bson:"adjustments" json:"adjustments"`
+	Net         money.Money `bson:"net" json:"net"`
+}
+
+// Statement is a driver's weekly payout statement. A negative balance, when adjustments exceed
+// earnings, is carried over to the next statement instead of being paid out.
+type Statement struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DriverID     string             `bson:"driver_id" json:"driverId"`
+	PeriodStart  time.Time          `bson:"period_start" json:"periodStart"`
+	PeriodEnd    time.Time          `bson:"period_end" json:"periodEnd"`
+	Summary      EarningsSummary    `bson:"summary" json:"summary"`
+	CarriedOver  money.Money        `bson:"carried_over" json:"carriedOver"`
+	Payout       money.Money        `bson:"payout" json:"payout"`
+	Remainder    money.Money        `bson:"remainder" json:"remainder"`
+	Transactions int                `bson:"transactions" json:"transactions"`
+	CreatedAt    time.Time          `bson:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OfferPending   = "OFFERED"
+	OfferAccepted  = "ACCEPTED"
+	OfferDeclined  = "DECLINED"
+	OfferExpired   = "EXPIRED"
+	OfferCancelled = "CANCELLED"
+)
+
+// Offer records a ride being proposed to a driver, who must accept it before ExpiresAt.
+// Every offer is kept, whatever its outcome.
+type Offer struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RideID        primitive.ObjectID `bson:"ride_id" json:"rideId"`
+	DriverID      string             `bson:"driver_id" json:"driverId"`
+	Attempt       int                `bson:"attempt" json:"attempt"`
+	DistanceM     float64            `bson:"distance_m" json:"distanceM"`
+	Status        string             `bson:"status" json:"status"`
+	OfferedAt     time.Time          `bson:"offered_at" json:"offeredAt"`
+	ExpiresAt     time.Time          `bson:"expires_at" json:"expiresAt"`
+	RespondedAt   *time.Time         `bson:"responded_at,omitempty" json:"respondedAt,omitempty"`
+	DeclineReason string             `bson:"decline_reason,omitempty" json:"declineReason,omitempty"`
+}
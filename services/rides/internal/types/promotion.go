@@ -0,0 +1,58 @@
+package types
+
+import (
+	"rides/internal/money"
+	"rides/internal/pricing"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of promotion discounts.
+const (
+	PromotionPercent = "PERCENT"
+	PromotionFixed   = "FIXED"
+)
+
+// Promotion is a promo code passengers enter when booking a ride to get a discount on its
+// fare. It is valid between StartsAt and EndsAt, when set, and only for rides picking up or
+// dropping off in one of its Zones, when set. MaxRedemptions bounds the uses of the code
+// across all passengers and MaxPerPassenger the uses by a single passenger; zero means
+// unlimited. Redemptions counts the uses so far.
+type Promotion struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code            string             `bson:"code" json:"code"`
+	Description     string             `bson:"description,omitempty" json:"description,omitempty"`
+	Kind            string             `bson:"kind" json:"kind"`
+	Percent         int64              `bson:"percent,omitempty" json:"percent,omitempty"`
+	Amount          money.Money        `bson:"amount,omitempty" json:"amount,omitzero"`
+	StartsAt        *time.Time         `bson:"starts_at,omitempty" json:"startsAt,omitempty"`
+	EndsAt          *time.Time         `bson:"ends_at,omitempty" json:"endsAt,omitempty"`
+	Zones           []string           `bson:"zones,omitempty" json:"zones,omitempty"`
+	MaxRedemptions  int                `bson:"max_redemptions" json:"maxRedemptions"`
+	MaxPerPassenger int                `bson:"max_per_passenger" json:"maxPerPassenger"`
+	Redemptions     int                `bson:"redemptions" json:"redemptions"`
+	CreatedAt       time.Time          `bson:"created_at" json:"createdAt"`
+}
+
+// ActiveAt reports whether the promotion's validity window covers t.
+func (p *Promotion) ActiveAt(t time.Time) bool {
+	return (p.StartsAt == nil || !t.Before(*p.StartsAt)) && (p.EndsAt == nil || t.Before(*p.EndsAt))
+}
+
+// AppliesTo reports whether a trip from one zone to another is eligible for the promotion.
+func (p *Promotion) AppliesTo(from, to string) bool {
+	return len(p.Zones) == 0 || slices.Contains(p.Zones, from) || slices.Contains(p.Zones, to)
+}
+
+// Discount is the fare discount granted by the promotion.
+func (p *Promotion) Discount() pricing.Discount {
+	d := pricing.Discount{Label: "Promo " + p.Code}
+	if p.Kind == PromotionPercent {
+		d.Percent = p.Percent
+	} else {
+		d.Fixed = p.Amount
+	}
+	return d
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Who gave a rating: the passenger rates the driver, the driver rates the passenger.
+const (
+	RatedByPassenger = "PASSENGER"
+	RatedByDriver    = "DRIVER"
+)
+
+// Rating is the feedback left by one participant of a completed ride about the other.
+type Rating struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RideID    primitive.ObjectID `bson:"ride_id" json:"rideId"`
+	RatedBy   string             `bson:"rated_by" json:"ratedBy"`
+	RaterID   string             `bson:"rater_id" json:"raterId"`
+	RateeID   string             `bson:"ratee_id" json:"rateeId"`
+	Score     int                `bson:"score" json:"score"`
+	Comment   string             `bson:"comment,omitempty" json:"comment,omitempty"`
+	Tags      []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+	// Applied tells whether the score was added to the ratee's average in the users service.
+	Applied bool `bson:"applied" json:"-"`
+}
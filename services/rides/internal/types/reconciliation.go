@@ -0,0 +1,64 @@
+package types
+
+import (
+	"rides/internal/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of discrepancies between the rides and the payment service.
+const (
+	// DiscrepancyMissingPayment: a completed ride, or a tip, was never authorized.
+	DiscrepancyMissingPayment = "MISSING_PAYMENT"
+	// DiscrepancyPaymentNotFound: the payment service does not know the ride's payment.
+	DiscrepancyPaymentNotFound = "PAYMENT_NOT_FOUND"
+	// DiscrepancyLookupFailed: the payment service could not be queried.
+	DiscrepancyLookupFailed = "LOOKUP_FAILED"
+	// DiscrepancyCaptureFailed: the payment is authorized but capturing it failed again.
+	DiscrepancyCaptureFailed = "CAPTURE_FAILED"
+	// DiscrepancyPaymentStatus: the payment is in a status that cannot be captured.
+	DiscrepancyPaymentStatus = "UNEXPECTED_PAYMENT_STATUS"
+	// DiscrepancyAmountMismatch: the payment's amount differs from the ride's price or tip.
+	DiscrepancyAmountMismatch = "AMOUNT_MISMATCH"
+)
+
+// Discrepancy is a payment of a completed ride whose state at the payment service does not
+// match the ride, and could not be settled automatically.
+type Discrepancy struct {
+	Kind          string             `bson:"kind" json:"kind"`
+	RideID        primitive.ObjectID `bson:"ride_id" json:"rideId"`
+	PassengerID   string             `bson:"passenger_id" json:"passengerId"`
+	PaymentKind   string             `bson:"payment_kind" json:"paymentKind"`
+	PaymentID     string             `bson:"payment_id,omitempty" json:"paymentId,omitempty"`
+	RideStatus    string             `bson:"ride_status" json:"rideStatus"`
+	LocalStatus   string             `bson:"local_status" json:"localStatus"`
+	PaymentStatus string             `bson:"payment_status,omitempty" json:"paymentStatus,omitempty"`
+	Expected      money.Money        `bson:"expected" json:"expected"`
+	Actual        *money.Money       `bson:"actual,omitempty" json:"actual,omitempty"`
+	Detail        string             `bson:"detail,omitempty" json:"detail,omitempty"`
+}
+
+// ReconciliationReport is the outcome of a reconciliation run: how many payments of completed
+// rides were not recorded as captured, how many were captured again or found already
+// captured, and the discrepancies left.
+type ReconciliationReport struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StartedAt     time.Time          `bson:"started_at" json:"startedAt"`
+	FinishedAt    time.Time          `bson:"finished_at" json:"finishedAt"`
+	Rides         int                `bson:"rides" json:"rides"`
+	Checked       int                `bson:"checked" json:"checked"`
+	Captured      int                `bson:"captured" json:"captured"`
+	Synced        int                `bson:"synced" json:"synced"`
+	Discrepancies []Discrepancy      `bson:"discrepancies" json:"discrepancies"`
+	// Next is where the following run resumes listing unsettled rides, so that rides that
+	// cannot be settled do not hold back the newer ones. It is nil once the run reached the
+	// last unsettled ride, and the following run starts again from the oldest.
+	Next *RideCursor `bson:"next,omitempty" json:"next,omitempty"`
+}
+
+// RideCursor is a position in the completed rides, ordered by completion date then ID.
+type RideCursor struct {
+	CompletedAt time.Time          `bson:"completed_at" json:"completedAt"`
+	RideID      primitive.ObjectID `bson:"ride_id" json:"rideId"`
+}
@@ -1,21 +1,119 @@
 package types
 
 import (
+	"rides/internal/money"
+	"rides/internal/pricing"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	StatusScheduled     = "SCHEDULED"
+	StatusDispatching   = "DISPATCHING"
+	StatusRequested     = "REQUESTED"
+	StatusAssigned      = "ASSIGNED"
+	StatusInProgress    = "IN_PROGRESS"
+	StatusCompleted     = "COMPLETED"
+	StatusCancelled     = "CANCELLED"
+	StatusNoDriverFound = "NO_DRIVER_FOUND"
+)
+
+// Statuses are all the statuses of a ride.
+var Statuses = []string{
+	StatusScheduled, StatusDispatching, StatusRequested, StatusAssigned,
+	StatusInProgress, StatusCompleted, StatusCancelled, StatusNoDriverFound,
+}
+
+// ActiveStatuses are the non-terminal statuses: a passenger or a driver may hold at most one
+// ride in one of these statuses at a time.
+var ActiveStatuses = []string{StatusRequested, StatusAssigned, StatusInProgress}
+
+const (
+	StopPending  = "PENDING"
+	StopArrived  = "ARRIVED"
+	StopDeparted = "DEPARTED"
+)
+
+// Stop is one zone of a ride's route. The first stop is the pickup, the last one the
+// destination.
+type Stop struct {
+	Zone       string     `bson:"zone" json:"zone"`
+	Status     string     `bson:"status" json:"status"`
+	ArrivedAt  *time.Time `bson:"arrived_at,omitempty" json:"arrivedAt,omitempty"`
+	DepartedAt *time.Time `bson:"departed_at,omitempty" json:"departedAt,omitempty"`
+}
+
+func NewStops(route []string) []Stop {
+	stops := make([]Stop, len(route))
+	for i, zone := range route {
+		stops[i] = Stop{Zone: zone, Status: StopPending}
+	}
+	return stops
+}
+
+const (
+	ModeExclusive = "EXCLUSIVE"
+	ModePool      = "POOL"
+)
+
+const (
+	PassengerWaiting    = "WAITING"
+	PassengerPickedUp   = "PICKED_UP"
+	PassengerDroppedOff = "DROPPED_OFF"
+)
+
+// RidePassenger is one passenger of a pooled ride, with their own route, fare and payment.
+type RidePassenger struct {
+	PassengerID   string             `bson:"passenger_id" json:"passengerId"`
+	FromZone      string             `bson:"from_zone" json:"from_zone"`
+	ToZone        string             `bson:"to_zone" json:"to_zone"`
+	Price         money.Money        `bson:"price" json:"price"`
+	Fare          *pricing.Breakdown `bson:"fare,omitempty" json:"fare,omitempty"`
+	PromoCode     string             `bson:"promo_code,omitempty" json:"promoCode,omitempty"`
+	PaymentID     string             `bson:"payment_id,omitempty" json:"paymentId,omitempty"`
+	PaymentStatus string             `bson:"payment_status" json:"paymentStatus"`
+	Status        string             `bson:"status" json:"status"`
+	JoinedAt      time.Time          `bson:"joined_at" json:"joinedAt"`
+	PickedUpAt    *time.Time         `bson:"picked_up_at,omitempty" json:"pickedUpAt,omitempty"`
+	DroppedOffAt  *time.Time         `bson:"dropped_off_at,omitempty" json:"droppedOffAt,omitempty"`
+}
+
+// Ride is a trip by one driver. Exclusive rides carry a single passenger whose fare and
+// payment are on the ride itself. Pooled rides list every passenger in Passengers, each with
+// their own fare and payment; PassengerID is then the passenger who opened the pool and Price
+// the sum of all fares. Fare itemizes how Price was computed; on pooled rides each passenger
+// carries their own. Every amount of a ride is in its Currency.
 type Ride struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	PassengerID   string             `bson:"passenger_id" json:"passengerId"`
+	Mode          string             `bson:"mode,omitempty" json:"mode,omitempty"`
+	Passengers    []RidePassenger    `bson:"passengers,omitempty" json:"passengers,omitempty"`
 	PaymentID     string             `bson:"payment_id,omitempty" json:"paymentId,omitempty"`
 	DriverID      string             `bson:"driver_id" json:"driverId"`
 	FromZone      string             `bson:"from_zone" json:"from_zone"`
 	ToZone        string             `bson:"to_zone" json:"to_zone"`
-	Price         float64            `bson:"price" json:"price"`
+	Stops         []Stop             `bson:"stops,omitempty" json:"stops,omitempty"`
+	Price         money.Money        `bson:"price" json:"price"`
+	Fare          *pricing.Breakdown `bson:"fare,omitempty" json:"fare,omitempty"`
+	PromoCode     string             `bson:"promo_code,omitempty" json:"promoCode,omitempty"`
+	Currency      string             `bson:"currency" json:"currency"`
+	QuoteID       string             `bson:"quote_id,omitempty" json:"quoteId,omitempty"`
 	Status        string             `bson:"status" json:"status"`
+	ScheduledAt   *time.Time         `bson:"scheduled_at,omitempty" json:"scheduledAt,omitempty"`
 	PaymentStatus string             `bson:"payment_status" json:"paymentStatus"`
+	Tips          []Tip              `bson:"tips,omitempty" json:"tips,omitempty"`
 	CreatedAt     time.Time          `bson:"created_at" json:"createdAt"`
 	UpdatedAt     time.Time          `bson:"updated_at" json:"updatedAt"`
+	CompletedAt   *time.Time         `bson:"completed_at,omitempty" json:"completedAt,omitempty"`
+}
+
+// Tip is an extra amount a passenger gives the driver after the ride, charged separately from
+// the fare.
+type Tip struct {
+	PassengerID   string      `bson:"passenger_id" json:"passengerId"`
+	Amount        money.Money `bson:"amount" json:"amount"`
+	PaymentID     string      `bson:"payment_id,omitempty" json:"paymentId,omitempty"`
+	PaymentStatus string      `bson:"payment_status" json:"paymentStatus"`
+	CreatedAt     time.Time   `bson:"created_at" json:"createdAt"`
 }
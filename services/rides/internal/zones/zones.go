@@ -0,0 +1,65 @@
+package zones
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+type Zone struct {
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lng  float64 `json:"lng"`
+}
+
+// catalog lists the zones served by RideNow, keyed by normalized name. Coordinates are the
+// zone's pickup point.
+var catalog = map[string]Zone{
+	"downtown":       {Name: "Downtown", Lat: 45.5019, Lng: -73.5674},
+	"airport":        {Name: "Airport", Lat: 45.4706, Lng: -73.7408},
+	"suburbs":        {Name: "Suburbs", Lat: 45.5700, Lng: -73.7200},
+	"city center":    {Name: "City Center", Lat: 45.5088, Lng: -73.5540},
+	"beach":          {Name: "Beach", Lat: 45.5079, Lng: -73.5290},
+	"hotel district": {Name: "Hotel District", Lat: 45.4990, Lng: -73.5710},
+	"university":     {Name: "University", Lat: 45.5048, Lng: -73.5772},
+	"train station":  {Name: "Train Station", Lat: 45.5000, Lng: -73.5660},
+}
+
+// Lookup returns the canonical name of a known zone, ignoring case and surrounding spaces.
+func Lookup(name string) (string, bool) {
+	zone, ok := Get(name)
+	return zone.Name, ok
+}
+
+func Get(name string) (Zone, bool) {
+	zone, ok := catalog[strings.ToLower(strings.TrimSpace(name))]
+	return zone, ok
+}
+
+func All() []Zone {
+	all := make([]Zone, 0, len(catalog))
+	for _, zone := range catalog {
+		all = append(all, zone)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm returns the great-circle distance between two zones' pickup points, or 0 if
+// either zone is unknown.
+func DistanceKm(from, to string) float64 {
+	a, okA := Get(from)
+	b, okB := Get(to)
+	if !okA || !okB {
+		return 0
+	}
+
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"ridenow/pkg/auth"
+	"time"
 	"users/internal/database"
 	"users/internal/server"
+	"users/internal/services"
+	"users/internal/tracking"
 )
 
 func main() {
@@ -18,7 +23,45 @@ func main() {
 
 	port := fmt.Sprintf(":%s", getEnv("PORT", "3000"))
 
-	s := server.NewServer(db)
+	hub := tracking.NewHub(
+		getDurationEnv("LOCATION_MIN_INTERVAL", 2*time.Second),
+		getDurationEnv("LOCATION_STALE_AFTER", 2*time.Minute),
+	)
+
+	serviceToken := getEnv("SERVICE_TOKEN", "")
+	if serviceToken == "" {
+		log.Println("[WARN] SERVICE_TOKEN absent, les appels entre services seront refusés")
+	}
+
+	jwksFile := getEnv("JWT_JWKS_FILE", "")
+	if jwksFile == "" {
+		log.Println("[WARN] JWT_JWKS_FILE absent, seul le jeton de service est accepté")
+	}
+	keys, err := auth.LoadKeySet(jwksFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go keys.Run(context.Background(), getDurationEnv("JWKS_REFRESH_INTERVAL", time.Minute))
+	authn := auth.NewAuthenticator(keys, auth.Config{
+		Issuer:       getEnv("JWT_ISSUER", ""),
+		Audience:     getEnv("JWT_AUDIENCE", ""),
+		ServiceToken: serviceToken,
+	})
+
+	// Les requêtes refusées sont auditées en lignes JSON, sur la sortie standard sauf si
+	// AUDIT_LOG_FILE est renseigné.
+	auditOutput := os.Stdout
+	if path := getEnv("AUDIT_LOG_FILE", ""); path != "" {
+		auditOutput, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			log.Fatalf("AUDIT_LOG_FILE invalide: %v", err)
+		}
+	}
+	audit := auth.NewAuditLog(auditOutput, "users")
+
+	rides := services.NewRideService(getEnv("RIDES_SERVICE_URL", "http://localhost:8080"), serviceToken)
+
+	s := server.NewServer(db, hub, rides, authn, audit)
 
 	log.Printf("🚀 Service Users démarré sur le port %s", port)
 	if err := http.ListenAndServe(port, s); err != nil {
@@ -32,3 +75,15 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s invalide: %v", key, err)
+	}
+	return d
+}
@@ -2,9 +2,14 @@ module users
 
 go 1.24.4
 
-require go.mongodb.org/mongo-driver v1.17.6
+require (
+	github.com/gorilla/websocket v1.5.3
+	go.mongodb.org/mongo-driver v1.17.6
+	ridenow/pkg v0.0.0
+)
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.3.1 // indirect
 	github.com/golang/snappy v1.0.0 // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/montanaflynn/stats v0.7.1 // indirect
@@ -16,3 +21,5 @@ require (
 	golang.org/x/sync v0.11.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 )
+
+replace ridenow/pkg => ../pkg
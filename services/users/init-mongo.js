@@ -14,22 +14,39 @@ db.createCollection("drivers");
 db.drivers.insertMany([
   {
     name: "Rick Sanchez",
+    location: { type: "Point", coordinates: [-73.5674, 45.5019] },
+    location_updated_at: new Date(),
     is_available: true,
+    shift_status: "ONLINE",
   },
   {
     name: "Morty Smith",
+    location: { type: "Point", coordinates: [-73.554, 45.5088] },
+    location_updated_at: new Date(),
     is_available: true,
+    shift_status: "ONLINE",
   },
   {
     name: "Summer Smith",
+    location: { type: "Point", coordinates: [-73.7408, 45.4706] },
+    location_updated_at: new Date(),
     is_available: false,
+    shift_status: "ONLINE",
   },
   {
     name: "Beth Smith",
+    location: { type: "Point", coordinates: [-73.5772, 45.5048] },
+    location_updated_at: new Date(),
     is_available: false,
+    shift_status: "OFFLINE",
   },
 ]);
 
+db.drivers.createIndex({ location: "2dsphere" });
+
+db.createCollection("driver_shifts");
+db.driver_shifts.createIndex({ driver_id: 1, started_at: -1 });
+
 db.createCollection("passengers");
 
 db.passengers.insertMany([
@@ -16,6 +16,7 @@ type Database struct {
 	client     *mongo.Client
 	driversCollection   *mongo.Collection
 	passengersCollection *mongo.Collection
+	shiftsCollection     *mongo.Collection
 }
 
 func InitMongoDB(mongoURI string) (*Database, error) {
@@ -37,15 +38,60 @@ func InitMongoDB(mongoURI string) (*Database, error) {
 	db := client.Database("ridenow_users")
 	driversCollection := db.Collection("drivers")
 	passengersCollection := db.Collection("passengers")
-	
+	shiftsCollection := db.Collection("driver_shifts")
+
+	// Index géospatial pour la recherche des chauffeurs les plus proches
+	_, err = driversCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = shiftsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "driver_id", Value: 1}, {Key: "started_at", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateShiftStatus(driversCollection); err != nil {
+		return nil, err
+	}
+
 	log.Println("✅ Connecté à MongoDB")
 	return &Database{
 		client:              client,
 		driversCollection:   driversCollection,
 		passengersCollection: passengersCollection,
+		shiftsCollection:     shiftsCollection,
 	}, nil
 }
 
+// migrationTimeout borne les migrations du démarrage, qui parcourent toute une collection et
+// dépassent largement le délai de connexion.
+const migrationTimeout = 10 * time.Minute
+
+// migrateShiftStatus met hors service les chauffeurs créés avant les états de service, comme les
+// nouveaux chauffeurs : aucun service ouvert n'est enregistré pour eux dans driver_shifts, et ils
+// ne reçoivent de courses qu'après leur prise de service.
+func migrateShiftStatus(drivers *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	res, err := drivers.UpdateMany(ctx,
+		bson.M{"shift_status": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"shift_status": types.ShiftOffline}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("Migration : %d chauffeurs mis hors service", res.ModifiedCount)
+	}
+	return nil
+}
+
 func (db *Database) CreateDriver(ctx context.Context, driver *types.Driver) (*primitive.ObjectID, error) {
 	res, err := db.driversCollection.InsertOne(ctx, driver)
 	if err != nil {
@@ -59,7 +105,7 @@ func (db *Database) CreateDriver(ctx context.Context, driver *types.Driver) (*pr
 func (db *Database) GetDrivers(ctx context.Context, available *bool) ([]types.Driver, error) {
 	filter := bson.M{}
 	if available != nil && *available {
-		filter = bson.M{"is_available": true}
+		filter = bson.M{"is_available": true, "shift_status": types.ShiftOnline}
 	}
 
 	cursor, err := db.driversCollection.Find(ctx, filter)
@@ -85,6 +131,75 @@ func (db *Database) UpdateDriverStatus(ctx context.Context, id primitive.ObjectI
 	return err
 }
 
+func (db *Database) GetDriverByID(ctx context.Context, id primitive.ObjectID) (*types.Driver, error) {
+	var driver types.Driver
+	err := db.driversCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&driver)
+	if err != nil {
+		return nil, err
+	}
+	return &driver, nil
+}
+
+func (db *Database) UpdateDriverLocation(ctx context.Context, id primitive.ObjectID, location *types.GeoPoint) (bool, error) {
+	res, err := db.driversCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"location":            location,
+			"location_updated_at": time.Now(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// GetNearbyDrivers renvoie les chauffeurs situés à moins de radius mètres du point, du plus
+// proche au plus éloigné. Avec updatedSince, les positions plus anciennes sont ignorées.
+func (db *Database) GetNearbyDrivers(ctx context.Context, point *types.GeoPoint, radius float64, available *bool, updatedSince *time.Time, minRating float64, limit int) ([]types.NearbyDriver, error) {
+	query := bson.M{}
+	// Un chauffeur n'est proposé que s'il est en service et pas déjà en course
+	if available != nil && *available {
+		query["is_available"] = true
+		query["shift_status"] = types.ShiftOnline
+	}
+	if updatedSince != nil {
+		query["location_updated_at"] = bson.M{"$gte": *updatedSince}
+	}
+	// Les chauffeurs pas encore notés ne sont pas écartés par la note minimale
+	if minRating > 0 {
+		query["$or"] = bson.A{
+			bson.M{"rating": bson.M{"$gte": minRating}},
+			bson.M{"rating": bson.M{"$exists": false}},
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          point,
+			"distanceField": "distance",
+			"maxDistance":   radius,
+			"query":         query,
+			"spherical":     true,
+		}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := db.driversCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	drivers := []types.NearbyDriver{}
+	if err = cursor.All(ctx, &drivers); err != nil {
+		return nil, err
+	}
+
+	return drivers, nil
+}
+
 func (db *Database) CreatePassenger(ctx context.Context, passenger *types.Passenger) (*primitive.ObjectID, error) {
 	now := time.Now()
 	passenger.CreatedAt = now
@@ -128,7 +243,10 @@ func (db *Database) UpdatePassenger(ctx context.Context, id primitive.ObjectID,
 	_, err := db.passengersCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": id},
-		bson.M{"$set": passenger},
+		bson.M{"$set": bson.M{
+			"name":       passenger.Name,
+			"updated_at": passenger.UpdatedAt,
+		}},
 	)
 	return err
 }
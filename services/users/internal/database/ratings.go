@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"users/internal/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RecordDriverRating ajoute une note à la moyenne glissante du chauffeur. Renvoie false si le
+// chauffeur n'existe pas.
+func (db *Database) RecordDriverRating(ctx context.Context, id primitive.ObjectID, ratingID string, score int) (bool, error) {
+	return recordRating(ctx, db.driversCollection, id, ratingID, score)
+}
+
+// RecordPassengerRating ajoute une note à la moyenne glissante du passager. Renvoie false si le
+// passager n'existe pas.
+func (db *Database) RecordPassengerRating(ctx context.Context, id primitive.ObjectID, ratingID string, score int) (bool, error) {
+	return recordRating(ctx, db.passengersCollection, id, ratingID, score)
+}
+
+// recordRating garde les types.RatingWindow dernières notes et recalcule leur moyenne dans la
+// même mise à jour, pour que des notes simultanées ne se perdent pas. Une note dont
+// l'identifiant figure parmi les notes récentes a déjà été comptée et est ignorée.
+func recordRating(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, ratingID string, score int) (bool, error) {
+	filter := bson.M{"_id": id}
+	set := bson.M{
+		"recent_ratings": window("$recent_ratings", score),
+		"rating_count":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$rating_count", 0}}, 1}},
+	}
+	if ratingID != "" {
+		filter["recent_rating_ids"] = bson.M{"$ne": ratingID}
+		set["recent_rating_ids"] = window("$recent_rating_ids", ratingID)
+	}
+
+	res, err := coll.UpdateOne(ctx, filter, mongo.Pipeline{
+		{{Key: "$set", Value: set}},
+		{{Key: "$set", Value: bson.M{
+			"rating": bson.M{"$round": bson.A{bson.M{"$avg": "$recent_ratings"}, 2}},
+		}}},
+	})
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount == 1 || ratingID == "" {
+		return res.MatchedCount == 1, nil
+	}
+
+	// La note a déjà été comptée si l'utilisateur existe.
+	n, err := coll.CountDocuments(ctx, bson.M{"_id": id})
+	return n == 1, err
+}
+
+// window ajoute value à la fin du tableau field en n'en gardant que les types.RatingWindow
+// derniers éléments.
+func window(field string, value any) bson.M {
+	return bson.M{"$slice": bson.A{
+		bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{field, bson.A{}}}, bson.A{value}}},
+		-types.RatingWindow,
+	}}
+}
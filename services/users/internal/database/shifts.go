@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"time"
+	"users/internal/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetShiftStatus fait passer le chauffeur à l'état to s'il est dans l'un des états from, et
+// renvoie le chauffeur mis à jour. Renvoie mongo.ErrNoDocuments si le chauffeur n'existe pas
+// ou n'est pas dans l'un des états attendus.
+func (db *Database) SetShiftStatus(ctx context.Context, id primitive.ObjectID, from []string, to string) (*types.Driver, error) {
+	var driver types.Driver
+	err := db.driversCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "shift_status": bson.M{"$in": from}},
+		bson.M{"$set": bson.M{"shift_status": to}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&driver)
+	if err != nil {
+		return nil, err
+	}
+	return &driver, nil
+}
+
+func (db *Database) StartShift(ctx context.Context, driverID primitive.ObjectID, at time.Time) (*types.Shift, error) {
+	shift := &types.Shift{
+		DriverID:  driverID,
+		StartedAt: at,
+		Breaks:    []types.Break{},
+	}
+	res, err := db.shiftsCollection.InsertOne(ctx, shift)
+	if err != nil {
+		return nil, err
+	}
+	shift.ID = res.InsertedID.(primitive.ObjectID)
+	return shift, nil
+}
+
+// EndShift clôt le service en cours du chauffeur, ainsi que sa pause éventuelle.
+func (db *Database) EndShift(ctx context.Context, driverID primitive.ObjectID, at time.Time) error {
+	_, err := db.shiftsCollection.UpdateOne(
+		ctx,
+		openShift(driverID),
+		bson.M{"$set": bson.M{
+			"ended_at":             at,
+			"breaks.$[b].ended_at": at,
+		}},
+		openBreak(),
+	)
+	return err
+}
+
+func (db *Database) StartBreak(ctx context.Context, driverID primitive.ObjectID, at time.Time) error {
+	_, err := db.shiftsCollection.UpdateOne(
+		ctx,
+		openShift(driverID),
+		bson.M{"$push": bson.M{"breaks": types.Break{StartedAt: at}}},
+	)
+	return err
+}
+
+func (db *Database) EndBreak(ctx context.Context, driverID primitive.ObjectID, at time.Time) error {
+	_, err := db.shiftsCollection.UpdateOne(
+		ctx,
+		openShift(driverID),
+		bson.M{"$set": bson.M{"breaks.$[b].ended_at": at}},
+		openBreak(),
+	)
+	return err
+}
+
+// GetShifts renvoie l'historique des services du chauffeur, du plus récent au plus ancien.
+func (db *Database) GetShifts(ctx context.Context, driverID primitive.ObjectID, limit int64) ([]types.Shift, error) {
+	cursor, err := db.shiftsCollection.Find(
+		ctx,
+		bson.M{"driver_id": driverID},
+		options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	shifts := []types.Shift{}
+	if err = cursor.All(ctx, &shifts); err != nil {
+		return nil, err
+	}
+	return shifts, nil
+}
+
+func openShift(driverID primitive.ObjectID) bson.M {
+	return bson.M{"driver_id": driverID, "ended_at": nil}
+}
+
+func openBreak() *options.UpdateOptions {
+	return options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"b.ended_at": nil}},
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 	"users/internal/types"
 
@@ -19,7 +20,9 @@ func (s *Server) createDriver(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	driver.IsAvailable = true // Par défaut disponible
+	driver.IsAvailable = true               // Par défaut disponible
+	driver.ShiftStatus = types.ShiftOffline // Hors service jusqu'à sa prise de service
+	driver.Ratings = types.Ratings{}        // Les notes ne sont attribuées qu'à l'issue des courses
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -54,6 +57,10 @@ func (s *Server) getDrivers(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	now := time.Now()
+	for i := range drivers {
+		s.markStale(&drivers[i], now)
+	}
 
 	// Log pour tracer les appels inter-services (Pricing ou Ride qui cherche un driver)
 	log.Printf("[READ] Recherche drivers (available=%s) -> %d trouvés", availableQuery, len(drivers))
@@ -93,12 +100,131 @@ func (s *Server) setStatus(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// setLocation : Met à jour la position GPS d'un chauffeur
+func (s *Server) setLocation(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "ID Invalide", http.StatusBadRequest)
+		return
+	}
+
+	var position struct {
+		Lat *float64 `json:"lat"`
+		Lng *float64 `json:"lng"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&position); err != nil {
+		http.Error(w, "Invalid Body", http.StatusBadRequest)
+		return
+	}
+	if position.Lat == nil || position.Lng == nil || !validCoordinates(*position.Lat, *position.Lng) {
+		http.Error(w, "Coordonnées invalides", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	found, err := s.db.UpdateDriverLocation(ctx, id, types.NewGeoPoint(*position.Lat, *position.Lng))
+	if err != nil {
+		http.Error(w, "Erreur Update", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Chauffeur non trouvé", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[UPDATE] Chauffeur %s -> position: %.5f, %.5f", idStr, *position.Lat, *position.Lng)
+	w.WriteHeader(http.StatusOK)
+}
+
+const (
+	defaultNearbyRadius = 5000.0
+	maxNearbyRadius     = 50000.0
+	maxNearbyDrivers    = 20
+)
+
+// getNearbyDrivers : Liste les chauffeurs autour d'un point, du plus proche au plus éloigné
+// (ex: /drivers/nearby?lat=45.50&lng=-73.56&radius=3000&available=true&fresh=true&min_rating=4.5, rayon en mètres)
+func (s *Server) getNearbyDrivers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	lat, errLat := strconv.ParseFloat(query.Get("lat"), 64)
+	lng, errLng := strconv.ParseFloat(query.Get("lng"), 64)
+	if errLat != nil || errLng != nil || !validCoordinates(lat, lng) {
+		http.Error(w, "Coordonnées invalides", http.StatusBadRequest)
+		return
+	}
+
+	radius := defaultNearbyRadius
+	if radiusQuery := query.Get("radius"); radiusQuery != "" {
+		var err error
+		radius, err = strconv.ParseFloat(radiusQuery, 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadius {
+			http.Error(w, "Rayon invalide", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var available *bool
+	if query.Get("available") == "true" {
+		val := true
+		available = &val
+	}
+
+	// min_rating écarte les chauffeurs dont la note moyenne est inférieure
+	var minRating float64
+	if minRatingQuery := query.Get("min_rating"); minRatingQuery != "" {
+		var err error
+		minRating, err = strconv.ParseFloat(minRatingQuery, 64)
+		if err != nil || minRating < 0 || minRating > 5 {
+			http.Error(w, "Note minimale invalide", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// fresh=true écarte les chauffeurs dont la position est périmée
+	now := time.Now()
+	var updatedSince *time.Time
+	if query.Get("fresh") == "true" {
+		since := now.Add(-s.hub.StaleAfter())
+		updatedSince = &since
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	drivers, err := s.db.GetNearbyDrivers(ctx, types.NewGeoPoint(lat, lng), radius, available, updatedSince, minRating, maxNearbyDrivers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range drivers {
+		s.markStale(&drivers[i].Driver, now)
+	}
+
+	log.Printf("[READ] Recherche drivers à %.0fm de (%.5f, %.5f) (available=%s) -> %d trouvés", radius, lat, lng, query.Get("available"), len(drivers))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drivers)
+}
+
+func (s *Server) markStale(driver *types.Driver, now time.Time) {
+	driver.LocationStale = driver.LocationUpdatedAt != nil && s.hub.IsStale(*driver.LocationUpdatedAt, now)
+}
+
+func validCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
 func (s *Server) createPassenger(w http.ResponseWriter, r *http.Request) {
 	var passenger types.Passenger
 	if err := json.NewDecoder(r.Body).Decode(&passenger); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	passenger.Ratings = types.Ratings{} // Les notes ne sont attribuées qu'à l'issue des courses
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
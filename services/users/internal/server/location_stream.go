@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+	"users/internal/tracking"
+	"users/internal/types"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// streamIdleTimeout ferme le flux d'un chauffeur qui n'envoie plus rien
+	streamIdleTimeout = 60 * time.Second
+	writeTimeout      = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamLocation : WebSocket sur lequel l'application chauffeur envoie sa position en continu
+// ({"lat": 45.50, "lng": -73.56}). Les mises à jour trop rapprochées sont ignorées ; les
+// autres sont enregistrées puis diffusées aux abonnés.
+func (s *Server) streamLocation(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	driver, ok := s.findDriver(w, idStr)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer s.hub.Forget(idStr)
+
+	log.Printf("[STREAM] Chauffeur %s connecté au flux de position", idStr)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("[STREAM] Flux du chauffeur %s interrompu: %v", idStr, err)
+			}
+			log.Printf("[STREAM] Chauffeur %s déconnecté du flux de position", idStr)
+			return
+		}
+
+		var position struct {
+			Lat *float64 `json:"lat"`
+			Lng *float64 `json:"lng"`
+		}
+		if err := json.Unmarshal(data, &position); err != nil || position.Lat == nil || position.Lng == nil || !validCoordinates(*position.Lat, *position.Lng) {
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			conn.WriteJSON(map[string]string{"error": "Coordonnées invalides"})
+			continue
+		}
+
+		now := time.Now()
+		if !s.hub.Accept(idStr, now) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = s.db.UpdateDriverLocation(ctx, driver.ID, types.NewGeoPoint(*position.Lat, *position.Lng))
+		cancel()
+		if err != nil {
+			log.Printf("[ERROR] Enregistrement de la position du chauffeur %s: %v", idStr, err)
+			continue
+		}
+
+		s.hub.Publish(tracking.Position{
+			DriverID:  idStr,
+			Lat:       *position.Lat,
+			Lng:       *position.Lng,
+			UpdatedAt: now,
+		})
+	}
+}
+
+// subscribeLocation : WebSocket qui envoie la dernière position connue du chauffeur puis
+// chacune de ses mises à jour. Si aucune mise à jour n'arrive pendant LOCATION_STALE_AFTER,
+// la dernière position est renvoyée avec "stale": true.
+func (s *Server) subscribeLocation(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	driver, ok := s.findDriver(w, idStr)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	updates, unsubscribe := s.hub.Subscribe(idStr)
+	defer unsubscribe()
+
+	// Les messages de l'abonné sont ignorés ; la lecture sert à détecter sa déconnexion.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(p tracking.Position) bool {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(p) == nil
+	}
+
+	var last *tracking.Position
+	if driver.Location != nil && driver.LocationUpdatedAt != nil {
+		last = &tracking.Position{
+			DriverID:  idStr,
+			Lat:       driver.Location.Coordinates[1],
+			Lng:       driver.Location.Coordinates[0],
+			UpdatedAt: *driver.LocationUpdatedAt,
+			Stale:     s.hub.IsStale(*driver.LocationUpdatedAt, time.Now()),
+		}
+		if !send(*last) {
+			return
+		}
+	}
+
+	log.Printf("[STREAM] Nouvel abonné à la position du chauffeur %s", idStr)
+
+	ticker := time.NewTicker(s.hub.StaleAfter() / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case p := <-updates:
+			last = &p
+			if !send(p) {
+				return
+			}
+		case now := <-ticker.C:
+			if last != nil && !last.Stale && s.hub.IsStale(last.UpdatedAt, now) {
+				last.Stale = true
+				if !send(*last) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// findDriver récupère un chauffeur avant l'ouverture d'un WebSocket, en répondant 400/404/500
+// lui-même en cas d'échec.
+func (s *Server) findDriver(w http.ResponseWriter, idStr string) (*types.Driver, bool) {
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "ID Invalide", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	driver, err := s.db.GetDriverByID(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Chauffeur non trouvé", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return driver, true
+}
@@ -0,0 +1,99 @@
+package server
+
+import "ridenow/pkg/auth"
+
+const (
+	permDriversCreate    auth.Permission = "drivers:create"
+	permDriversRead      auth.Permission = "drivers:read"
+	permDriverStatus     auth.Permission = "drivers:status"
+	permDriverLocation   auth.Permission = "drivers:location"
+	permDriverTrack      auth.Permission = "drivers:track"
+	permShiftsManage     auth.Permission = "shifts:manage"
+	permShiftsRead       auth.Permission = "shifts:read"
+	permRatingsCreate    auth.Permission = "ratings:create"
+	permPassengersCreate auth.Permission = "passengers:create"
+	permPassengersList   auth.Permission = "passengers:list"
+	permPassengersRead   auth.Permission = "passengers:read"
+	permPassengersUpdate auth.Permission = "passengers:update"
+	permPassengersDelete auth.Permission = "passengers:delete"
+	permPassengerRides   auth.Permission = "passengers:rides"
+)
+
+// policy accorde les permissions de l'API des utilisateurs. Les chauffeurs et les passagers
+// n'accèdent qu'à leur propre compte ; la disponibilité des chauffeurs, que le service des courses
+// tient à jour, et la suppression des passagers sont réservées au personnel. Les administrateurs et
+// les autres services, pour lesquels le jeton de service vaut aussi dans les outils d'exploitation,
+// peuvent tout faire.
+var policy = auth.Policy{
+	permDriversCreate: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permDriversRead: {
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permDriverStatus: {
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permDriverLocation: {
+		auth.RoleDriver:  auth.ScopeOwn,
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permDriverTrack: {
+		auth.RoleDriver:     auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permShiftsManage: {
+		auth.RoleDriver:     auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permShiftsRead: {
+		auth.RoleDriver:     auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permRatingsCreate: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permPassengersCreate: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permPassengersList: {
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permPassengersRead: {
+		auth.RolePassenger:  auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+	permPassengersUpdate: {
+		auth.RolePassenger: auth.ScopeOwn,
+		auth.RoleAdmin:     auth.ScopeAll,
+		auth.RoleService:   auth.ScopeAll,
+	},
+	permPassengersDelete: {
+		auth.RoleAdmin:   auth.ScopeAll,
+		auth.RoleService: auth.ScopeAll,
+	},
+	permPassengerRides: {
+		auth.RolePassenger:  auth.ScopeOwn,
+		auth.RoleDispatcher: auth.ScopeAll,
+		auth.RoleAdmin:      auth.ScopeAll,
+		auth.RoleService:    auth.ScopeAll,
+	},
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rateDriver : Ajoute une note (1 à 5) reçue par un chauffeur à l'issue d'une course
+func (s *Server) rateDriver(w http.ResponseWriter, r *http.Request) {
+	s.recordRating(w, r, "Chauffeur", s.db.RecordDriverRating)
+}
+
+// ratePassenger : Ajoute une note (1 à 5) reçue par un passager à l'issue d'une course
+func (s *Server) ratePassenger(w http.ResponseWriter, r *http.Request) {
+	s.recordRating(w, r, "Passager", s.db.RecordPassengerRating)
+}
+
+func (s *Server) recordRating(w http.ResponseWriter, r *http.Request, kind string, record func(context.Context, primitive.ObjectID, string, int) (bool, error)) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "ID Invalide", http.StatusBadRequest)
+		return
+	}
+
+	// rating_id, envoyé par le service Rides, évite de compter deux fois une note renvoyée
+	var rating struct {
+		RatingID string `json:"rating_id"`
+		Score    int    `json:"score"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&rating); err != nil {
+		http.Error(w, "Invalid Body", http.StatusBadRequest)
+		return
+	}
+	if rating.Score < 1 || rating.Score > 5 {
+		http.Error(w, "Note invalide (1 à 5)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	found, err := record(ctx, id, rating.RatingID, rating.Score)
+	if err != nil {
+		http.Error(w, "Erreur Update", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, kind+" non trouvé", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[UPDATE] %s %s -> note reçue: %d", kind, idStr, rating.Score)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"users/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// getPassengerRides : Historique des courses d'un passager, obtenu du service des courses
+// (GET /passengers/{id}/rides?limit=...&before=..., before étant le next_cursor de la page
+// précédente), avec le total dépensé et sa dernière course
+func (s *Server) getPassengerRides(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "ID Invalide", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "limit invalide", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.db.GetPassengerByID(ctx, id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Passager non trouvé", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history, err := s.rides.GetPassengerRides(idStr, limit, query.Get("before"))
+	if err != nil {
+		if err == services.ErrInvalidPage {
+			http.Error(w, "Pagination invalide", http.StatusBadRequest)
+			return
+		}
+		log.Printf("[ERROR] Historique du passager %s indisponible: %v", idStr, err)
+		http.Error(w, "Service des courses indisponible", http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("[READ] Historique du passager %s -> %d course(s)", idStr, len(history.Rides))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
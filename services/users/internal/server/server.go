@@ -2,30 +2,47 @@ package server
 
 import (
 	"net/http"
+	"ridenow/pkg/auth"
 	"users/internal/database"
+	"users/internal/services"
+	"users/internal/tracking"
 )
 
 type Server struct {
-	db *database.Database
+	db    *database.Database
+	hub   *tracking.Hub
+	rides *services.RideService
+	authn *auth.Authenticator
+	authz *auth.Authorizer
 }
 
-func NewServer(db *database.Database) *Server {
-	return &Server{db: db}
+func NewServer(db *database.Database, hub *tracking.Hub, rides *services.RideService, authn *auth.Authenticator, audit *auth.AuditLog) *Server {
+	return &Server{db: db, hub: hub, rides: rides, authn: authn, authz: auth.NewAuthorizer(policy, audit)}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("POST /drivers", s.createDriver)
-	mux.HandleFunc("GET /drivers", s.getDrivers)
-	mux.HandleFunc("PATCH /drivers/{id}/status", s.setStatus)
-
-	mux.HandleFunc("POST /passengers", s.createPassenger)
-	mux.HandleFunc("GET /passengers", s.getPassengers)
-	mux.HandleFunc("GET /passengers/{id}", s.getPassenger)
-	mux.HandleFunc("PUT /passengers/{id}", s.updatePassenger)
-	mux.HandleFunc("DELETE /passengers/{id}", s.deletePassenger)
-
-	mux.ServeHTTP(w, r)
+	// Chaque route exige une permission de policy.
+	mux.HandleFunc("POST /drivers", s.authz.Require(permDriversCreate, nil, s.createDriver))
+	mux.HandleFunc("GET /drivers", s.authz.Require(permDriversRead, nil, s.getDrivers))
+	mux.HandleFunc("PATCH /drivers/{id}/status", s.authz.Require(permDriverStatus, nil, s.setStatus))
+	mux.HandleFunc("PATCH /drivers/{id}/location", s.authz.Require(permDriverLocation, auth.Self, s.setLocation))
+	mux.HandleFunc("GET /drivers/nearby", s.authz.Require(permDriversRead, nil, s.getNearbyDrivers))
+	mux.HandleFunc("GET /drivers/{id}/location/stream", s.authz.Require(permDriverLocation, auth.Self, s.streamLocation))
+	mux.HandleFunc("GET /drivers/{id}/location/subscribe", s.authz.Require(permDriverTrack, auth.Self, s.subscribeLocation))
+	mux.HandleFunc("POST /drivers/{id}/shift/{action}", s.authz.Require(permShiftsManage, auth.Self, s.changeShift))
+	mux.HandleFunc("GET /drivers/{id}/shifts", s.authz.Require(permShiftsRead, auth.Self, s.getShifts))
+	mux.HandleFunc("POST /drivers/{id}/ratings", s.authz.Require(permRatingsCreate, nil, s.rateDriver))
+
+	mux.HandleFunc("POST /passengers", s.authz.Require(permPassengersCreate, nil, s.createPassenger))
+	mux.HandleFunc("GET /passengers", s.authz.Require(permPassengersList, nil, s.getPassengers))
+	mux.HandleFunc("GET /passengers/{id}", s.authz.Require(permPassengersRead, auth.Self, s.getPassenger))
+	mux.HandleFunc("PUT /passengers/{id}", s.authz.Require(permPassengersUpdate, auth.Self, s.updatePassenger))
+	mux.HandleFunc("DELETE /passengers/{id}", s.authz.Require(permPassengersDelete, nil, s.deletePassenger))
+	mux.HandleFunc("POST /passengers/{id}/ratings", s.authz.Require(permRatingsCreate, nil, s.ratePassenger))
+	mux.HandleFunc("GET /passengers/{id}/rides", s.authz.Require(permPassengerRides, auth.Self, s.getPassengerRides))
+
+	s.authn.Middleware(mux).ServeHTTP(w, r)
 }
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"users/internal/types"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultShiftHistory = 20
+	maxShiftHistory     = 100
+)
+
+// shiftTransitions associe à chaque action de service les états depuis lesquels elle est
+// permise et l'état atteint.
+var shiftTransitions = map[string]struct {
+	from []string
+	to   string
+}{
+	"start":  {from: []string{types.ShiftOffline}, to: types.ShiftOnline},
+	"end":    {from: []string{types.ShiftOnline, types.ShiftOnBreak}, to: types.ShiftOffline},
+	"break":  {from: []string{types.ShiftOnline}, to: types.ShiftOnBreak},
+	"resume": {from: []string{types.ShiftOnBreak}, to: types.ShiftOnline},
+}
+
+// changeShift : Prise de service, fin de service, pause et reprise d'un chauffeur
+// (POST /drivers/{id}/shift/{action}, action parmi start, end, break, resume)
+func (s *Server) changeShift(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "ID Invalide", http.StatusBadRequest)
+		return
+	}
+
+	action := r.PathValue("action")
+	transition, ok := shiftTransitions[action]
+	if !ok {
+		http.Error(w, "Action inconnue", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	driver, err := s.db.SetShiftStatus(ctx, id, transition.from, transition.to)
+	if err == mongo.ErrNoDocuments {
+		current, getErr := s.db.GetDriverByID(ctx, id)
+		if getErr == mongo.ErrNoDocuments {
+			http.Error(w, "Chauffeur non trouvé", http.StatusNotFound)
+			return
+		}
+		if getErr != nil {
+			http.Error(w, getErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Action "+action+" impossible depuis l'état "+current.ShiftStatus, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erreur Update", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	switch action {
+	case "start":
+		_, err = s.db.StartShift(ctx, id, now)
+	case "end":
+		err = s.db.EndShift(ctx, id, now)
+	case "break":
+		err = s.db.StartBreak(ctx, id, now)
+	case "resume":
+		err = s.db.EndBreak(ctx, id, now)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Historique de service du chauffeur %s non enregistré: %v", idStr, err)
+	}
+
+	log.Printf("[UPDATE] Chauffeur %s -> service: %s", idStr, driver.ShiftStatus)
+
+	s.markStale(driver, now)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(driver)
+}
+
+// getShifts : Historique des services d'un chauffeur, du plus récent au plus ancien (?limit=20)
+func (s *Server) getShifts(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		http.Error(w, "ID Invalide", http.StatusBadRequest)
+		return
+	}
+
+	limit := int64(defaultShiftHistory)
+	if limitQuery := r.URL.Query().Get("limit"); limitQuery != "" {
+		limit, err = strconv.ParseInt(limitQuery, 10, 64)
+		if err != nil || limit <= 0 || limit > maxShiftHistory {
+			http.Error(w, "Limite invalide", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shifts, err := s.db.GetShifts(ctx, id, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[READ] Historique de service du chauffeur %s -> %d services", idStr, len(shifts))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shifts)
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"users/internal/types"
+)
+
+// ErrInvalidPage est renvoyée quand le service des courses refuse la pagination demandée.
+var ErrInvalidPage = errors.New("pagination invalide")
+
+// rideView et rideHistory reprennent les réponses du service des courses, en camelCase. Les
+// montants sont gardés tels quels, sans passer par un float64, pour ne pas arrondir les
+// centimes.
+type rideView struct {
+	ID          string      `json:"id"`
+	Mode        string      `json:"mode"`
+	Status      string      `json:"status"`
+	FromZone    string      `json:"from_zone"`
+	ToZone      string      `json:"to_zone"`
+	Price       json.Number `json:"price"`
+	Tips        json.Number `json:"tips"`
+	Currency    string      `json:"currency"`
+	DriverID    string      `json:"driverId"`
+	ScheduledAt *time.Time  `json:"scheduledAt"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	CompletedAt *time.Time  `json:"completedAt"`
+}
+
+type rideHistory struct {
+	PassengerID string     `json:"passengerId"`
+	Rides       []rideView `json:"rides"`
+	NextCursor  string     `json:"nextCursor"`
+	Totals      struct {
+		Rides     int         `json:"rides"`
+		Completed int         `json:"completed"`
+		Cancelled int         `json:"cancelled"`
+		Spent     json.Number `json:"spent"`
+		Currency  string      `json:"currency"`
+	} `json:"totals"`
+	LastRide *rideView `json:"lastRide"`
+}
+
+func (v rideView) toPassengerRide() types.PassengerRide {
+	return types.PassengerRide{
+		ID:          v.ID,
+		Mode:        v.Mode,
+		Status:      v.Status,
+		FromZone:    v.FromZone,
+		ToZone:      v.ToZone,
+		Price:       v.Price,
+		Tips:        v.Tips,
+		Currency:    v.Currency,
+		DriverID:    v.DriverID,
+		ScheduledAt: v.ScheduledAt,
+		CreatedAt:   v.CreatedAt,
+		CompletedAt: v.CompletedAt,
+	}
+}
+
+// RideService est le client du service des courses.
+type RideService struct {
+	ridesServiceURL string
+	serviceToken    string
+}
+
+// NewRideService renvoie un client du service des courses, authentifié par le jeton partagé des
+// services RideNow.
+func NewRideService(ridesServiceURL, serviceToken string) *RideService {
+	return &RideService{ridesServiceURL: ridesServiceURL, serviceToken: serviceToken}
+}
+
+// GetPassengerRides renvoie une page de l'historique des courses du passager, des plus récentes
+// aux plus anciennes. limit vaut 0 pour la taille de page par défaut ; before est le curseur
+// renvoyé par la page précédente, vide pour la première.
+func (s *RideService) GetPassengerRides(passengerID string, limit int, before string) (*types.RideHistory, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if before != "" {
+		query.Set("before", before)
+	}
+	u := fmt.Sprintf("%s/passengers/%s/rides", s.ridesServiceURL, url.PathEscape(passengerID))
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("échec de création de la requête: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.serviceToken)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("échec d'appel au service des courses: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, ErrInvalidPage
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("le service des courses a répondu %d: %s", resp.StatusCode, string(body))
+	}
+
+	var h rideHistory
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return nil, fmt.Errorf("échec de décodage de la réponse: %w", err)
+	}
+
+	history := &types.RideHistory{
+		PassengerID: h.PassengerID,
+		Rides:       make([]types.PassengerRide, len(h.Rides)),
+		NextCursor:  h.NextCursor,
+		Totals: types.RideTotals{
+			Rides:     h.Totals.Rides,
+			Completed: h.Totals.Completed,
+			Cancelled: h.Totals.Cancelled,
+			Spent:     h.Totals.Spent,
+			Currency:  h.Totals.Currency,
+		},
+	}
+	for i, v := range h.Rides {
+		history.Rides[i] = v.toPassengerRide()
+	}
+	if h.LastRide != nil {
+		last := h.LastRide.toPassengerRide()
+		history.LastRide = &last
+	}
+	return history, nil
+}
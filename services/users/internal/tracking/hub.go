@@ -0,0 +1,104 @@
+package tracking
+
+import (
+	"sync"
+	"time"
+)
+
+// Position est la dernière position connue d'un chauffeur, telle que diffusée aux abonnés.
+type Position struct {
+	DriverID  string    `json:"driver_id"`
+	Lat       float64   `json:"lat"`
+	Lng       float64   `json:"lng"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Stale     bool      `json:"stale"`
+}
+
+// Hub relaie en mémoire les positions des chauffeurs vers leurs abonnés. Il limite aussi la
+// fréquence des mises à jour acceptées par chauffeur.
+type Hub struct {
+	minInterval time.Duration
+	staleAfter  time.Duration
+
+	mu          sync.Mutex
+	lastAccept  map[string]time.Time
+	subscribers map[string]map[chan Position]struct{}
+}
+
+func NewHub(minInterval, staleAfter time.Duration) *Hub {
+	return &Hub{
+		minInterval: minInterval,
+		staleAfter:  staleAfter,
+		lastAccept:  make(map[string]time.Time),
+		subscribers: make(map[string]map[chan Position]struct{}),
+	}
+}
+
+func (h *Hub) StaleAfter() time.Duration {
+	return h.staleAfter
+}
+
+// IsStale indique si une position reçue à updatedAt est trop ancienne pour être fiable.
+func (h *Hub) IsStale(updatedAt time.Time, now time.Time) bool {
+	return now.Sub(updatedAt) > h.staleAfter
+}
+
+// Accept indique si une mise à jour reçue à now doit être prise en compte, c'est-à-dire si
+// la précédente acceptée pour ce chauffeur date d'au moins minInterval.
+func (h *Hub) Accept(driverID string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last, ok := h.lastAccept[driverID]; ok && now.Sub(last) < h.minInterval {
+		return false
+	}
+	h.lastAccept[driverID] = now
+	return true
+}
+
+// Forget oublie l'état de limitation d'un chauffeur (ex: fin de son flux).
+func (h *Hub) Forget(driverID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.lastAccept, driverID)
+}
+
+// Subscribe abonne l'appelant aux positions d'un chauffeur. La fonction renvoyée met fin à
+// l'abonnement et ferme le canal.
+func (h *Hub) Subscribe(driverID string) (<-chan Position, func()) {
+	ch := make(chan Position, 8)
+
+	h.mu.Lock()
+	if h.subscribers[driverID] == nil {
+		h.subscribers[driverID] = make(map[chan Position]struct{})
+	}
+	h.subscribers[driverID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[driverID], ch)
+			if len(h.subscribers[driverID]) == 0 {
+				delete(h.subscribers, driverID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish diffuse une position aux abonnés du chauffeur. Un abonné trop lent perd la mise à
+// jour plutôt que de bloquer le flux du chauffeur.
+func (h *Hub) Publish(p Position) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[p.DriverID] {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
@@ -6,10 +6,40 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// GeoPoint est un point GeoJSON ; les coordonnées sont dans l'ordre [longitude, latitude].
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// États de service d'un chauffeur, indépendants de sa disponibilité pour une course
+const (
+	ShiftOnline  = "ONLINE"
+	ShiftOffline = "OFFLINE"
+	ShiftOnBreak = "ON_BREAK"
+)
+
 type Driver struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name        string             `bson:"name" json:"name"`
-	IsAvailable bool               `bson:"is_available" json:"is_available"`
+	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name string             `bson:"name" json:"name"`
+	// IsAvailable indique que le chauffeur n'est pas en course ; ShiftStatus qu'il est en service
+	IsAvailable       bool       `bson:"is_available" json:"is_available"`
+	ShiftStatus       string     `bson:"shift_status" json:"shift_status"`
+	Location          *GeoPoint  `bson:"location,omitempty" json:"location,omitempty"`
+	LocationUpdatedAt *time.Time `bson:"location_updated_at,omitempty" json:"location_updated_at,omitempty"`
+	// LocationStale est calculé à la lecture : la dernière position connue est trop ancienne
+	LocationStale bool `bson:"-" json:"location_stale,omitempty"`
+	Ratings       `bson:",inline"`
+}
+
+// NearbyDriver est un chauffeur accompagné de sa distance (en mètres) au point recherché.
+type NearbyDriver struct {
+	Driver   `bson:",inline"`
+	Distance float64 `bson:"distance" json:"distance_m"`
 }
 
 type Passenger struct {
@@ -17,4 +47,19 @@ type Passenger struct {
 	Name      string             `bson:"name" json:"name"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	Ratings   `bson:",inline"`
+}
+
+// RatingWindow est le nombre de notes récentes sur lequel la moyenne est calculée.
+const RatingWindow = 100
+
+// Ratings est la note moyenne reçue à l'issue des courses, sur les RatingWindow dernières notes.
+// Elle n'est mise à jour que par le service Rides.
+type Ratings struct {
+	Rating        float64 `bson:"rating,omitempty" json:"rating,omitempty"`
+	RatingCount   int     `bson:"rating_count,omitempty" json:"rating_count"`
+	RecentRatings []int   `bson:"recent_ratings,omitempty" json:"-"`
+	// RecentRatingIDs sont les identifiants des notes récentes, pour ne pas compter deux fois
+	// une note renvoyée par le service Rides.
+	RecentRatingIDs []string `bson:"recent_rating_ids,omitempty" json:"-"`
 }
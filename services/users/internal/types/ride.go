@@ -0,0 +1,43 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PassengerRide est une course vue par l'un de ses passagers : pour un covoiturage, son propre
+// trajet et sa part du prix. Les montants sont en dollars, tels que le service des courses les
+// renvoie.
+type PassengerRide struct {
+	ID          string      `json:"id"`
+	Mode        string      `json:"mode,omitempty"`
+	Status      string      `json:"status"`
+	FromZone    string      `json:"from_zone"`
+	ToZone      string      `json:"to_zone"`
+	Price       json.Number `json:"price"`
+	Tips        json.Number `json:"tips"`
+	Currency    string      `json:"currency"`
+	DriverID    string      `json:"driver_id,omitempty"`
+	ScheduledAt *time.Time  `json:"scheduled_at,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+}
+
+// RideTotals compte les courses d'un passager et ce qu'il a dépensé pour celles terminées.
+type RideTotals struct {
+	Rides     int         `json:"rides"`
+	Completed int         `json:"completed"`
+	Cancelled int         `json:"cancelled"`
+	Spent     json.Number `json:"spent"`
+	Currency  string      `json:"currency"`
+}
+
+// RideHistory est une page de l'historique des courses d'un passager. NextCursor, s'il est
+// présent, permet de demander la page suivante.
+type RideHistory struct {
+	PassengerID string          `json:"passenger_id"`
+	Rides       []PassengerRide `json:"rides"`
+	NextCursor  string          `json:"next_cursor,omitempty"`
+	Totals      RideTotals      `json:"totals"`
+	LastRide    *PassengerRide  `json:"last_ride,omitempty"`
+}
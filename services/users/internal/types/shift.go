@@ -0,0 +1,22 @@
+package types
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shift est une période de service d'un chauffeur, de sa prise à sa fin de service.
+type Shift struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DriverID  primitive.ObjectID `bson:"driver_id" json:"driver_id"`
+	StartedAt time.Time          `bson:"started_at" json:"started_at"`
+	EndedAt   *time.Time         `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	Breaks    []Break            `bson:"breaks" json:"breaks"`
+}
+
+// Break est une pause prise pendant un service ; EndedAt est vide tant qu'elle dure.
+type Break struct {
+	StartedAt time.Time  `bson:"started_at" json:"started_at"`
+	EndedAt   *time.Time `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+}